@@ -8,15 +8,70 @@ const (
 	Int8OID = 20
 	Numeric = 1700
 
+	Float4OID = 700
+	Float8OID = 701
+	MoneyOID  = 790
+
 	TextOID    = 25
 	VarcharOID = 1043
+	BPCharOID  = 1042
+	CharOID    = 18
+	NameOID    = 19
+	XMLOID     = 142
+
+	ByteaOID = 17
 
 	TimestampOID   = 1114
 	TimestamptzOID = 1184
 	DateOID        = 1082
 	TimeOID        = 1083
+	TimetzOID      = 1266
+	IntervalOID    = 1186
+
+	JSONOID     = 114
+	JSONBOID    = 3802
+	JSONPathOID = 4072
+	UUIDOID     = 2950
+	BoolOID     = 16
+
+	InetOID     = 869
+	CIDROID     = 650
+	MacaddrOID  = 829
+	Macaddr8OID = 774
+
+	BitOID    = 1560
+	VarbitOID = 1562
+
+	OIDOID  = 26
+	XIDOID  = 28
+	CIDOID  = 29
+	Xid8OID = 5069
+	TIDOID  = 27
+
+	PointOID   = 600
+	LsegOID    = 601
+	PathOID    = 602
+	BoxOID     = 603
+	PolygonOID = 604
+	LineOID    = 628
+	CircleOID  = 718
+
+	TSVectorOID = 3614
+	TSQueryOID  = 3615
+	PgLSNOID    = 3220
+
+	TxidSnapshotOID = 2970
+	PgSnapshotOID   = 5038
 
-	JSONBOID = 3802
-	UUIDOID  = 2950
-	BoolOID  = 16
+	RegprocOID       = 24
+	RegprocedureOID  = 2202
+	RegoperOID       = 2203
+	RegoperatorOID   = 2204
+	RegclassOID      = 2205
+	RegtypeOID       = 2206
+	RegconfigOID     = 3734
+	RegdictionaryOID = 3769
+	RegnamespaceOID  = 4089
+	RegroleOID       = 4096
+	RegcollationOID  = 4191
 )
@@ -32,7 +32,11 @@ const (
 	// TypeMsgType common message type.
 	TypeMsgType byte = 'Y'
 
-	TMsgType byte = 'T'
+	// LogicalMsgType common logical decoding message type.
+	LogicalMsgType byte = 'M'
+
+	// TruncateMsgType common truncate message type.
+	TruncateMsgType byte = 'T'
 
 	// NullDataType common NULL data type.
 	NullDataType byte = 'n'
@@ -42,6 +46,9 @@ const (
 
 	// ToastDataType common toast data type.
 	ToastDataType byte = 'u'
+
+	// BinaryDataType common binary data type.
+	BinaryDataType byte = 'b'
 )
 
 var PostgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
@@ -71,6 +78,18 @@ type (
 		Timestamp time.Time
 	}
 
+	// Message logical decoding message format (pg_logical_emit_message).
+	Message struct {
+		// Flags; 1 if the message is transactional.
+		Flags int8
+		// The LSN of the message.
+		LSN int64
+		// The prefix of the message.
+		Prefix string
+		// The content of the message.
+		Content []byte
+	}
+
 	// Origin message format.
 	Origin struct {
 		// The LSN of the commit on the origin server.
@@ -118,6 +137,14 @@ type (
 		NewRow []TupleData
 	}
 
+	// Truncate message format.
+	Truncate struct {
+		// Option bits for TRUNCATE: 1 for CASCADE, 2 for RESTART IDENTITY.
+		Options int8
+		// IDs of the truncated relations.
+		RelationIDs []int32
+	}
+
 	// Delete message format.
 	Delete struct {
 		/// ID of the relation corresponding to the ID in the relation message.
@@ -155,5 +182,7 @@ type RelationColumn struct {
 
 // TupleData path of WAL message data.
 type TupleData struct {
+	// Kind of the data: NullDataType, ToastDataType, TextDataType or BinaryDataType.
+	Kind  byte
 	Value []byte
 }
@@ -10,6 +10,8 @@ var (
 	ErrEmptyWALMessage      = errors.New("empty WAL message")
 	ErrUnknownMessageType   = errors.New("unknown message type")
 	ErrRelationNotFound     = errors.New("relation not found")
+	ErrShortMessage         = errors.New("message is too short")
+	ErrMalformedMessage     = errors.New("malformed message")
 )
 
 type serviceErr struct {
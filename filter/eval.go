@@ -0,0 +1,775 @@
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/goccy/go-json"
+)
+
+// node of the syntax tree.
+type node interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type literalNode struct {
+	value any
+}
+
+type identNode struct {
+	name string
+}
+
+type memberNode struct {
+	x    node
+	name string
+}
+
+type indexNode struct {
+	x     node
+	index node
+}
+
+type listNode struct {
+	items []node
+}
+
+type unaryNode struct {
+	op string
+	x  node
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+type condNode struct {
+	cond, then, els node
+}
+
+type callNode struct {
+	name   string
+	target node // receiver of the method calls, nil for the functions
+	args   []node
+	regex  *regexp.Regexp // pattern of matches given as a literal
+}
+
+// functions arity of the functions and the methods, -1 for the methods.
+var functions = map[string]struct{ global, method int }{
+	"size":       {1, 0},
+	"has":        {1, -1},
+	"int":        {1, -1},
+	"double":     {1, -1},
+	"string":     {1, -1},
+	"startsWith": {-1, 1},
+	"endsWith":   {-1, 1},
+	"contains":   {-1, 1},
+	"matches":    {-1, 1},
+	"lowerAscii": {-1, 0},
+	"upperAscii": {-1, 0},
+}
+
+func newCall(name string, target node, args []node) (node, error) {
+	arity, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("undeclared function %s", name)
+	}
+
+	want := arity.global
+	if target != nil {
+		want = arity.method
+	}
+	if want < 0 {
+		if target != nil {
+			return nil, fmt.Errorf("%s is not a method", name)
+		}
+		return nil, fmt.Errorf("%s is a method, e.g. x.%s(...)", name, name)
+	}
+	if len(args) != want {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name, want, len(args))
+	}
+
+	call := &callNode{name: name, target: target, args: args}
+
+	switch name {
+	case "has":
+		if _, ok := args[0].(*memberNode); !ok {
+			return nil, errors.New("has expects a field, e.g. has(data.status)")
+		}
+	case "matches":
+		if lit, ok := args[0].(*literalNode); ok {
+			pattern, ok := lit.value.(string)
+			if !ok {
+				return nil, errors.New("matches expects a string pattern")
+			}
+			regex, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("matches pattern: %w", err)
+			}
+			call.regex = regex
+		}
+	}
+
+	return call, nil
+}
+
+func (n *literalNode) eval(map[string]any) (any, error) {
+	return n.value, nil
+}
+
+func (n *identNode) eval(vars map[string]any) (any, error) {
+	return normalize(vars[n.name]), nil
+}
+
+func (n *memberNode) eval(vars map[string]any) (any, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := x.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("no field %s in %s", n.name, typeName(x))
+	}
+
+	v, ok := m[n.name]
+	if !ok {
+		return nil, fmt.Errorf("no such key: %s", n.name)
+	}
+
+	return normalize(v), nil
+}
+
+func (n *indexNode) eval(vars map[string]any) (any, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.index.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x := x.(type) {
+	case map[string]any:
+		key, ok := i.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key must be a string, got %s", typeName(i))
+		}
+		v, ok := x[key]
+		if !ok {
+			return nil, fmt.Errorf("no such key: %s", key)
+		}
+		return normalize(v), nil
+	case []any:
+		idx, ok := i.(int64)
+		if !ok {
+			return nil, fmt.Errorf("list index must be an int, got %s", typeName(i))
+		}
+		if idx < 0 || idx >= int64(len(x)) {
+			return nil, fmt.Errorf("index %d out of range", idx)
+		}
+		return normalize(x[idx]), nil
+	}
+
+	return nil, fmt.Errorf("can't index %s", typeName(x))
+}
+
+func (n *listNode) eval(vars map[string]any) (any, error) {
+	list := make([]any, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+
+	return list, nil
+}
+
+func (n *unaryNode) eval(vars map[string]any) (any, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "!":
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("no such overload: !%s", typeName(x))
+		}
+		return !b, nil
+	default:
+		switch x := x.(type) {
+		case int64:
+			if x == math.MinInt64 {
+				return nil, errors.New("int overflow")
+			}
+			return -x, nil
+		case float64:
+			return -x, nil
+		case json.Number:
+			if f, err := x.Float64(); err == nil {
+				return -f, nil
+			}
+		}
+		return nil, fmt.Errorf("no such overload: -%s", typeName(x))
+	}
+}
+
+func (n *condNode) eval(vars map[string]any) (any, error) {
+	c, err := n.cond.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := c.(bool)
+	if !ok {
+		return nil, fmt.Errorf("condition must be a bool, got %s", typeName(c))
+	}
+	if b {
+		return n.then.eval(vars)
+	}
+
+	return n.els.eval(vars)
+}
+
+func (n *binaryNode) eval(vars map[string]any) (any, error) {
+	if n.op == "&&" || n.op == "||" {
+		return n.evalLogical(vars)
+	}
+
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(left, right)
+		if err != nil {
+			return nil, fmt.Errorf("no such overload: %s %s %s", typeName(left), n.op, typeName(right))
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case "in":
+		return contains(right, left)
+	default:
+		return arithmetic(n.op, left, right)
+	}
+}
+
+// evalLogical evaluates && and || like CEL, an error of one side is absorbed
+// when the other side decides the result.
+func (n *binaryNode) evalLogical(vars map[string]any) (any, error) {
+	decisive := n.op == "||" // true decides ||, false decides &&
+
+	left, leftErr := evalBool(n.left, vars)
+	if leftErr == nil && left == decisive {
+		return decisive, nil
+	}
+
+	right, rightErr := evalBool(n.right, vars)
+	if rightErr == nil && right == decisive {
+		return decisive, nil
+	}
+	if leftErr != nil {
+		return nil, leftErr
+	}
+	if rightErr != nil {
+		return nil, rightErr
+	}
+
+	return !decisive, nil
+}
+
+func evalBool(n node, vars map[string]any) (bool, error) {
+	v, err := n.eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected bool, got %s", typeName(v))
+	}
+
+	return b, nil
+}
+
+func (n *callNode) eval(vars map[string]any) (any, error) {
+	if n.name == "has" {
+		member := n.args[0].(*memberNode)
+		x, err := member.x.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := x.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("no such overload: has on %s", typeName(x))
+		}
+		_, ok = m[member.name]
+		return ok, nil
+	}
+
+	var args []any
+	if n.target != nil {
+		target, err := n.target.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, target)
+	}
+	for _, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	switch n.name {
+	case "size":
+		switch x := args[0].(type) {
+		case string:
+			return int64(utf8.RuneCountInString(x)), nil
+		case []byte:
+			return int64(len(x)), nil
+		case []any:
+			return int64(len(x)), nil
+		case map[string]any:
+			return int64(len(x)), nil
+		}
+	case "int":
+		return toInt(args[0])
+	case "double":
+		if f, ok := toFloat(args[0]); ok {
+			return f, nil
+		}
+		if s, ok := args[0].(string); ok {
+			return strconv.ParseFloat(s, 64)
+		}
+	case "string":
+		return toString(args[0])
+	case "startsWith", "endsWith", "contains", "matches":
+		s, ok1 := args[0].(string)
+		sub, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			break
+		}
+		switch n.name {
+		case "startsWith":
+			return strings.HasPrefix(s, sub), nil
+		case "endsWith":
+			return strings.HasSuffix(s, sub), nil
+		case "contains":
+			return strings.Contains(s, sub), nil
+		default:
+			regex := n.regex
+			if regex == nil {
+				var err error
+				if regex, err = regexp.Compile(sub); err != nil {
+					return nil, err
+				}
+			}
+			return regex.MatchString(s), nil
+		}
+	case "lowerAscii", "upperAscii":
+		s, ok := args[0].(string)
+		if !ok {
+			break
+		}
+		if n.name == "lowerAscii" {
+			return mapASCII(s, 'A', 'Z', 'a'-'A'), nil
+		}
+		return mapASCII(s, 'a', 'z', 'A'-'a'), nil
+	}
+
+	types := make([]string, len(args))
+	for i, arg := range args {
+		types[i] = typeName(arg)
+	}
+
+	return nil, fmt.Errorf("no such overload: %s(%s)", n.name, strings.Join(types, ", "))
+}
+
+// mapASCII shifts the ASCII letters from lo to hi by delta, the other
+// characters are kept as lowerAscii and upperAscii of CEL do.
+func mapASCII(s string, lo, hi byte, delta int) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= lo && c <= hi {
+			b[i] = byte(int(c) + delta)
+		}
+	}
+
+	return string(b)
+}
+
+// normalize converts the decoded column values to the values of the
+// expressions: nil, bool, int64, float64, json.Number, string, []byte, []any
+// and map[string]any.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case nil, bool, int64, float64, json.Number, string, []byte, []any, map[string]any:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return json.Number(strconv.FormatUint(v, 10))
+	case float32:
+		return float64(v)
+	case []float32:
+		list := make([]any, len(v))
+		for i, f := range v {
+			list[i] = float64(f)
+		}
+		return list
+	case []string:
+		list := make([]any, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list
+	case map[string]string:
+		m := make(map[string]any, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		return m
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	return v
+}
+
+// toRat returns the exact value of the number, numeric strings are numbers
+// too, so NUMERIC columns compare with numbers in both numeric_format modes.
+func toRat(v any) (*big.Rat, bool) {
+	switch v := v.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(v), true
+	case json.Number:
+		return new(big.Rat).SetString(string(v))
+	case string:
+		return new(big.Rat).SetString(v)
+	}
+
+	return nil, false
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int64, float64, json.Number:
+		return true
+	}
+
+	return false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+func toInt(v any) (any, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if math.IsNaN(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return nil, errors.New("int overflow")
+		}
+		return int64(v), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return toInt(f)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+
+	return nil, fmt.Errorf("no such overload: int(%s)", typeName(v))
+}
+
+func toString(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case json.Number:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []byte:
+		return string(v), nil
+	}
+
+	return nil, fmt.Errorf("no such overload: string(%s)", typeName(v))
+}
+
+// equal compares the values, values of different types are not equal.
+func equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if isNumber(a) || isNumber(b) {
+		x, ok1 := toRat(a)
+		y, ok2 := toRat(b)
+		return ok1 && ok2 && x.Cmp(y) == 0
+	}
+
+	switch a := a.(type) {
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case []byte:
+		b, ok := b.([]byte)
+		return ok && bytes.Equal(a, b)
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(normalize(a[i]), normalize(b[i])) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !equal(normalize(v), normalize(w)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// compare orders numbers, strings and bools.
+func compare(a, b any) (int, error) {
+	if isNumber(a) || isNumber(b) {
+		x, ok1 := toRat(a)
+		y, ok2 := toRat(b)
+		if ok1 && ok2 {
+			return x.Cmp(y), nil
+		}
+		return 0, errors.New("not comparable")
+	}
+
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case b:
+				return -1, nil
+			default:
+				return 1, nil
+			}
+		}
+	}
+
+	return 0, errors.New("not comparable")
+}
+
+// contains implements x in list and key in map.
+func contains(container, x any) (any, error) {
+	switch c := container.(type) {
+	case []any:
+		for _, item := range c {
+			if equal(x, normalize(item)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]any:
+		key, ok := x.(string)
+		if !ok {
+			return false, nil
+		}
+		_, ok = c[key]
+		return ok, nil
+	}
+
+	return nil, fmt.Errorf("no such overload: %s in %s", typeName(x), typeName(container))
+}
+
+func arithmetic(op string, a, b any) (any, error) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok && op == "+" {
+			return a + b, nil
+		}
+	case []any:
+		if b, ok := b.([]any); ok && op == "+" {
+			return append(append([]any(nil), a...), b...), nil
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return intArithmetic(op, a, b)
+		}
+	}
+
+	x, ok1 := toFloat(a)
+	y, ok2 := toFloat(b)
+	if ok1 && ok2 {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			return x / y, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no such overload: %s %s %s", typeName(a), op, typeName(b))
+}
+
+func intArithmetic(op string, a, b int64) (any, error) {
+	var r int64
+	switch op {
+	case "+":
+		r = a + b
+		if (b > 0 && r < a) || (b < 0 && r > a) {
+			return nil, errors.New("int overflow")
+		}
+	case "-":
+		r = a - b
+		if (b > 0 && r > a) || (b < 0 && r < a) {
+			return nil, errors.New("int overflow")
+		}
+	case "*":
+		r = a * b
+		if a != 0 && (r/a != b || (a == -1 && b == math.MinInt64)) {
+			return nil, errors.New("int overflow")
+		}
+	case "/", "%":
+		if b == 0 {
+			return nil, errors.New("division by zero")
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nil, errors.New("int overflow")
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	}
+
+	return r, nil
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "double"
+	case json.Number:
+		return "decimal"
+	case string:
+		return "string"
+	case []byte:
+		return "bytes"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "map"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,148 @@
+// Package filter evaluates row filter expressions over the change events.
+//
+// The expressions borrow the syntax of CEL (https://cel.dev), but this is not
+// a CEL implementation and the results differ from cel-go:
+//
+//	data.status == "PAID" && data.amount > 1000
+//	action in ["INSERT", "UPDATE"] && data.email.endsWith("@example.com")
+//	has(data.deleted_at) ? data.deleted_at == null : true
+//
+// It has null, bool, int, double and string literals, lists, the operators
+// ?:, ||, &&, !, ==, !=, <, <=, >, >=, in, +, -, *, /, %, field access and
+// indexing, and the functions size, has, int, double, string, startsWith,
+// endsWith, contains, matches, lowerAscii and upperAscii.
+//
+// The differences from CEL:
+//   - there is no type checking, the types are checked when the expression
+//     is evaluated, and == and != of values of different types are false;
+//   - null equals only null, an ordering or arithmetic with null fails;
+//   - NUMERIC values and numeric strings are numbers, "10" == 10 is true and
+//     "10" < 9 is false, and numbers of any type compare exactly;
+//   - arithmetic of an int and a double gives a double;
+//   - there are no uint, bytes and map literals, no macros such as all,
+//     exists and map, and no timestamp, duration and type values.
+package filter
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Expression compiled filter expression.
+type Expression struct {
+	src  string
+	root node
+}
+
+// Compile parses the expression, vars are the names of the variables it can reference.
+func Compile(src string, vars ...string) (*Expression, error) {
+	root, err := parse(src, vars)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", src, err)
+	}
+
+	return &Expression{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Columns returns the sorted names of the fields of the variable which the
+// expression references, e.g. status of data.status. The fields of computed
+// indexes, e.g. data[name], are not known.
+func (e *Expression) Columns(v string) []string {
+	var names []string
+	walk(e.root, func(n node) {
+		if name, ok := columnName(n, v); ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	})
+	slices.Sort(names)
+
+	return names
+}
+
+// Eval evaluates the expression with the values of the variables.
+func (e *Expression) Eval(vars map[string]any) (any, error) {
+	return e.root.eval(vars)
+}
+
+// Match evaluates the expression which must result in a bool.
+func (e *Expression) Match(vars map[string]any) (bool, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("filter %q results in %s, expected bool", e.src, typeName(v))
+	}
+
+	return b, nil
+}
+
+// columnName returns the field of the variable which the node references,
+// data.status or data["status"].
+func columnName(n node, v string) (string, bool) {
+	var x node
+	var name string
+
+	switch n := n.(type) {
+	case *memberNode:
+		x, name = n.x, n.name
+	case *indexNode:
+		lit, ok := n.index.(*literalNode)
+		if !ok {
+			return "", false
+		}
+		if name, ok = lit.value.(string); !ok {
+			return "", false
+		}
+		x = n.x
+	default:
+		return "", false
+	}
+
+	ident, ok := x.(*identNode)
+	if !ok || ident.name != v {
+		return "", false
+	}
+
+	return name, true
+}
+
+// walk calls fn for the node and all nodes below it.
+func walk(n node, fn func(node)) {
+	fn(n)
+
+	switch n := n.(type) {
+	case *memberNode:
+		walk(n.x, fn)
+	case *indexNode:
+		walk(n.x, fn)
+		walk(n.index, fn)
+	case *listNode:
+		for _, item := range n.items {
+			walk(item, fn)
+		}
+	case *unaryNode:
+		walk(n.x, fn)
+	case *binaryNode:
+		walk(n.left, fn)
+		walk(n.right, fn)
+	case *condNode:
+		walk(n.cond, fn)
+		walk(n.then, fn)
+		walk(n.els, fn)
+	case *callNode:
+		if n.target != nil {
+			walk(n.target, fn)
+		}
+		for _, arg := range n.args {
+			walk(arg, fn)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+)
+
+var testVars = []string{"action", "data", "dataOld"}
+
+// testRow decoded row of the orders table.
+var testRow = map[string]any{
+	"id":      int32(7),
+	"status":  "PAID",
+	"amount":  "1500.50", // numeric
+	"qty":     int64(3),
+	"price":   float32(2.5),
+	"active":  true,
+	"note":    nil,
+	"tags":    []string{"a", "b"},
+	"meta":    map[string]any{"source": "web", "n": json.Number("12")},
+	"name":    "Ünïcode",
+	"big":     uint64(1 << 63),
+	"payload": []byte("hi"),
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		// literals and precedence
+		{`1 + 2 * 3`, int64(7)},
+		{`(1 + 2) * 3`, int64(9)},
+		{`7 / 2`, int64(3)},
+		{`-7 % 3`, int64(-1)},
+		{`1.5 * 2`, 3.0},
+		{`"a" + "b"`, "ab"},
+		{`[1] + [2]`, []any{int64(1), int64(2)}},
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!true == false`, true},
+		{`!!true`, true},
+		{`-(-3)`, int64(3)},
+		{`1 < 2 == true`, true},
+		{`true ? 1 : 2`, int64(1)},
+		{`false ? 1 : true ? 2 : 3`, int64(2)},
+		{`1 + 2 in [3]`, true},
+		{`'single' == "single"`, true},
+		{`"a\"b\n"`, "a\"b\n"},
+		{`1e3 == 1000`, true},
+
+		// fields and indexes
+		{`data.status`, "PAID"},
+		{`data["status"]`, "PAID"},
+		{`data.meta.source`, "web"},
+		{`data.tags[1]`, "b"},
+		{`data.id`, int64(7)},
+		{`data.price`, 2.5},
+		{`data.big`, json.Number("9223372036854775808")},
+		{`action`, "UPDATE"},
+
+		// null and missing fields
+		{`data.note == null`, true},
+		{`data.note != null`, false},
+		{`data.note == "x"`, false},
+		{`data.note != "x"`, true},
+		{`data.note in ["x"]`, false},
+		{`null == null`, true},
+		{`has(data.note)`, true},
+		{`has(data.missing)`, false},
+		{`has(data.missing) && data.missing == 1`, false},
+		{`data.missing == 1 || true`, true},
+		{`true || data.missing == 1`, true},
+		{`data.missing == 1 && false`, false},
+		{`dataOld == null`, true},
+
+		// numbers of different types compare exactly
+		{`data.amount == 1500.5`, true},
+		{`data.amount > 1500`, true},
+		{`data.amount < 1500.51`, true},
+		{`data.id == 7.0`, true},
+		{`data.id == "7"`, true},
+		{`data.qty in [1, 2, 3]`, true},
+		{`data.meta.n == 12`, true},
+		{`data.big > 9223372036854775807`, true},
+		{`1 == 1.0`, true},
+		{`"abc" == 1`, false},
+		{`"1e2" == 100`, true},
+		{`true == 1`, false},
+		{`"10" < 9`, false},
+		{`1 + 2.5`, 3.5},
+		{`data.qty * data.price`, 7.5},
+		{`[1, "a"] == [1.0, "a"]`, true},
+		{`data.tags == ["a", "b"]`, true},
+
+		// strings order by bytes
+		{`"B" < "a"`, true},
+		{`"abc" < "abd"`, true},
+		{`false < true`, true},
+
+		// functions
+		{`size(data.name)`, int64(7)},
+		{`size(data.tags)`, int64(2)},
+		{`size(data.meta)`, int64(2)},
+		{`size(data.payload)`, int64(2)},
+		{`data.status.startsWith("PA")`, true},
+		{`data.status.endsWith("ID")`, true},
+		{`data.status.contains("AI")`, true},
+		{`data.status.matches("^P.+D$")`, true},
+		{`data.status.matches(data.status)`, true},
+		{`data.status.lowerAscii()`, "paid"},
+		{`"MiXeD".upperAscii()`, "MIXED"},
+		{`data.name.lowerAscii()`, "Ünïcode"},
+		{`"ünï".upperAscii()`, "üNï"},
+		{`int("12") + 1`, int64(13)},
+		{`int(2.9)`, int64(2)},
+		{`int(true)`, int64(1)},
+		{`int(data.amount == 1500.5)`, int64(1)},
+		{`double("2.5")`, 2.5},
+		{`double(data.qty)`, 3.0},
+		{`string(12) + "!"`, "12!"},
+		{`string(data.payload)`, "hi"},
+		{`"source" in data.meta`, true},
+		{`1 in data.meta`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			expr, err := Compile(tt.src, testVars...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := expr.Eval(map[string]any{"action": "UPDATE", "data": testRow, "dataOld": nil})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`data.missing == 1`, "no such key: missing"},
+		{`data["missing"]`, "no such key: missing"},
+		{`data.tags[5]`, "out of range"},
+		{`data.tags["a"]`, "list index must be an int"},
+		{`data.status.x`, "no field x in string"},
+		{`data.note < 1`, "no such overload: null < int"},
+		{`data.status > 1`, "no such overload: string > int"},
+		{`data.note.startsWith("a")`, "no such overload: startsWith(null, string)"},
+		{`!data.note`, "no such overload: !null"},
+		{`data.note + 1`, "no such overload: null + int"},
+		{`-data.status`, "no such overload: -string"},
+		{`data.missing == 1 || false`, "no such key"},
+		{`data.note ? 1 : 2`, "condition must be a bool"},
+		{`1 / 0`, "division by zero"},
+		{`9223372036854775807 + 1`, "int overflow"},
+		{`-9223372036854775807 - 2`, "int overflow"},
+		{`int("x")`, "invalid syntax"},
+		{`int(1e19)`, "int overflow"},
+		{`1 in 2`, "no such overload: int in int"},
+		{`"a" - "b"`, "no such overload: string - string"},
+		{`size(1)`, "no such overload: size(int)"},
+		{`data.status.matches(data.status + "(")`, "missing closing )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			expr, err := Compile(tt.src, testVars...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = expr.Eval(map[string]any{"data": testRow})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{``, "unexpected end of expression"},
+		{`data.status ==`, "unexpected end of expression"},
+		{`data.status == "PAID" data`, `unexpected "data" at 22`},
+		{`row.status`, `undeclared reference to "row" at 0`},
+		{`(1 + 2`, `expected ")" at 6`},
+		{`[1, 2`, `expected "," at 5`},
+		{`"abc`, "unterminated string at 0"},
+		{`"\x"`, `unsupported escape \x at 1`},
+		{`1 # 2`, `unexpected character '#' at 2`},
+		{`99999999999999999999`, "invalid integer"},
+		{`true ? 1`, `expected ":" at 8`},
+		{`data.`, "unexpected end of expression"},
+		{`foo(1)`, "undeclared function foo"},
+		{`size(1, 2)`, "size expects 1 arguments, got 2"},
+		{`data.has(1)`, "has is not a method"},
+		{`startsWith(data.status)`, "startsWith is a method"},
+		{`has(data)`, "has expects a field"},
+		{`data.status.matches("(")`, "matches pattern"},
+		{`data.status.matches(1)`, "matches expects a string pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Compile(tt.src, testVars...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	expr, err := Compile(`data.status`, testVars...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := expr.Match(map[string]any{"data": testRow}); err == nil || !strings.Contains(err.Error(), "results in string, expected bool") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	expr, err := Compile(`has(data.b) && data["a"] == dataOld.c || data.b in [data.d] && data[action] == 1`, testVars...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := expr.Columns("data"), []string{"a", "b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := expr.Columns("dataOld"), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
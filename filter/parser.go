@@ -0,0 +1,422 @@
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // operator or identifier, unquoted string
+	pos  int
+}
+
+// lexer splits the expression into tokens.
+type lexer struct {
+	src string
+	pos int
+}
+
+// operators longest first, so "<=" is not read as "<".
+var operators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".", ",", "?", ":"}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case c == '"' || c == '\'':
+		s, err := l.readString(c)
+		return token{kind: tokenString, text: s, pos: start}, err
+	case c >= '0' && c <= '9':
+		return l.readNumber(), nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || unicode.IsLetter(rune(l.src[l.pos])) || unicode.IsDigit(rune(l.src[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokenIdent, text: l.src[start:l.pos], pos: start}, nil
+	}
+
+	for _, op := range operators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokenOp, text: op, pos: start}, nil
+		}
+	}
+
+	return token{}, fmt.Errorf("unexpected character %q at %d", c, start)
+}
+
+func (l *lexer) readNumber() token {
+	start := l.pos
+	kind := tokenInt
+	for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+		l.pos++
+	}
+	if l.pos+1 < len(l.src) && l.src[l.pos] == '.' && l.src[l.pos+1] >= '0' && l.src[l.pos+1] <= '9' {
+		kind = tokenFloat
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+			l.pos++
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+			l.pos++
+		}
+	}
+
+	return token{kind: kind, text: l.src[start:l.pos], pos: start}
+}
+
+// readString reads the quoted string with the escapes \\, \", \', \n, \t and \r.
+func (l *lexer) readString(quote byte) (string, error) {
+	start := l.pos
+	l.pos++
+
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return sb.String(), nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case '\\', '"', '\'':
+				sb.WriteByte(e)
+			default:
+				return "", fmt.Errorf("unsupported escape \\%c at %d", e, l.pos-1)
+			}
+			l.pos++
+		default:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			sb.WriteRune(r)
+			l.pos += size
+		}
+	}
+
+	return "", fmt.Errorf("unterminated string at %d", start)
+}
+
+// parser builds the syntax tree, the precedence is the one of CEL:
+// ?: < || < && < relations and in < + - < * / % < unary ! - < member, index and call.
+type parser struct {
+	lex  lexer
+	tok  token
+	vars []string
+}
+
+func parse(src string, vars []string) (node, error) {
+	p := &parser{lex: lexer{src: src}, vars: vars}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+
+	return n, nil
+}
+
+func (p *parser) advance() (err error) {
+	p.tok, err = p.lex.next()
+	return err
+}
+
+func (p *parser) is(op string) bool {
+	return p.tok.kind == tokenOp && p.tok.text == op
+}
+
+func (p *parser) expect(op string) error {
+	if !p.is(op) {
+		return fmt.Errorf("expected %q at %d", op, p.tok.pos)
+	}
+
+	return p.advance()
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+
+	return fmt.Errorf("unexpected %q at %d", p.tok.text, p.tok.pos)
+}
+
+func (p *parser) parseExpr() (node, error) {
+	c, err := p.parseBinary(0)
+	if err != nil || !p.is("?") {
+		return c, err
+	}
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	t, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	f, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	return &condNode{cond: c, then: t, els: f}, nil
+}
+
+// binaryLevels operators of the binary precedence levels, lowest first.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binaryOp(level int) (string, bool) {
+	for _, op := range binaryLevels[level] {
+		if p.is(op) || (op == "in" && p.tok.kind == tokenIdent && p.tok.text == "in") {
+			return op, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.binaryOp(level)
+		if !ok {
+			return left, nil
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.is("!") || p.is("-") {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &unaryNode{op: op, x: x}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.is("."):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokenIdent {
+				return nil, p.unexpected()
+			}
+			name := p.tok.text
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+
+			if p.is("(") {
+				args, err := p.parseArgs()
+				if err != nil {
+					return nil, err
+				}
+				if x, err = newCall(name, x, args); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			x = &memberNode{x: x, name: name}
+		case p.is("["):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			i, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexNode{x: x, index: i}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) parseArgs() ([]node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var args []node
+	for !p.is(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return args, p.advance()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+
+	switch tok.kind {
+	case tokenInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s at %d", tok.text, tok.pos)
+		}
+		return &literalNode{value: n}, p.advance()
+	case tokenFloat:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s at %d", tok.text, tok.pos)
+		}
+		return &literalNode{value: f}, p.advance()
+	case tokenString:
+		return &literalNode{value: tok.text}, p.advance()
+	case tokenIdent:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+
+		if p.is("(") {
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			return newCall(tok.text, nil, args)
+		}
+
+		if !slices.Contains(p.vars, tok.text) {
+			return nil, fmt.Errorf("undeclared reference to %q at %d, expected one of %s", tok.text, tok.pos, strings.Join(p.vars, ", "))
+		}
+
+		return &identNode{name: tok.text}, nil
+	case tokenOp:
+		switch tok.text {
+		case "(":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			list := &listNode{}
+			for !p.is("]") {
+				if len(list.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, p.advance()
+		}
+	}
+
+	return nil, p.unexpected()
+}
@@ -0,0 +1,254 @@
+package filter
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ColumnType kind of the values of the table column in the SQL translation.
+// A literal is compared only with the columns of its kind, so the server
+// compares the values the same way as the service.
+type ColumnType int
+
+// kind of column type.
+const (
+	// ColumnOther columns which are only compared with null.
+	ColumnOther ColumnType = iota
+	ColumnBool
+	ColumnNumber
+	ColumnString
+)
+
+// SQL translates the expression into the WHERE clause of a publication row
+// filter. rowVar is the variable which holds the table row, e.g. data, and
+// columns are the types of the columns of the table. It reports false when
+// the expression can't be translated: only the comparisons of the columns
+// with the literals of their type, in with a list of literals, startsWith,
+// contains, !, && and || are supported.
+//
+// SQL NULL stands for the errors of the evaluation, e.g. null < 1, and the
+// comparisons which are false for null in the service are FALSE in SQL, so
+// the row filter keeps the same rows under !.
+func (e *Expression) SQL(rowVar string, columns map[string]ColumnType) (string, bool) {
+	t := sqlTranslator{rowVar: rowVar, columns: columns}
+
+	return t.bool(e.root)
+}
+
+type sqlTranslator struct {
+	rowVar  string
+	columns map[string]ColumnType
+}
+
+// bool translates the node with a bool result.
+func (t sqlTranslator) bool(n node) (string, bool) {
+	switch n := n.(type) {
+	case *literalNode:
+		if b, ok := n.value.(bool); ok {
+			return strings.ToUpper(strconv.FormatBool(b)), true
+		}
+	case *unaryNode:
+		if x, ok := t.bool(n.x); ok && n.op == "!" {
+			return "NOT (" + x + ")", true
+		}
+	case *binaryNode:
+		return t.binary(n)
+	case *callNode:
+		return t.call(n)
+	case *memberNode, *indexNode:
+		if column, typ, ok := t.column(n); ok && typ == ColumnBool {
+			return column, true
+		}
+	}
+
+	return "", false
+}
+
+func (t sqlTranslator) binary(n *binaryNode) (string, bool) {
+	switch n.op {
+	case "&&", "||":
+		left, ok1 := t.bool(n.left)
+		right, ok2 := t.bool(n.right)
+		if !ok1 || !ok2 {
+			return "", false
+		}
+		op := " AND "
+		if n.op == "||" {
+			op = " OR "
+		}
+		return "(" + left + ")" + op + "(" + right + ")", true
+	case "in":
+		column, typ, ok := t.column(n.left)
+		list, isList := n.right.(*listNode)
+		if !ok || !isList || len(list.items) == 0 {
+			return "", false
+		}
+		values := make([]string, len(list.items))
+		for i, item := range list.items {
+			v, ok := literalValue(item)
+			if !ok || v == nil {
+				return "", false
+			}
+			if values[i], ok = sqlLiteral(v, typ); !ok {
+				return "", false
+			}
+		}
+		// null in [...] is false
+		return "COALESCE(" + column + " IN (" + strings.Join(values, ", ") + "), FALSE)", true
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return "", false
+	}
+
+	left, right := n.left, n.right
+	op := n.op
+	if _, _, ok := t.column(left); !ok {
+		// literal == column
+		left, right = right, left
+		op = map[string]string{"==": "==", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}[op]
+	}
+
+	column, typ, ok := t.column(left)
+	if !ok {
+		return "", false
+	}
+	v, ok := literalValue(right)
+	if !ok {
+		return "", false
+	}
+
+	if v == nil {
+		switch op {
+		case "==":
+			return column + " IS NULL", true
+		case "!=":
+			return column + " IS NOT NULL", true
+		}
+		return "", false
+	}
+
+	value, ok := sqlLiteral(v, typ)
+	if !ok {
+		return "", false
+	}
+
+	switch op {
+	case "==":
+		// null == "x" is false
+		return "COALESCE(" + column + " = " + value + ", FALSE)", true
+	case "!=":
+		// null != "x" is true
+		return "(" + column + " <> " + value + " OR " + column + " IS NULL)", true
+	}
+
+	if typ == ColumnString {
+		// strings are ordered by their bytes
+		value += ` COLLATE "C"`
+	}
+
+	return column + " " + op + " " + value, true
+}
+
+func (t sqlTranslator) call(n *callNode) (string, bool) {
+	if n.target == nil || len(n.args) != 1 {
+		return "", false
+	}
+
+	column, typ, ok := t.column(n.target)
+	if !ok || typ != ColumnString {
+		return "", false
+	}
+	v, ok := literalValue(n.args[0])
+	if !ok {
+		return "", false
+	}
+	value, ok := sqlLiteral(v, ColumnString)
+	if !ok {
+		return "", false
+	}
+
+	switch n.name {
+	case "startsWith":
+		return "starts_with(" + column + ", " + value + ")", true
+	case "contains":
+		return "strpos(" + column + ", " + value + ") > 0", true
+	}
+
+	return "", false
+}
+
+// column returns the quoted column of the row variable, e.g. data.status,
+// and its type. The columns which are not in the table can't be translated.
+func (t sqlTranslator) column(n node) (string, ColumnType, bool) {
+	name, ok := columnName(n, t.rowVar)
+	if !ok {
+		return "", ColumnOther, false
+	}
+
+	typ, ok := t.columns[name]
+	if !ok {
+		return "", ColumnOther, false
+	}
+
+	return pgx.Identifier{name}.Sanitize(), typ, true
+}
+
+// literalValue returns the value of the literal node, negative numbers included.
+func literalValue(n node) (any, bool) {
+	if u, ok := n.(*unaryNode); ok && u.op == "-" {
+		v, ok := literalValue(u.x)
+		switch v := v.(type) {
+		case int64:
+			return -v, ok
+		case float64:
+			return -v, ok
+		}
+		return nil, false
+	}
+
+	lit, ok := n.(*literalNode)
+	if !ok {
+		return nil, false
+	}
+
+	switch lit.value.(type) {
+	case nil, bool, int64, float64, string:
+		return lit.value, true
+	}
+
+	return nil, false
+}
+
+// sqlLiteral returns the SQL literal of the value compared with the column
+// of the type, it reports false when the value is of another kind. Doubles
+// are translated only when their decimal form is exact.
+func sqlLiteral(v any, typ ColumnType) (string, bool) {
+	switch v := v.(type) {
+	case bool:
+		if typ == ColumnBool {
+			return strings.ToUpper(strconv.FormatBool(v)), true
+		}
+	case int64:
+		if typ == ColumnNumber {
+			return strconv.FormatInt(v, 10), true
+		}
+	case float64:
+		if typ == ColumnNumber {
+			s := strconv.FormatFloat(v, 'f', -1, 64)
+			exact, ok1 := new(big.Rat).SetString(s)
+			r := new(big.Rat).SetFloat64(v)
+			if ok1 && r != nil && exact.Cmp(r) == 0 {
+				return s, true
+			}
+		}
+	case string:
+		if typ == ColumnString {
+			return "'" + strings.ReplaceAll(v, "'", "''") + "'", true
+		}
+	}
+
+	return "", false
+}
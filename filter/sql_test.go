@@ -0,0 +1,485 @@
+package filter
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// testColumns types of the columns of the orders table.
+var testColumns = map[string]ColumnType{
+	"id":     ColumnNumber,
+	"status": ColumnString,
+	"amount": ColumnNumber,
+	"qty":    ColumnNumber,
+	"active": ColumnBool,
+	"note":   ColumnString,
+	"tags":   ColumnOther,
+}
+
+func TestSQL(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`data.status == "PAID"`, `COALESCE("status" = 'PAID', FALSE)`},
+		{`"PAID" == data.status`, `COALESCE("status" = 'PAID', FALSE)`},
+		{`data.status != "it's"`, `("status" <> 'it''s' OR "status" IS NULL)`},
+		{`data.amount > 1000`, `"amount" > 1000`},
+		{`1000 > data.amount`, `"amount" < 1000`},
+		{`data.amount >= -10.25`, `"amount" >= -10.25`},
+		{`data.qty <= 3`, `"qty" <= 3`},
+		{`data.status < "b"`, `"status" < 'b' COLLATE "C"`},
+		{`data.note == null`, `"note" IS NULL`},
+		{`null != data.tags`, `"tags" IS NOT NULL`},
+		{`data.status in ["PAID", "NEW"]`, `COALESCE("status" IN ('PAID', 'NEW'), FALSE)`},
+		{`data.active`, `"active"`},
+		{`data.active == false`, `COALESCE("active" = FALSE, FALSE)`},
+		{`!data.active`, `NOT ("active")`},
+		{`data.status.startsWith("PA")`, `starts_with("status", 'PA')`},
+		{`data.note.contains("x")`, `strpos("note", 'x') > 0`},
+		{`data["status"] == "PAID"`, `COALESCE("status" = 'PAID', FALSE)`},
+		{`true`, `TRUE`},
+		{`data.status == "PAID" && !(data.amount > 1000 || data.active)`,
+			`(COALESCE("status" = 'PAID', FALSE)) AND (NOT (("amount" > 1000) OR ("active")))`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			expr, err := Compile(tt.src, testVars...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := expr.SQL("data", testColumns)
+			if !ok {
+				t.Fatal("not translated")
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLNotTranslated(t *testing.T) {
+	for _, src := range []string{
+		`data.status == 10`,        // number with a text column
+		`data.amount == "10"`,      // string with a numeric column
+		`data.active == 1`,         // number with a bool column
+		`data.tags == "a"`,         // column of another type
+		`data.tags`,                // not a bool column
+		`data.status`,              // not a bool column
+		`data.amount == 0.1`,       // inexact double
+		`data.unknown == 1`,        // not a column of the table
+		`dataOld.status == "PAID"`, // not the row variable
+		`data.status == data.note`, // two columns
+		`data.status in []`,        // empty list
+		`data.status in ["a", null]`,
+		`data.status < null`,
+		`data.status.endsWith("x")`,
+		`data.amount.startsWith("1")`,
+		`data.status.startsWith(data.note)`,
+		`size(data.status) > 1`,
+		`has(data.status)`,
+		`data.active ? true : false`,
+		`action == "INSERT"`,
+		`data.qty + 1 > 2`,
+		`data.status == "PAID" && data.status.matches("x")`,
+	} {
+		t.Run(src, func(t *testing.T) {
+			expr, err := Compile(src, testVars...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, ok := expr.SQL("data", testColumns); ok {
+				t.Errorf("translated into %s", got)
+			}
+		})
+	}
+}
+
+// TestSQLAgrees checks that the publication row filter keeps the same rows
+// as the service, the translated SQL is evaluated with three-valued logic.
+func TestSQLAgrees(t *testing.T) {
+	rows := []map[string]any{
+		{"id": int32(1), "status": "PAID", "amount": "1500.00", "qty": int64(-3), "active": true, "note": "xyz", "tags": []any{"a"}},
+		{"id": int32(2), "status": "NEW", "amount": "10.50", "qty": int64(1), "active": false, "note": nil, "tags": nil},
+		{"id": int32(3), "status": nil, "amount": nil, "qty": nil, "active": nil, "note": nil, "tags": nil},
+		{"id": int32(4), "status": "Bar", "amount": "1000", "qty": int64(0), "active": true, "note": "", "tags": []any{}},
+		{"id": int32(5), "status": "abc", "amount": "-10.25", "qty": int64(3), "active": false, "note": "x", "tags": nil},
+	}
+
+	for _, src := range []string{
+		`data.status == "PAID"`,
+		`!(data.status == "PAID")`,
+		`data.status != "PAID"`,
+		`!(data.status != "PAID")`,
+		`data.status in ["PAID", "NEW"]`,
+		`!(data.status in ["PAID", "NEW"])`,
+		`data.amount > 1000`,
+		`!(data.amount > 1000)`,
+		`data.amount >= 1000`,
+		`data.amount == 1000`,
+		`data.amount >= -10.25`,
+		`1000 < data.amount`,
+		`data.qty == -3`,
+		`data.qty in [0, 3]`,
+		`data.active`,
+		`!data.active`,
+		`data.active == false`,
+		`data.active != true`,
+		`data.note == null`,
+		`data.note != null`,
+		`!(data.note == null)`,
+		`data.status.startsWith("PA")`,
+		`!data.status.startsWith("PA")`,
+		`data.note.contains("x")`,
+		`!data.note.contains("x")`,
+		`data.status < "b"`,
+		`data.status >= "B"`,
+		`data["status"] == "PAID"`,
+		`data.status == "PAID" && data.amount > 1000`,
+		`data.status == "PAID" || !data.active`,
+		`!(data.status == "PAID" || data.amount > 1000)`,
+		`!(data.amount > 100 && data.note == "x")`,
+		`data.tags == null || data.active`,
+		`true`,
+		`!false`,
+	} {
+		expr, err := Compile(src, testVars...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		where, ok := expr.SQL("data", testColumns)
+		if !ok {
+			t.Fatalf("%s: not translated", src)
+		}
+
+		for _, row := range rows {
+			want, _ := expr.Match(map[string]any{"data": row})
+
+			result, err := evalSQL(where, row)
+			if err != nil {
+				t.Fatalf("%s: %v", where, err)
+			}
+			if got := result == true; got != want {
+				t.Errorf("%s on row %v: service %t, WHERE (%s) is %v", src, row["id"], want, where, result)
+			}
+		}
+	}
+}
+
+// evalSQL evaluates the WHERE clause of the translated expression over the
+// row, it returns nil for NULL.
+func evalSQL(where string, row map[string]any) (any, error) {
+	tokens, err := sqlTokens(where)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &sqlEvaluator{tokens: tokens, row: row}
+	v, err := e.or()
+	if err != nil {
+		return nil, err
+	}
+	if e.pos != len(e.tokens) {
+		return nil, fmt.Errorf("unexpected %q", e.tokens[e.pos])
+	}
+
+	return v, nil
+}
+
+// sqlTokens splits the SQL into tokens, quoted identifiers keep the double
+// quotes and strings the single quotes.
+func sqlTokens(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ':
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier in %s", s)
+			}
+			tokens = append(tokens, s[i:i+end+2])
+			i += end + 2
+		case c == '\'':
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		case strings.HasPrefix(s[i:], "<>"), strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("()=<>,", rune(c)):
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case c == '-' || c == '.' || unicode.IsDigit(rune(c)) || unicode.IsLetter(rune(c)) || c == '_':
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || s[j] == '_' || unicode.IsDigit(rune(s[j])) || unicode.IsLetter(rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q in %s", c, s)
+		}
+	}
+
+	return tokens, nil
+}
+
+// sqlEvaluator evaluates the SQL of the translator, the values are nil for
+// NULL, bool, *big.Rat and string.
+type sqlEvaluator struct {
+	tokens []string
+	pos    int
+	row    map[string]any
+}
+
+func (e *sqlEvaluator) peek() string {
+	if e.pos < len(e.tokens) {
+		return e.tokens[e.pos]
+	}
+	return ""
+}
+
+func (e *sqlEvaluator) accept(tok string) bool {
+	if e.peek() == tok {
+		e.pos++
+		return true
+	}
+	return false
+}
+
+func (e *sqlEvaluator) expect(tok string) error {
+	if !e.accept(tok) {
+		return fmt.Errorf("expected %q, got %q", tok, e.peek())
+	}
+	return nil
+}
+
+func (e *sqlEvaluator) or() (any, error) {
+	left, err := e.and()
+	for err == nil && e.accept("OR") {
+		var right any
+		if right, err = e.and(); err == nil {
+			left = or3(left, right)
+		}
+	}
+	return left, err
+}
+
+func (e *sqlEvaluator) and() (any, error) {
+	left, err := e.not()
+	for err == nil && e.accept("AND") {
+		var right any
+		if right, err = e.not(); err == nil {
+			left = not3(or3(not3(left), not3(right)))
+		}
+	}
+	return left, err
+}
+
+func (e *sqlEvaluator) not() (any, error) {
+	if e.accept("NOT") {
+		x, err := e.not()
+		return not3(x), err
+	}
+	return e.predicate()
+}
+
+func (e *sqlEvaluator) predicate() (any, error) {
+	x, err := e.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op := e.peek(); op {
+	case "IS":
+		e.pos++
+		negate := e.accept("NOT")
+		if err := e.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return (x == nil) != negate, nil
+	case "IN":
+		e.pos++
+		if err := e.expect("("); err != nil {
+			return nil, err
+		}
+		var result any = false
+		for {
+			item, err := e.primary()
+			if err != nil {
+				return nil, err
+			}
+			result = or3(result, cmp3("=", x, item))
+			if !e.accept(",") {
+				break
+			}
+		}
+		return result, e.expect(")")
+	case "=", "<>", "<", "<=", ">", ">=":
+		e.pos++
+		y, err := e.primary()
+		if err != nil {
+			return nil, err
+		}
+		if e.accept("COLLATE") {
+			if err := e.expect(`"C"`); err != nil {
+				return nil, err
+			}
+		}
+		return cmp3(op, x, y), nil
+	}
+
+	return x, nil
+}
+
+func (e *sqlEvaluator) primary() (any, error) {
+	tok := e.peek()
+	e.pos++
+
+	switch {
+	case tok == "(":
+		x, err := e.or()
+		if err != nil {
+			return nil, err
+		}
+		return x, e.expect(")")
+	case tok == "COALESCE" || tok == "starts_with" || tok == "strpos":
+		if err := e.expect("("); err != nil {
+			return nil, err
+		}
+		x, err := e.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := e.expect(","); err != nil {
+			return nil, err
+		}
+		y, err := e.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := e.expect(")"); err != nil {
+			return nil, err
+		}
+		switch {
+		case tok == "COALESCE" && x == nil:
+			return y, nil
+		case tok == "COALESCE":
+			return x, nil
+		case x == nil || y == nil:
+			return nil, nil
+		case tok == "starts_with":
+			return strings.HasPrefix(x.(string), y.(string)), nil
+		default:
+			return big.NewRat(int64(strings.Index(x.(string), y.(string))+1), 1), nil
+		}
+	case tok == "TRUE" || tok == "FALSE":
+		return tok == "TRUE", nil
+	case tok == "NULL":
+		return nil, nil
+	case strings.HasPrefix(tok, `"`):
+		name := strings.Trim(tok, `"`)
+		return sqlValue(e.row[name], testColumns[name])
+	case strings.HasPrefix(tok, "'"):
+		return strings.ReplaceAll(tok[1:len(tok)-1], "''", "'"), nil
+	}
+
+	if r, ok := new(big.Rat).SetString(tok); ok {
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %q", tok)
+}
+
+// sqlValue returns the value of the column as the server sees it.
+func sqlValue(v any, typ ColumnType) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch typ {
+	case ColumnNumber:
+		if r, ok := toRat(normalize(v)); ok {
+			return r, nil
+		}
+	case ColumnBool, ColumnString:
+		return v, nil
+	case ColumnOther:
+		return "other", nil
+	}
+
+	return nil, fmt.Errorf("%v is not a value of the column type %d", v, typ)
+}
+
+func not3(x any) any {
+	if x == nil {
+		return nil
+	}
+	return !x.(bool)
+}
+
+func or3(x, y any) any {
+	if x == true || y == true {
+		return true
+	}
+	if x == nil || y == nil {
+		return nil
+	}
+	return false
+}
+
+func cmp3(op string, x, y any) any {
+	if x == nil || y == nil {
+		return nil
+	}
+
+	var c int
+	switch x := x.(type) {
+	case *big.Rat:
+		c = x.Cmp(y.(*big.Rat))
+	case string:
+		c = strings.Compare(x, y.(string))
+	case bool:
+		switch y := y.(bool); {
+		case x == y:
+		case y:
+			c = -1
+		default:
+			c = 1
+		}
+	}
+
+	switch op {
+	case "=":
+		return c == 0
+	case "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
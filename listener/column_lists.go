@@ -0,0 +1,218 @@
+package listener
+
+import (
+	"context"
+	"ditto/models"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// pgColumnListsVersion first version with the publication column lists.
+const pgColumnListsVersion = 150000
+
+// tableColumnsSQL returns the columns of the table, %s filters out the
+// generated columns, they are not replicated.
+const tableColumnsSQL = `
+SELECT a.attname
+FROM pg_attribute a
+WHERE a.attrelid = $1::text::regclass AND a.attnum > 0 AND NOT a.attisdropped%s
+ORDER BY a.attnum`
+
+// replicaIdentityColumnsSQL returns the columns of the replica identity, all
+// columns for REPLICA IDENTITY FULL.
+const replicaIdentityColumnsSQL = `
+SELECT a.attname
+FROM pg_class c
+JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped%s
+WHERE c.oid = $1::text::regclass AND (
+	c.relreplident = 'f' OR EXISTS (
+		SELECT 1 FROM pg_index i
+		WHERE i.indrelid = c.oid AND a.attnum = ANY(i.indkey::int2[])
+			AND ((c.relreplident = 'd' AND i.indisprimary) OR (c.relreplident = 'i' AND i.indisreplident))))
+ORDER BY a.attnum`
+
+// publicationColumnListsSQL returns the column lists of the publication tables,
+// tables without a column list are left out.
+const publicationColumnListsSQL = `
+SELECT c.relname, array_agg(a.attname ORDER BY a.attnum)
+FROM pg_publication p
+JOIN pg_publication_rel pr ON pr.prpubid = p.oid
+JOIN pg_class c ON c.oid = pr.prrelid
+JOIN pg_attribute a ON a.attrelid = pr.prrelid AND a.attnum = ANY(pr.prattrs::int2[])
+WHERE p.pubname = $1 AND pr.prattrs IS NOT NULL
+GROUP BY c.relname`
+
+// resolveColumnLists returns the published columns of the tables with
+// columns or exclude_columns in the watch list. The replica identity columns
+// can't be left out, UPDATE and DELETE are not published without them.
+func (l *listener) resolveColumnLists(conn *pgx.Conn, cfg Config) (map[string][]string, error) {
+	lists := make(map[string][]string)
+	notGenerated := l.notGeneratedColumns()
+
+	for table, w := range cfg.WatchList {
+		if !w.HasColumnList() {
+			continue
+		}
+
+		columns, err := queryNames(conn, fmt.Sprintf(tableColumnsSQL, notGenerated), table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get columns of %s: %w", table, err)
+		}
+
+		identity, err := queryNames(conn, fmt.Sprintf(replicaIdentityColumnsSQL, notGenerated), table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replica identity of %s: %w", table, err)
+		}
+
+		columns, err = publishedColumns(w, columns, identity)
+		if err != nil {
+			return nil, fmt.Errorf("watch_list %s: %w", table, err)
+		}
+		lists[table] = columns
+
+		l.logger.Infof("table %s publishes columns: %s", table, strings.Join(columns, ", "))
+	}
+
+	if len(lists) > 0 && l.version < pgColumnListsVersion {
+		l.logger.Infoln("publication column lists require PostgreSQL 15, columns are filtered by ditto")
+		return nil, nil
+	}
+
+	return lists, nil
+}
+
+// publishedColumns returns the columns of the table published by the watch
+// config, in the order of the table.
+func publishedColumns(w models.WatchConfig, columns, identity []string) ([]string, error) {
+	for _, name := range slices.Concat(w.Columns, w.ExcludeColumns) {
+		if !slices.Contains(columns, name) {
+			return nil, fmt.Errorf("column %s does not exist", name)
+		}
+	}
+
+	for _, name := range identity {
+		if !w.PublishesColumn(name) {
+			return nil, fmt.Errorf("replica identity column %s must be published", name)
+		}
+	}
+
+	return slices.DeleteFunc(slices.Clone(columns), func(name string) bool { return !w.PublishesColumn(name) }), nil
+}
+
+// replicaIdentitySQL returns the replica identity of the table: 'd' for the
+// primary key, 'i' for an index, 'f' for all columns and 'n' for none.
+const replicaIdentitySQL = `SELECT relreplident::text FROM pg_class WHERE oid = $1::text::regclass`
+
+// checkColumnReferences fails on the columns named by the watch list which
+// the tables don't replicate, and warns about the options which have no
+// effect under the replica identity of the table.
+func (l *listener) checkColumnReferences(conn *pgx.Conn, cfg Config) error {
+	notGenerated := l.notGeneratedColumns()
+
+	for _, table := range slices.Sorted(maps.Keys(cfg.WatchList)) {
+		w := cfg.WatchList[table]
+
+		columns, err := queryNames(conn, fmt.Sprintf(tableColumnsSQL, notGenerated), table)
+		if err != nil {
+			return fmt.Errorf("failed to get columns of %s: %w", table, err)
+		}
+
+		if err := w.ValidateColumns(columns); err != nil {
+			return fmt.Errorf("watch_list %s: %w", table, err)
+		}
+
+		if !w.SkipNoopUpdates {
+			continue
+		}
+
+		var identity string
+		if err := conn.QueryRow(context.Background(), replicaIdentitySQL, table).Scan(&identity); err != nil {
+			return fmt.Errorf("failed to get replica identity of %s: %w", table, err)
+		}
+		if identity != "f" {
+			l.logger.Warnf("skip_noop_updates of %s has no effect, the table needs REPLICA IDENTITY FULL", table)
+		}
+	}
+
+	return nil
+}
+
+// notGeneratedColumns returns the condition of tableColumnsSQL and
+// replicaIdentityColumnsSQL which filters out the generated columns.
+func (l *listener) notGeneratedColumns() string {
+	// attgenerated appeared in PostgreSQL 12
+	if l.version < 120000 {
+		return ""
+	}
+
+	return " AND a.attgenerated = ''"
+}
+
+// getCurrentPublicationColumnLists returns the column lists of the publication.
+func (l *listener) getCurrentPublicationColumnLists(conn *pgx.Conn, publicationName string) (map[string][]string, error) {
+	lists := make(map[string][]string)
+	if l.version < pgColumnListsVersion {
+		return lists, nil
+	}
+
+	rows, err := conn.Query(context.Background(), publicationColumnListsSQL, publicationName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		var columns []string
+		if err := rows.Scan(&table, &columns); err != nil {
+			return nil, err
+		}
+		lists[table] = columns
+	}
+
+	return lists, rows.Err()
+}
+
+// columnListsMatch reports whether the publication has the column lists of the tables.
+func columnListsMatch(tables []string, expected, current map[string][]string) bool {
+	for _, table := range tables {
+		if !slices.Equal(expected[table], current[table]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// publicationTable returns the table of the CREATE PUBLICATION statement,
+// with its column list and row filter.
+func publicationTable(table string, opts publicationOptions) string {
+	spec := table
+
+	if columns := opts.columns[table]; len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, name := range columns {
+			quoted[i] = pgx.Identifier{name}.Sanitize()
+		}
+		spec += " (" + strings.Join(quoted, ", ") + ")"
+	}
+
+	if where, ok := opts.rowFilters[table]; ok {
+		spec += " WHERE (" + where + ")"
+	}
+
+	return spec
+}
+
+func queryNames(conn *pgx.Conn, sql string, args ...any) ([]string, error) {
+	rows, err := conn.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
@@ -0,0 +1,104 @@
+package listener
+
+import (
+	"ditto/models"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPublishedColumns(t *testing.T) {
+	columns := []string{"id", "tenant_id", "email", "note"}
+
+	tests := []struct {
+		name     string
+		cfg      models.WatchConfig
+		identity []string
+		want     []string
+		err      string
+	}{
+		{name: "columns", cfg: models.WatchConfig{Columns: []string{"note", "id"}}, identity: []string{"id"}, want: []string{"id", "note"}},
+		{name: "exclude", cfg: models.WatchConfig{ExcludeColumns: []string{"email"}}, identity: []string{"id"}, want: []string{"id", "tenant_id", "note"}},
+		{name: "composite identity", cfg: models.WatchConfig{Columns: []string{"id", "tenant_id"}}, identity: []string{"id", "tenant_id"}, want: []string{"id", "tenant_id"}},
+		{name: "unknown column", cfg: models.WatchConfig{Columns: []string{"id", "emial"}}, identity: []string{"id"}, err: "column emial does not exist"},
+		{name: "unknown excluded column", cfg: models.WatchConfig{ExcludeColumns: []string{"emial"}}, err: "column emial does not exist"},
+		{name: "identity left out", cfg: models.WatchConfig{Columns: []string{"id", "email"}}, identity: []string{"id", "tenant_id"}, err: "replica identity column tenant_id must be published"},
+		{name: "identity excluded", cfg: models.WatchConfig{ExcludeColumns: []string{"email"}}, identity: columns, err: "replica identity column email must be published"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := publishedColumns(tt.cfg, columns, tt.identity)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if len(columns) != 4 {
+		t.Errorf("the table columns changed to %v", columns)
+	}
+}
+
+func TestColumnListsMatch(t *testing.T) {
+	expected := map[string][]string{"orders": {"id", "total"}}
+
+	tests := []struct {
+		name    string
+		current map[string][]string
+		want    bool
+	}{
+		{name: "same", current: map[string][]string{"orders": {"id", "total"}}, want: true},
+		{name: "other tables", current: map[string][]string{"orders": {"id", "total"}, "archive": {"id"}}, want: true},
+		{name: "other order", current: map[string][]string{"orders": {"total", "id"}}},
+		{name: "missing list", current: map[string][]string{}},
+		{name: "extra column", current: map[string][]string{"orders": {"id", "total", "email"}}},
+		{name: "list removed", current: map[string][]string{"orders": {"id", "total"}, "users": {"id"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := columnListsMatch([]string{"orders", "users"}, expected, tt.current); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicationTable(t *testing.T) {
+	opts := publicationOptions{
+		columns: map[string][]string{
+			"orders": {"id", "Total", `we"ird`},
+			"users":  {"id"},
+		},
+		rowFilters: map[string]string{
+			"orders":   `"status" = 'PAID'`,
+			"payments": `"amount" > 100`,
+		},
+	}
+
+	tests := []struct {
+		table string
+		want  string
+	}{
+		{"orders", `orders ("id", "Total", "we""ird") WHERE ("status" = 'PAID')`},
+		{"users", `users ("id")`},
+		{"payments", `payments WHERE ("amount" > 100)`},
+		{"events", `events`},
+	}
+
+	for _, tt := range tests {
+		if got := publicationTable(tt.table, opts); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+}
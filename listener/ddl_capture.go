@@ -0,0 +1,103 @@
+package listener
+
+import (
+	"context"
+	"ditto/models"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DDLCaptureConfig config of the DDL capture through the event trigger.
+type DDLCaptureConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Topic        string `yaml:"topic"`         // topic for DDL events, "ddl" by default
+	IncludeQuery bool   `yaml:"include_query"` // publish the statement text with the passwords redacted
+}
+
+// ddlCaptureSQL creates the Ditto event trigger, it emits every DDL statement
+// as a transactional logical decoding message, so it is received in order with the data.
+//
+// The query is redacted before it is written to the WAL: the literals after
+// PASSWORD (roles, OPTIONS of user mappings and servers) and the passwords of
+// connection strings are masked. A query with a password in a form which is
+// not recognized, dollar quoted or a Unicode escape string, is left out.
+func ddlCaptureSQL(includeQuery bool) string {
+	return fmt.Sprintf(`
+CREATE OR REPLACE FUNCTION public.ditto_capture_ddl() RETURNS event_trigger
+LANGUAGE plpgsql AS $$
+DECLARE
+	include_query CONSTANT boolean := %t;
+	objects jsonb;
+	query text;
+BEGIN
+	IF TG_EVENT = 'sql_drop' THEN
+		SELECT COALESCE(jsonb_agg(jsonb_build_object(
+			'objectType', object_type,
+			'schema', schema_name,
+			'identity', object_identity)), '[]'::jsonb)
+		INTO objects
+		FROM pg_event_trigger_dropped_objects()
+		WHERE original;
+	ELSE
+		SELECT COALESCE(jsonb_agg(jsonb_build_object(
+			'objectType', object_type,
+			'schema', schema_name,
+			'identity', object_identity,
+			'commandTag', command_tag)), '[]'::jsonb)
+		INTO objects
+		FROM pg_event_trigger_ddl_commands();
+	END IF;
+
+	IF jsonb_array_length(objects) = 0 THEN
+		RETURN;
+	END IF;
+
+	IF include_query THEN
+		query := regexp_replace(current_query(),
+			$re$(password\s+)([eE]'(?:[^'\\]|''|\\.)*'|'(?:[^']|'')*')$re$, '\1''***''', 'gi');
+		query := regexp_replace(query,
+			$re$(password\s*=\s*)(''[^']*''|[^\s']+)$re$, '\1***', 'gi');
+		IF query ~* $re$password\s+(\$|u&)$re$ THEN
+			query := NULL;
+		END IF;
+	END IF;
+
+	PERFORM pg_logical_emit_message(true, '%s', jsonb_strip_nulls(jsonb_build_object(
+		'event', TG_EVENT,
+		'tag', TG_TAG,
+		'query', query,
+		'objects', objects))::text);
+END;
+$$;
+
+DROP EVENT TRIGGER IF EXISTS ditto_ddl_command_end;
+CREATE EVENT TRIGGER ditto_ddl_command_end ON ddl_command_end
+	EXECUTE FUNCTION public.ditto_capture_ddl();
+
+DROP EVENT TRIGGER IF EXISTS ditto_sql_drop;
+CREATE EVENT TRIGGER ditto_sql_drop ON sql_drop
+	EXECUTE FUNCTION public.ditto_capture_ddl();
+`, includeQuery, models.DDLMessagePrefix)
+}
+
+// installDDLCapture creates or replaces the Ditto event trigger, it requires superuser.
+func (l *listener) installDDLCapture(conn *pgx.Conn, cfg DDLCaptureConfig) error {
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(context.Background(), ddlCaptureSQL(cfg.IncludeQuery)); err != nil {
+		return fmt.Errorf("failed to install ddl event trigger: %w", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return err
+	}
+
+	l.logger.Infoln("ddl event trigger is installed")
+
+	return nil
+}
@@ -3,13 +3,18 @@ package listener
 import (
 	"context"
 	"ditto/listener/parsers"
+	"ditto/listener/serializers"
 	"ditto/models"
+	"ditto/script"
 	"ditto/shared/common"
 	"ditto/shared/component/pgxc"
 	"ditto/shared/component/redisc"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -32,30 +37,67 @@ type Config struct {
 	PrefixWatchList     string                        `yaml:"prefix_watch_list"`
 	PublicationStrategy string                        `yaml:"publication_strategy"` // "single" or "multiple"
 	PublicationPrefix   string                        `yaml:"publication_prefix"`   // prefix for multiple publications
+	DDLCapture          DDLCaptureConfig              `yaml:"ddl_capture"`
+	TransactionMarkers  TransactionMarkersConfig      `yaml:"transaction_markers"`
+	Output              serializers.Config            `yaml:"output"`
+	Scripting           script.Limits                 `yaml:"scripting"`
+	DecodeOptions       models.DecodeOptions          `yaml:",inline"`
+}
+
+// Validate checks the config.
+func (c Config) Validate() error {
+	if err := c.DecodeOptions.Validate(); err != nil {
+		return err
+	}
+
+	for table, w := range c.WatchList {
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("watch_list %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// TransactionMarkersConfig config of the BEGIN and COMMIT marker events.
+type TransactionMarkersConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Topic   string `yaml:"topic"` // topic for marker events, "transaction" by default
 }
 
 type listener struct {
-	conn      *pgconn.PgConn
-	sysident  pglogrepl.IdentifySystemResult
-	logger    sctx.Logger
-	parser    Parser
-	mu        sync.RWMutex
-	lsn       pglogrepl.LSN
-	publisher redisc.RedisComp
-	dbDsn     string
+	conn       *pgconn.PgConn
+	pgComp     pgxc.PgxComp
+	sysident   pglogrepl.IdentifySystemResult
+	logger     sctx.Logger
+	parser     Parser
+	mu         sync.RWMutex
+	lsn        pglogrepl.LSN
+	publisher  redisc.RedisComp
+	serializer serializers.Serializer
+	// tableSerializers serializers of the tables with their own encoding.
+	tableSerializers map[string]serializers.Serializer
+	dbDsn            string
+	version          int
+	// tableScripts Lua scripts of the tables.
+	tableScripts map[string]*script.Script
+	// outbox deletes the published rows of the outbox tables.
+	outbox *outboxCleaner
 }
 
 func New(sc sctx.ServiceContext) *listener {
+	pgComp := sc.MustGet(common.KeyCompPgx).(pgxc.PgxComp)
 	conn := sc.MustGet(common.KeyCompPgx).(pgxc.PgxComp).GetConn()
 	sysident := sc.MustGet(common.KeyCompPgx).(pgxc.PgxComp).GetIdentity()
 	lsn := sc.MustGet(common.KeyCompPgx).(pgxc.PgxComp).GetLsn()
 	publisher := sc.MustGet(common.KeyCompRedis).(redisc.RedisComp)
 	logger := sc.Logger("global")
 	dbDsn := sc.MustGet(common.KeyCompPgx).(pgxc.PgxComp).GetDsn()
+	version := sc.MustGet(common.KeyCompPgx).(pgxc.PgxComp).GetServerVersion()
 
 	parser := parsers.NewBinaryParser(binary.BigEndian)
 
-	return &listener{conn: conn, sysident: sysident, lsn: lsn, logger: logger, parser: parser, publisher: publisher, dbDsn: dbDsn}
+	return &listener{conn: conn, pgComp: pgComp, sysident: sysident, lsn: lsn, logger: logger, parser: parser, publisher: publisher, dbDsn: dbDsn, version: version}
 }
 
 func (l *listener) Process() error {
@@ -73,11 +115,42 @@ func (l *listener) Process() error {
 		return err
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := l.initSerializers(cfg); err != nil {
+		return err
+	}
+
+	if err := l.initScripts(cfg); err != nil {
+		return err
+	}
+	defer l.closeScripts()
+
 	if err := l.createPublicationFromConfig(cfg); err != nil {
 		return err
 	}
 
+	// the transform columns are checked against the tables by now
+	l.logTransforms(cfg.WatchList)
+
+	// the DDL messages of the event trigger are received only with DDL capture
+	if err := l.pgComp.StartReplication(cfg.DDLCapture.Enabled); err != nil {
+		return err
+	}
+
+	types := newTypeLoader(l.dbDsn)
+	defer types.Close()
+
+	l.outbox = newOutboxCleaner(l.dbDsn, cfg.WatchList)
+	defer l.outbox.Close()
+
 	tx := models.NewWalTransaction()
+	tx.TypeStore.SetLoader(types)
+	tx.DecodeOptions = cfg.DecodeOptions
+	tx.OutboxPayloads = models.OutboxPayloads(cfg.WatchList)
+	tx.DeletedOutboxRows = l.outbox.deleted
 
 	for {
 		if time.Now().After(nextStandbyMessageDeadline) {
@@ -104,7 +177,7 @@ func (l *listener) Process() error {
 		}
 
 		msg, ok := rawMsg.(*pgproto3.CopyData)
-		if !ok {
+		if !ok || len(msg.Data) == 0 {
 			l.logger.Infof("Received unexpected message: %T\n", rawMsg)
 			continue
 		}
@@ -134,13 +207,7 @@ func (l *listener) Process() error {
 			}
 
 			if tx.CommitTime != nil {
-				events := tx.CreateEventsWithWatchList(cfg.WatchList)
-				for _, event := range events {
-					topic := buildTopic(cfg.PrefixWatchList, event.Table, cfg.WatchList)
-					if err := l.publisher.Publish(topic, event); err != nil {
-						l.logger.Errorln("Failed to publish event:", err)
-					}
-				}
+				l.publishTransaction(tx, cfg)
 				tx.Clear()
 			}
 
@@ -156,15 +223,302 @@ func (l *listener) Process() error {
 	}
 }
 
-func buildTopic(prefix, table string, watchList map[string]models.WatchConfig) string {
-	mapping := table
-	if w, ok := watchList[table]; ok && w.Mapping != "" {
-		mapping = w.Mapping
+// publishTransaction publishes events of the committed transaction,
+// surrounded by BEGIN and COMMIT markers when they are enabled.
+func (l *listener) publishTransaction(tx *models.WalTransaction, cfg Config) {
+	var events []models.Event
+	for _, event := range tx.CreateEventsWithWatchList(cfg.WatchList) {
+		if event.Action == string(models.ActionKindDDL) && !cfg.DDLCapture.Enabled {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if len(events) == 0 {
+		return
+	}
+
+	var topics []string
+	events, topics = l.runScripts(events, cfg)
+	if len(events) == 0 {
+		return
+	}
+
+	events, topics, messages := l.serializeEvents(events, topics)
+	if len(events) == 0 {
+		return
+	}
+
+	markerTopic := buildTransactionTopic(cfg.PrefixWatchList, cfg.TransactionMarkers)
+	if cfg.TransactionMarkers.Enabled {
+		begin, _ := tx.CreateTransactionEvents(events)
+		l.publish(markerTopic, begin)
+	}
+
+	var published, processed []models.Event
+	for i, event := range events {
+		if !l.send(topics[i], messages[i]) {
+			if l.outbox.deletes(event) {
+				l.logger.Errorf("outbox row %s was not published, it stays in the table", event.OutboxRow())
+			}
+			continue
+		}
+		published = append(published, event)
+		if l.outbox.deletes(event) {
+			processed = append(processed, event)
+		}
+	}
+
+	if err := l.outbox.deleteProcessed(processed); err != nil {
+		l.logger.Errorln("Failed to delete processed outbox rows:", err)
+	}
+
+	if cfg.TransactionMarkers.Enabled {
+		// the counts of the events which reached the broker
+		_, commit := tx.CreateTransactionEvents(published)
+		l.publish(markerTopic, commit)
+	}
+}
+
+// serializeEvents numbers the events and serializes them in the formats of
+// their tables. The events which are skipped by the format or fail to
+// serialize are dropped and the rest are numbered again, so TxIndex and
+// TxTotal count only the events which are published.
+func (l *listener) serializeEvents(events []models.Event, topics []string) ([]models.Event, []string, []models.Message) {
+	for {
+		models.NumberEvents(events)
+
+		var (
+			kept       []models.Event
+			keptTopics []string
+			messages   []models.Message
+		)
+		for i, event := range events {
+			msg, ok := l.serialize(topics[i], event)
+			if !ok {
+				continue
+			}
+			kept = append(kept, event)
+			keptTopics = append(keptTopics, topics[i])
+			messages = append(messages, msg)
+		}
+
+		if len(kept) == len(events) {
+			return kept, keptTopics, messages
+		}
+		events, topics = kept, keptTopics
+	}
+}
+
+// runScripts returns the events rewritten by the scripts of their tables with
+// their topics. An event whose script fails is skipped.
+func (l *listener) runScripts(events []models.Event, cfg Config) ([]models.Event, []string) {
+	var scripted []models.Event
+	var topics []string
+
+	for _, event := range events {
+		topic := buildTopic(cfg.PrefixWatchList, &event, cfg.WatchList)
+		if event.Action == string(models.ActionKindDDL) {
+			topic = buildDDLTopic(cfg.PrefixWatchList, cfg.DDLCapture)
+		}
+
+		s, ok := l.tableScripts[event.Table]
+		if !ok || event.Action == string(models.ActionKindDDL) {
+			scripted = append(scripted, event)
+			topics = append(topics, topic)
+			continue
+		}
+
+		if reloaded, err := s.ReloadIfChanged(); err != nil {
+			l.logger.Errorf("failed to reload script %s, the previous version is used: %v", s.Path(), err)
+		} else if reloaded {
+			l.logger.Infof("script %s of %s is reloaded", s.Path(), event.Table)
+		}
+
+		outputs, err := s.Run(event, topic)
+		if err != nil {
+			l.logger.Errorf("skip event %s of %s: %v", event.ID, event.Table, err)
+			continue
+		}
+
+		for _, output := range outputs {
+			scripted = append(scripted, output.Event)
+			topics = append(topics, output.Topic)
+		}
+	}
+
+	return scripted, topics
+}
+
+// publish serializes the event in the output format of its table and
+// publishes it. It reports whether the event was published.
+func (l *listener) publish(topic string, event models.Event) bool {
+	msg, ok := l.serialize(topic, event)
+	if !ok {
+		return false
+	}
+
+	return l.send(topic, msg)
+}
+
+// serialize converts the event to the message of the output format of its
+// table. It reports false for the events which are skipped or fail.
+func (l *listener) serialize(topic string, event models.Event) (models.Message, bool) {
+	serializer, ok := l.tableSerializers[event.Table]
+	if !ok {
+		serializer = l.serializer
+	}
+
+	msg, err := serializer.Serialize(topic, event)
+	if errors.Is(err, serializers.ErrSkipEvent) {
+		l.logger.Debugln(err)
+		return models.Message{}, false
+	}
+	if err != nil {
+		l.logger.Errorln("Failed to serialize event:", err)
+		return models.Message{}, false
+	}
+
+	return msg, true
+}
+
+// send publishes the message, it reports whether the message was published.
+func (l *listener) send(topic string, msg models.Message) bool {
+	if err := l.publisher.Publish(topic, msg); err != nil {
+		l.logger.Errorln("Failed to publish event:", err)
+		return false
+	}
+
+	return true
+}
+
+// logTransforms writes the column transforms to the audit log, so it is known
+// which columns are published as they are.
+func (l *listener) logTransforms(watchList map[string]models.WatchConfig) {
+	for _, table := range slices.Sorted(maps.Keys(watchList)) {
+		transforms := watchList[table].Transforms
+		if len(transforms) == 0 {
+			l.logger.Infof("transform audit: table %s publishes all columns untransformed", table)
+			continue
+		}
+
+		for _, column := range slices.Sorted(maps.Keys(transforms)) {
+			l.logger.Infof("transform audit: table %s column %s is published with %s", table, column, transforms[column])
+		}
+	}
+}
+
+// initSerializers creates serializer of the output format and serializers of
+// the tables with their own encoding in the watch list.
+func (l *listener) initSerializers(cfg Config) error {
+	dbConfig, err := pgconn.ParseConfig(l.dbDsn)
+	if err != nil {
+		return err
+	}
+	opts := serializers.Options{Database: dbConfig.Database, Decode: cfg.DecodeOptions}
+
+	if l.serializer, err = l.newSerializer(cfg.Output, opts); err != nil {
+		return err
+	}
+
+	l.tableSerializers = make(map[string]serializers.Serializer)
+	for table, w := range cfg.WatchList {
+		if w.Outbox != nil {
+			l.tableSerializers[table] = serializers.NewOutbox(*w.Outbox)
+			if l.tableSerializers[table].RequiresHeaders() && !l.publisher.SupportsHeaders() {
+				return fmt.Errorf("watch_list %s: outbox requires a publisher with headers, set REDIS_MODE=stream", table)
+			}
+			continue
+		}
+		if w.Encoding == "" {
+			continue
+		}
+
+		output := cfg.Output
+		output.Format = serializers.Format(w.Encoding)
+		if l.tableSerializers[table], err = l.newSerializer(output, opts); err != nil {
+			return fmt.Errorf("watch_list %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// initScripts loads the Lua scripts of the tables in the watch list.
+func (l *listener) initScripts(cfg Config) error {
+	l.tableScripts = make(map[string]*script.Script)
+	for _, table := range slices.Sorted(maps.Keys(cfg.WatchList)) {
+		path := cfg.WatchList[table].Script
+		if path == "" {
+			continue
+		}
+
+		s, err := script.Load(path, cfg.Scripting)
+		if err != nil {
+			l.closeScripts()
+			return fmt.Errorf("watch_list %s: %w", table, err)
+		}
+		l.tableScripts[table] = s
+		l.logger.Infof("events of %s are rewritten by script %s", table, path)
+	}
+
+	return nil
+}
+
+// closeScripts releases the Lua states of the scripts.
+func (l *listener) closeScripts() {
+	for _, s := range l.tableScripts {
+		s.Close()
+	}
+}
+
+// newSerializer creates serializer of the format, formats which need
+// headers are rejected when the publisher can't send them.
+func (l *listener) newSerializer(cfg serializers.Config, opts serializers.Options) (serializers.Serializer, error) {
+	serializer, err := serializers.New(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if serializer.RequiresHeaders() && !l.publisher.SupportsHeaders() {
+		return nil, fmt.Errorf("output format %s requires a publisher with headers, set REDIS_MODE=stream", cfg.Format)
+	}
+
+	return serializer, nil
+}
+
+// buildTopic returns the topic of the event from the mapping template of its
+// table, or the fallback topic when a field of the template is missing. Rows
+// of outbox tables go to their aggregate type by default.
+func buildTopic(prefix string, event *models.Event, watchList map[string]models.WatchConfig) string {
+	w := watchList[event.Table]
+	template := w.Mapping
+	if template.IsZero() && w.Outbox != nil {
+		template = w.Outbox.Topic()
+	}
+	mapping, ok := template.Render(event)
+	if template.IsZero() || !ok {
+		mapping = w.FallbackTopic
+	}
+	return prefixedTopic(prefix, mapping, event.Table)
+}
+
+func buildDDLTopic(prefix string, cfg DDLCaptureConfig) string {
+	return prefixedTopic(prefix, cfg.Topic, "ddl")
+}
+
+func buildTransactionTopic(prefix string, cfg TransactionMarkersConfig) string {
+	return prefixedTopic(prefix, cfg.Topic, "transaction")
+}
+
+func prefixedTopic(prefix, topic, defaultTopic string) string {
+	if topic == "" {
+		topic = defaultTopic
 	}
 	if prefix != "" {
-		return prefix + "." + mapping
+		return prefix + "." + topic
 	}
-	return mapping
+	return topic
 }
 
 // SendStandbyStatus sends a `StandbyStatus` object with the current RestartLSN value to the server.
@@ -220,6 +574,19 @@ func (l *listener) createPublicationFromConfig(cfg Config) error {
 
 	fmt.Println("tableNames", tableNames)
 
+	columnLists, err := l.resolveColumnLists(sqlConn, cfg)
+	if err != nil {
+		return err
+	}
+	if err := l.checkColumnReferences(sqlConn, cfg); err != nil {
+		return err
+	}
+	rowFilters, err := l.resolveRowFilters(sqlConn, cfg)
+	if err != nil {
+		return err
+	}
+	opts := publicationOptions{columns: columnLists, rowFilters: rowFilters}
+
 	// Default to single publication strategy
 	strategy := cfg.PublicationStrategy
 	if strategy == "" {
@@ -228,7 +595,7 @@ func (l *listener) createPublicationFromConfig(cfg Config) error {
 
 	switch strategy {
 	case "single":
-		if err := l.ensurePublicationMatches(sqlConn, tableNames); err != nil {
+		if err := l.ensurePublicationMatches(sqlConn, tableNames, opts); err != nil {
 			return err
 		}
 		l.logger.Infoln("single publication ditto is ready")
@@ -238,7 +605,7 @@ func (l *listener) createPublicationFromConfig(cfg Config) error {
 		if prefix == "" {
 			prefix = "ditto"
 		}
-		if err := l.ensureMultiplePublications(sqlConn, tableNames, prefix); err != nil {
+		if err := l.ensureMultiplePublications(sqlConn, tableNames, opts, prefix); err != nil {
 			return err
 		}
 		l.logger.Infoln("multiple publications are ready")
@@ -247,10 +614,19 @@ func (l *listener) createPublicationFromConfig(cfg Config) error {
 		return fmt.Errorf("unsupported publication strategy: %s", strategy)
 	}
 
+	if cfg.DDLCapture.Enabled {
+		if l.version < 140000 {
+			return fmt.Errorf("ddl capture requires PostgreSQL 14 or newer, server version is %d", l.version)
+		}
+		if err := l.installDDLCapture(sqlConn, cfg.DDLCapture); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (l *listener) ensurePublicationMatches(conn *pgx.Conn, expectedTables []string) error {
+func (l *listener) ensurePublicationMatches(conn *pgx.Conn, expectedTables []string, opts publicationOptions) error {
 	publicationName := "ditto"
 
 	// Check if publication exists and get current tables
@@ -259,8 +635,18 @@ func (l *listener) ensurePublicationMatches(conn *pgx.Conn, expectedTables []str
 		return fmt.Errorf("failed to get current publication tables: %w", err)
 	}
 
+	currentColumnLists, err := l.getCurrentPublicationColumnLists(conn, publicationName)
+	if err != nil {
+		return fmt.Errorf("failed to get current publication column lists: %w", err)
+	}
+
+	rowFiltersMatch, err := l.rowFiltersMatch(conn, publicationName, expectedTables, opts.rowFilters)
+	if err != nil {
+		return fmt.Errorf("failed to get current publication row filters: %w", err)
+	}
+
 	// Compare expected vs current tables
-	if l.tablesMatch(expectedTables, currentTables) {
+	if l.tablesMatch(expectedTables, currentTables) && columnListsMatch(expectedTables, opts.columns, currentColumnLists) && rowFiltersMatch {
 		l.logger.Infof("publication %s already matches expected tables", publicationName)
 		return nil
 	}
@@ -278,7 +664,11 @@ func (l *listener) ensurePublicationMatches(conn *pgx.Conn, expectedTables []str
 	if len(expectedTables) == 0 {
 		sqlTable = "FOR ALL TABLES"
 	} else {
-		sqlTable = "FOR TABLE " + strings.Join(expectedTables, ", ")
+		tables := make([]string, len(expectedTables))
+		for i, table := range expectedTables {
+			tables[i] = publicationTable(table, opts)
+		}
+		sqlTable = "FOR TABLE " + strings.Join(tables, ", ")
 	}
 
 	createSQL := fmt.Sprintf("CREATE PUBLICATION %s %s;", publicationName, sqlTable)
@@ -288,6 +678,10 @@ func (l *listener) ensurePublicationMatches(conn *pgx.Conn, expectedTables []str
 		return fmt.Errorf("failed to create publication: %w", err)
 	}
 
+	if err := l.commentRowFilters(conn, publicationName, expectedTables, opts.rowFilters); err != nil {
+		return err
+	}
+
 	l.logger.Infof("successfully recreated publication %s", publicationName)
 	return nil
 }
@@ -354,7 +748,7 @@ func (l *listener) tablesMatch(expected, current []string) bool {
 	return true
 }
 
-func (l *listener) ensureMultiplePublications(conn *pgx.Conn, tables []string, prefix string) error {
+func (l *listener) ensureMultiplePublications(conn *pgx.Conn, tables []string, opts publicationOptions, prefix string) error {
 	for _, table := range tables {
 		publicationName := fmt.Sprintf("%s_%s", prefix, table)
 
@@ -364,10 +758,20 @@ func (l *listener) ensureMultiplePublications(conn *pgx.Conn, tables []string, p
 			return fmt.Errorf("failed to get current publication tables for %s: %w", publicationName, err)
 		}
 
+		currentColumnLists, err := l.getCurrentPublicationColumnLists(conn, publicationName)
+		if err != nil {
+			return fmt.Errorf("failed to get current publication column lists for %s: %w", publicationName, err)
+		}
+
 		expectedTables := []string{table}
 
+		rowFiltersMatch, err := l.rowFiltersMatch(conn, publicationName, expectedTables, opts.rowFilters)
+		if err != nil {
+			return fmt.Errorf("failed to get current publication row filters for %s: %w", publicationName, err)
+		}
+
 		// Compare expected vs current tables
-		if l.tablesMatch(expectedTables, currentTables) {
+		if l.tablesMatch(expectedTables, currentTables) && columnListsMatch(expectedTables, opts.columns, currentColumnLists) && rowFiltersMatch {
 			l.logger.Infof("publication %s already matches expected table", publicationName)
 			continue
 		}
@@ -381,13 +785,17 @@ func (l *listener) ensureMultiplePublications(conn *pgx.Conn, tables []string, p
 		}
 
 		// Create new publication for single table
-		createSQL := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s;", publicationName, table)
+		createSQL := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s;", publicationName, publicationTable(table, opts))
 		l.logger.Infof("creating publication with SQL: %s", createSQL)
 
 		if _, err := conn.Exec(context.Background(), createSQL); err != nil {
 			return fmt.Errorf("failed to create publication %s: %w", publicationName, err)
 		}
 
+		if err := l.commentRowFilters(conn, publicationName, expectedTables, opts.rowFilters); err != nil {
+			return err
+		}
+
 		l.logger.Infof("successfully created publication %s for table %s", publicationName, table)
 	}
 
@@ -0,0 +1,120 @@
+package listener
+
+import (
+	"context"
+	"ditto/models"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// outboxCleaner deletes the published rows of the outbox tables with
+// processed_rows: delete over a regular (non replication) connection.
+type outboxCleaner struct {
+	mu     sync.Mutex
+	dbDsn  string
+	conn   *pgx.Conn
+	tables map[string]bool
+	// deleted rows whose DELETE events are expected
+	deleted *models.OutboxRows
+}
+
+func newOutboxCleaner(dbDsn string, watchList map[string]models.WatchConfig) *outboxCleaner {
+	tables := make(map[string]bool)
+	for table, w := range watchList {
+		if w.Outbox != nil && w.Outbox.DeletesProcessed() {
+			tables[table] = true
+		}
+	}
+
+	return &outboxCleaner{dbDsn: dbDsn, tables: tables, deleted: models.NewOutboxRows()}
+}
+
+// deletes reports whether the row of the published event is deleted.
+func (c *outboxCleaner) deletes(event models.Event) bool {
+	row := event.OutboxRow()
+
+	return row != nil && c.tables[row.Table]
+}
+
+// deleteProcessed deletes the rows of the published events by their replica
+// identity key, the DELETE events of the deleted rows are skipped quietly.
+// The rows are found by their keys as replicated, the transforms and the
+// scripts change only the published events.
+func (c *outboxCleaner) deleteProcessed(events []models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx := context.Background()
+
+	if c.conn == nil || c.conn.IsClosed() {
+		sqlDsn := strings.ReplaceAll(c.dbDsn, "replication=database", "")
+		conn, err := pgx.Connect(ctx, sqlDsn)
+		if err != nil {
+			return fmt.Errorf("connect: %w", err)
+		}
+		c.conn = conn
+	}
+
+	var (
+		errs   []error
+		queued []*models.RowKey
+		batch  = &pgx.Batch{}
+	)
+	for _, e := range events {
+		row := e.OutboxRow()
+		if row == nil {
+			errs = append(errs, fmt.Errorf("outbox table %s.%s has no replica identity key, its rows can't be deleted", e.Schema, e.Table))
+			continue
+		}
+
+		conditions := make([]string, len(row.Columns))
+		args := make([]any, len(row.Columns))
+		for i, name := range row.Columns {
+			conditions[i] = fmt.Sprintf("%s = $%d", pgx.Identifier{name}.Sanitize(), i+1)
+			args[i] = row.Values[name]
+		}
+
+		batch.Queue(fmt.Sprintf("DELETE FROM %s WHERE %s",
+			pgx.Identifier{row.Schema, row.Table}.Sanitize(), strings.Join(conditions, " AND ")), args...)
+		queued = append(queued, row)
+	}
+
+	if batch.Len() == 0 {
+		return errors.Join(errs...)
+	}
+
+	results := c.conn.SendBatch(ctx, batch)
+	for _, row := range queued {
+		tag, err := results.Exec()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("outbox row %s: %w", row, err))
+			continue
+		}
+		if tag.RowsAffected() > 0 {
+			c.deleted.Add(*row)
+		}
+	}
+	errs = append(errs, results.Close())
+
+	return errors.Join(errs...)
+}
+
+// Close closes the connection.
+func (c *outboxCleaner) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.Close(context.Background())
+}
@@ -16,7 +16,8 @@ import (
 type BinaryParser struct {
 	byteOrder binary.ByteOrder
 	msgType   byte
-	buffer    *bytes.Buffer
+	msg       []byte
+	pos       int
 }
 
 // NewBinaryParser create instance of binary parsers.
@@ -33,11 +34,15 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *models.WalTransaction) er
 	}
 
 	p.msgType = msg[0]
-	p.buffer = bytes.NewBuffer(msg[1:])
+	p.msg = msg
+	p.pos = 1
 
 	switch p.msgType {
 	case common.BeginMsgType:
-		begin := p.getBeginMsg()
+		begin, err := p.getBeginMsg()
+		if err != nil {
+			return fmt.Errorf("begin message: %w", err)
+		}
 
 		logrus.
 			WithFields(
@@ -48,9 +53,13 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *models.WalTransaction) er
 			Debugln("begin type message was received")
 
 		tx.LSN = begin.LSN
+		tx.XID = uint32(begin.XID)
 		tx.BeginTime = &begin.Timestamp
 	case common.CommitMsgType:
-		commit := p.getCommitMsg()
+		commit, err := p.getCommitMsg()
+		if err != nil {
+			return fmt.Errorf("commit message: %w", err)
+		}
 
 		logrus.
 			WithFields(
@@ -68,7 +77,10 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *models.WalTransaction) er
 	case common.OriginMsgType:
 		logrus.Debugln("origin type message was received")
 	case common.RelationMsgType:
-		relation := p.getRelationMsg()
+		relation, err := p.getRelationMsg()
+		if err != nil {
+			return fmt.Errorf("relation message: %w", err)
+		}
 
 		logrus.
 			WithFields(
@@ -83,27 +95,105 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *models.WalTransaction) er
 		}
 
 		rd := models.RelationData{
-			Schema: relation.Namespace,
-			Table:  relation.Name,
+			Schema:  relation.Namespace,
+			Table:   relation.Name,
+			Replica: relation.Replica,
 		}
 
 		for _, rf := range relation.Columns {
 			c := models.Column{
-				Name:      rf.Name,
-				ValueType: int(rf.TypeID),
-				IsKey:     rf.Key,
+				Name:          rf.Name,
+				ValueType:     int(rf.TypeID),
+				ValueModifier: int(rf.ModifierType),
+				IsKey:         rf.Key,
 			}
 			rd.Columns = append(rd.Columns, c)
 		}
 
+		// relation is sent again after a change of the table or a reconnect,
+		// only a real difference in structure is published.
+		if cached, ok := tx.RelationStore[relation.ID]; ok {
+			if change := tx.DiffRelations(cached, rd); change != nil {
+				tx.Actions = append(tx.Actions, models.ActionData{
+					Schema:       rd.Schema,
+					Table:        rd.Table,
+					Kind:         models.ActionKindSchemaChange,
+					SchemaChange: change,
+				})
+			}
+		}
+
 		tx.RelationStore[relation.ID] = rd
+		// types created with the table may be loadable now
+		tx.TypeStore.ForgetFailures()
 
 	case common.TypeMsgType:
-		logrus.Debugln("type message was received")
-	case common.TMsgType:
-		logrus.Debugln("t message was received")
+		dt, err := p.getTypeMsg()
+		if err != nil {
+			return fmt.Errorf("type message: %w", err)
+		}
+
+		logrus.
+			WithFields(
+				logrus.Fields{
+					"type_id":   dt.ID,
+					"namespace": dt.Namespace,
+					"name":      dt.Name,
+				}).
+			Debugln("type message was received")
+
+		tx.TypeStore.Announce(dt)
+	case common.LogicalMsgType:
+		m, err := p.getLogicalMsg()
+		if err != nil {
+			return fmt.Errorf("logical message: %w", err)
+		}
+
+		logrus.
+			WithFields(
+				logrus.Fields{
+					"lsn":    m.LSN,
+					"prefix": m.Prefix,
+				}).
+			Debugln("logical message was received")
+
+		if m.Prefix != models.DDLMessagePrefix || m.Flags&1 == 0 {
+			return nil
+		}
+
+		action, err := tx.CreateDDLAction(m.Content)
+		if err != nil {
+			return fmt.Errorf("create ddl action: %w", err)
+		}
+
+		tx.Actions = append(tx.Actions, action)
+	case common.TruncateMsgType:
+		truncate, err := p.getTruncateMsg()
+		if err != nil {
+			return fmt.Errorf("truncate message: %w", err)
+		}
+
+		logrus.
+			WithFields(
+				logrus.Fields{
+					"relations": truncate.RelationIDs,
+					"options":   truncate.Options,
+				}).
+			Debugln("truncate message was received")
+
+		for _, id := range truncate.RelationIDs {
+			action, err := tx.CreateTruncateAction(id)
+			if err != nil {
+				return fmt.Errorf("create action data: %w", err)
+			}
+
+			tx.Actions = append(tx.Actions, action)
+		}
 	case common.InsertMsgType:
-		insert := p.getInsertMsg()
+		insert, err := p.getInsertMsg()
+		if err != nil {
+			return fmt.Errorf("insert message: %w", err)
+		}
 
 		logrus.
 			WithFields(
@@ -125,7 +215,10 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *models.WalTransaction) er
 
 		tx.Actions = append(tx.Actions, action)
 	case common.UpdateMsgType:
-		upd := p.getUpdateMsg()
+		upd, err := p.getUpdateMsg()
+		if err != nil {
+			return fmt.Errorf("update message: %w", err)
+		}
 
 		logrus.
 			WithFields(
@@ -143,10 +236,14 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *models.WalTransaction) er
 		if err != nil {
 			return fmt.Errorf("create action data: %w", err)
 		}
+		action.OldRowFull = upd.OldTuple
 
 		tx.Actions = append(tx.Actions, action)
 	case common.DeleteMsgType:
-		del := p.getDeleteMsg()
+		del, err := p.getDeleteMsg()
+		if err != nil {
+			return fmt.Errorf("delete message: %w", err)
+		}
 
 		logrus.
 			WithFields(
@@ -164,6 +261,7 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *models.WalTransaction) er
 		if err != nil {
 			return fmt.Errorf("create action data: %w", err)
 		}
+		action.OldRowFull = del.OldTuple
 
 		tx.Actions = append(tx.Actions, action)
 	default:
@@ -172,153 +270,331 @@ func (p *BinaryParser) ParseWalMessage(msg []byte, tx *models.WalTransaction) er
 	return nil
 }
 
-func (p *BinaryParser) getBeginMsg() common.Begin {
-	return common.Begin{
-		LSN:       p.readInt64(),
-		Timestamp: p.readTimestamp(),
-		XID:       p.readInt32(),
+func (p *BinaryParser) getBeginMsg() (m common.Begin, err error) {
+	if m.LSN, err = p.readInt64(); err != nil {
+		return m, err
+	}
+	if m.Timestamp, err = p.readTimestamp(); err != nil {
+		return m, err
 	}
+	m.XID, err = p.readInt32()
+
+	return m, err
 }
 
-func (p *BinaryParser) getCommitMsg() common.Commit {
-	return common.Commit{
-		Flags:          p.readInt8(),
-		LSN:            p.readInt64(),
-		TransactionLSN: p.readInt64(),
-		Timestamp:      p.readTimestamp(),
+func (p *BinaryParser) getCommitMsg() (m common.Commit, err error) {
+	if m.Flags, err = p.readInt8(); err != nil {
+		return m, err
+	}
+	if m.LSN, err = p.readInt64(); err != nil {
+		return m, err
 	}
+	if m.TransactionLSN, err = p.readInt64(); err != nil {
+		return m, err
+	}
+	m.Timestamp, err = p.readTimestamp()
+
+	return m, err
 }
 
-func (p *BinaryParser) getInsertMsg() common.Insert {
-	return common.Insert{
-		RelationID: p.readInt32(),
-		NewTuple:   p.buffer.Next(1)[0] == common.NewTupleDataType,
-		NewRow:     p.readTupleData(),
+func (p *BinaryParser) getLogicalMsg() (m common.Message, err error) {
+	if m.Flags, err = p.readInt8(); err != nil {
+		return m, err
+	}
+	if m.LSN, err = p.readInt64(); err != nil {
+		return m, err
+	}
+	if m.Prefix, err = p.readString(); err != nil {
+		return m, err
 	}
+	size, err := p.readInt32()
+	if err != nil {
+		return m, err
+	}
+	m.Content, err = p.next(int(size))
+
+	return m, err
 }
 
-func (p *BinaryParser) getDeleteMsg() common.Delete {
-	return common.Delete{
-		RelationID: p.readInt32(),
-		KeyTuple:   p.charIsExists('K'),
-		OldTuple:   p.charIsExists('O'),
-		OldRow:     p.readTupleData(),
+func (p *BinaryParser) getInsertMsg() (m common.Insert, err error) {
+	if m.RelationID, err = p.readInt32(); err != nil {
+		return m, err
+	}
+	if m.NewTuple, err = p.charIsExists(common.NewTupleDataType); err != nil {
+		return m, err
+	}
+	if !m.NewTuple {
+		return m, p.errorf("expected new tuple")
 	}
+	m.NewRow, err = p.readTupleData()
+
+	return m, err
 }
 
-func (p *BinaryParser) getUpdateMsg() common.Update {
-	u := common.Update{}
-	u.RelationID = p.readInt32()
-	u.KeyTuple = p.charIsExists('K')
-	u.OldTuple = p.charIsExists('O')
-	if u.KeyTuple || u.OldTuple {
-		u.OldRow = p.readTupleData()
+func (p *BinaryParser) getTruncateMsg() (m common.Truncate, err error) {
+	count, err := p.readInt32()
+	if err != nil {
+		return m, err
+	}
+	if count < 0 {
+		return m, p.errorf("negative relation count %d", count)
+	}
+	if m.Options, err = p.readInt8(); err != nil {
+		return m, err
+	}
+	if int(count) > (len(p.msg)-p.pos)/4 {
+		return m, p.errorf("%d relations do not fit in the message", count)
 	}
 
-	u.OldTuple = p.charIsExists('N')
-	u.NewRow = p.readTupleData()
+	m.RelationIDs = make([]int32, count)
+	for i := range m.RelationIDs {
+		if m.RelationIDs[i], err = p.readInt32(); err != nil {
+			return m, err
+		}
+	}
 
-	return u
+	return m, nil
 }
 
-func (p *BinaryParser) getRelationMsg() common.Relation {
-	return common.Relation{
-		ID:        p.readInt32(),
-		Namespace: p.readString(),
-		Name:      p.readString(),
-		Replica:   p.readInt8(),
-		Columns:   p.readColumns(),
+func (p *BinaryParser) getDeleteMsg() (m common.Delete, err error) {
+	if m.RelationID, err = p.readInt32(); err != nil {
+		return m, err
+	}
+	if m.KeyTuple, err = p.charIsExists('K'); err != nil {
+		return m, err
 	}
+	if m.OldTuple, err = p.charIsExists('O'); err != nil {
+		return m, err
+	}
+	if !m.KeyTuple && !m.OldTuple {
+		return m, p.errorf("expected key or old tuple")
+	}
+	m.OldRow, err = p.readTupleData()
+
+	return m, err
 }
 
-func (p *BinaryParser) readInt32() (val int32) {
-	r := bytes.NewReader(p.buffer.Next(4))
-	_ = binary.Read(r, p.byteOrder, &val)
+func (p *BinaryParser) getUpdateMsg() (m common.Update, err error) {
+	if m.RelationID, err = p.readInt32(); err != nil {
+		return m, err
+	}
+	if m.KeyTuple, err = p.charIsExists('K'); err != nil {
+		return m, err
+	}
+	if m.OldTuple, err = p.charIsExists('O'); err != nil {
+		return m, err
+	}
+	if m.KeyTuple || m.OldTuple {
+		if m.OldRow, err = p.readTupleData(); err != nil {
+			return m, err
+		}
+	}
+
+	if m.NewTuple, err = p.charIsExists(common.NewTupleDataType); err != nil {
+		return m, err
+	}
+	if !m.NewTuple {
+		return m, p.errorf("expected new tuple")
+	}
+	m.NewRow, err = p.readTupleData()
 
-	return
+	return m, err
 }
 
-func (p *BinaryParser) readInt64() (val int64) {
-	r := bytes.NewReader(p.buffer.Next(8))
-	_ = binary.Read(r, p.byteOrder, &val)
+func (p *BinaryParser) getTypeMsg() (m common.DataType, err error) {
+	if m.ID, err = p.readInt32(); err != nil {
+		return m, err
+	}
+	if m.Namespace, err = p.readString(); err != nil {
+		return m, err
+	}
+	m.Name, err = p.readString()
 
-	return
+	return m, err
 }
 
-func (p *BinaryParser) readInt8() (val int8) {
-	r := bytes.NewReader(p.buffer.Next(1))
-	_ = binary.Read(r, p.byteOrder, &val)
+func (p *BinaryParser) getRelationMsg() (m common.Relation, err error) {
+	if m.ID, err = p.readInt32(); err != nil {
+		return m, err
+	}
+	if m.Namespace, err = p.readString(); err != nil {
+		return m, err
+	}
+	if m.Name, err = p.readString(); err != nil {
+		return m, err
+	}
+	if m.Replica, err = p.readInt8(); err != nil {
+		return m, err
+	}
+	m.Columns, err = p.readColumns()
+
+	return m, err
+}
 
-	return
+// errorf creates error with the current offset in the message.
+func (p *BinaryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at offset %d", errorx.ErrMalformedMessage, fmt.Sprintf(format, args...), p.pos)
 }
 
-func (p *BinaryParser) readInt16() (val int16) {
-	r := bytes.NewReader(p.buffer.Next(2))
-	_ = binary.Read(r, p.byteOrder, &val)
+// next returns the following n bytes of the message.
+func (p *BinaryParser) next(n int) ([]byte, error) {
+	if n < 0 || len(p.msg)-p.pos < n {
+		return nil, fmt.Errorf("%w: need %d bytes at offset %d, have %d", errorx.ErrShortMessage, n, p.pos, len(p.msg)-p.pos)
+	}
 
-	return
+	b := p.msg[p.pos : p.pos+n]
+	p.pos += n
+
+	return b, nil
 }
 
-func (p *BinaryParser) readTimestamp() time.Time {
-	ns := p.readInt64()
+func (p *BinaryParser) readInt32() (int32, error) {
+	b, err := p.next(4)
+	if err != nil {
+		return 0, err
+	}
 
-	return common.PostgresEpoch.Add(time.Duration(ns) * time.Microsecond)
+	return int32(p.byteOrder.Uint32(b)), nil
 }
 
-func (p *BinaryParser) readString() (str string) {
-	stringBytes, _ := p.buffer.ReadBytes(0)
+func (p *BinaryParser) readInt64() (int64, error) {
+	b, err := p.next(8)
+	if err != nil {
+		return 0, err
+	}
 
-	return string(bytes.Trim(stringBytes, "\x00"))
+	return int64(p.byteOrder.Uint64(b)), nil
 }
 
-func (p *BinaryParser) readBool() bool {
-	x := p.buffer.Next(1)[0]
+func (p *BinaryParser) readInt8() (int8, error) {
+	b, err := p.next(1)
+	if err != nil {
+		return 0, err
+	}
 
-	return x != 0
+	return int8(b[0]), nil
 }
 
-func (p *BinaryParser) charIsExists(char byte) bool {
-	if p.buffer.Next(1)[0] == char {
-		return true
+func (p *BinaryParser) readInt16() (int16, error) {
+	b, err := p.next(2)
+	if err != nil {
+		return 0, err
 	}
-	_ = p.buffer.UnreadByte()
 
-	return false
+	return int16(p.byteOrder.Uint16(b)), nil
 }
 
-func (p *BinaryParser) readColumns() []common.RelationColumn {
-	size := int(p.readInt16())
+func (p *BinaryParser) readTimestamp() (time.Time, error) {
+	ns, err := p.readInt64()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return common.PostgresEpoch.Add(time.Duration(ns) * time.Microsecond), nil
+}
+
+func (p *BinaryParser) readString() (string, error) {
+	end := bytes.IndexByte(p.msg[p.pos:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("%w: unterminated string at offset %d", errorx.ErrShortMessage, p.pos)
+	}
+
+	str := string(p.msg[p.pos : p.pos+end])
+	p.pos += end + 1
+
+	return str, nil
+}
+
+func (p *BinaryParser) readBool() (bool, error) {
+	b, err := p.next(1)
+	if err != nil {
+		return false, err
+	}
+
+	return b[0] != 0, nil
+}
+
+func (p *BinaryParser) charIsExists(char byte) (bool, error) {
+	b, err := p.next(1)
+	if err != nil {
+		return false, err
+	}
+
+	if b[0] == char {
+		return true, nil
+	}
+	p.pos--
+
+	return false, nil
+}
+
+func (p *BinaryParser) readColumns() ([]common.RelationColumn, error) {
+	size, err := p.readInt16()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, p.errorf("negative number of columns %d", size)
+	}
+
 	data := make([]common.RelationColumn, size)
 
-	for i := 0; i < size; i++ {
-		data[i] = common.RelationColumn{
-			Key:          p.readBool(),
-			Name:         p.readString(),
-			TypeID:       p.readInt32(),
-			ModifierType: p.readInt32(),
+	for i := range data {
+		c := &data[i]
+		if c.Key, err = p.readBool(); err != nil {
+			return nil, err
+		}
+		if c.Name, err = p.readString(); err != nil {
+			return nil, err
+		}
+		if c.TypeID, err = p.readInt32(); err != nil {
+			return nil, err
+		}
+		if c.ModifierType, err = p.readInt32(); err != nil {
+			return nil, err
 		}
 	}
 
-	return data
+	return data, nil
 }
 
-func (p *BinaryParser) readTupleData() []common.TupleData {
-	size := int(p.readInt16())
+func (p *BinaryParser) readTupleData() ([]common.TupleData, error) {
+	size, err := p.readInt16()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, p.errorf("negative number of columns %d", size)
+	}
+
 	data := make([]common.TupleData, size)
 
-	for i := 0; i < size; i++ {
-		sl := p.buffer.Next(1)
+	for i := range data {
+		kind, err := p.next(1)
+		if err != nil {
+			return nil, err
+		}
 
-		switch sl[0] {
+		data[i] = common.TupleData{Kind: kind[0]}
+
+		switch kind[0] {
 		case common.NullDataType:
 			logrus.Debugln("tupleData: null data type")
 		case common.ToastDataType:
-			logrus.Debugln("tupleData: toast data type")
-		case common.TextDataType:
-			vSize := int(p.readInt32())
-			data[i] = common.TupleData{Value: p.buffer.Next(vSize)}
+			logrus.Debugln("tupleData: unchanged toast data type")
+		case common.TextDataType, common.BinaryDataType:
+			vSize, err := p.readInt32()
+			if err != nil {
+				return nil, err
+			}
+			if data[i].Value, err = p.next(int(vSize)); err != nil {
+				return nil, err
+			}
+		default:
+			p.pos--
+			return nil, p.errorf("unknown tuple data type %q", kind[0])
 		}
 	}
 
-	return data
+	return data, nil
 }
@@ -0,0 +1,182 @@
+package listener
+
+import (
+	"context"
+	"crypto/sha256"
+	"ditto/common"
+	"ditto/filter"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// pgRowFiltersVersion first version with the publication row filters.
+const pgRowFiltersVersion = 150000
+
+// rowFiltersCommentPrefix prefix of the publication comment with the
+// fingerprint of the row filters, PostgreSQL keeps them only as parsed trees.
+const rowFiltersCommentPrefix = "ditto row filters "
+
+// publicationOptions column lists and row filters of the published tables.
+type publicationOptions struct {
+	columns    map[string][]string
+	rowFilters map[string]string
+}
+
+// tableColumnTypesSQL returns the columns of the table with their types.
+const tableColumnTypesSQL = `
+SELECT a.attname, a.atttypid
+FROM pg_attribute a
+WHERE a.attrelid = $1::text::regclass AND a.attnum > 0 AND NOT a.attisdropped`
+
+// resolveRowFilters returns the publication row filters of the tables with
+// filter_pushdown. Filters which can't be pushed down stay in the service:
+// PostgreSQL refuses the UPDATE and DELETE statements on a table whose row
+// filter uses a column out of the replica identity, so such filters are
+// never pushed down.
+func (l *listener) resolveRowFilters(conn *pgx.Conn, cfg Config) (map[string]string, error) {
+	rowFilters := make(map[string]string)
+
+	for _, table := range slices.Sorted(maps.Keys(cfg.WatchList)) {
+		w := cfg.WatchList[table]
+		if w.Filter == nil {
+			continue
+		}
+
+		identity, err := queryNames(conn, fmt.Sprintf(replicaIdentityColumnsSQL, l.notGeneratedColumns()), table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get replica identity of %s: %w", table, err)
+		}
+
+		missing := slices.DeleteFunc(w.Filter.Columns(), func(name string) bool { return slices.Contains(identity, name) })
+		if len(missing) > 0 {
+			l.logger.Warnf("filter of %s uses columns out of the replica identity: %s, they are missing in DELETE events, "+
+				"which fail the filter and are not published unless the table has REPLICA IDENTITY FULL",
+				table, strings.Join(missing, ", "))
+		}
+
+		if !w.FilterPushdown {
+			continue
+		}
+
+		if l.version < pgRowFiltersVersion {
+			l.logger.Infof("row filters require PostgreSQL 15, filter of %s is evaluated by ditto", table)
+			continue
+		}
+
+		if len(missing) > 0 {
+			l.logger.Infof("filter of %s can't be pushed down, the replica identity lacks %s, it is evaluated by ditto",
+				table, strings.Join(missing, ", "))
+			continue
+		}
+
+		columns, err := filterColumnTypes(conn, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get columns of %s: %w", table, err)
+		}
+
+		where, ok := w.Filter.SQL(columns)
+		if !ok {
+			l.logger.Infof("filter of %s can't be pushed down, it is evaluated by ditto: %s", table, w.Filter)
+			continue
+		}
+
+		w.Filter.SetPushedDown(true)
+		rowFilters[table] = where
+		l.logger.Infof("filter of %s is pushed down: WHERE (%s)", table, where)
+	}
+
+	return rowFilters, nil
+}
+
+// filterColumnTypes returns the columns of the table by the kind of their
+// values in the filter expressions.
+func filterColumnTypes(conn *pgx.Conn, table string) (map[string]filter.ColumnType, error) {
+	rows, err := conn.Query(context.Background(), tableColumnTypesSQL, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]filter.ColumnType)
+	for rows.Next() {
+		var name string
+		var oid uint32
+		if err := rows.Scan(&name, &oid); err != nil {
+			return nil, err
+		}
+		columns[name] = filterColumnType(oid)
+	}
+
+	return columns, rows.Err()
+}
+
+// filterColumnType returns the kind of the values of the type. char(n) is
+// left out, it is padded in the events and compared without the padding
+// in SQL.
+func filterColumnType(oid uint32) filter.ColumnType {
+	switch oid {
+	case common.BoolOID:
+		return filter.ColumnBool
+	case common.Int2OID, common.Int4OID, common.Int8OID, common.Float4OID, common.Float8OID, common.Numeric:
+		return filter.ColumnNumber
+	case common.TextOID, common.VarcharOID, common.NameOID:
+		return filter.ColumnString
+	}
+
+	return filter.ColumnOther
+}
+
+// rowFiltersFingerprint returns the comment of the publication with the row filters of the tables.
+func rowFiltersFingerprint(tables []string, rowFilters map[string]string) string {
+	h := sha256.New()
+	found := false
+	for _, table := range slices.Sorted(slices.Values(tables)) {
+		if where, ok := rowFilters[table]; ok {
+			fmt.Fprintf(h, "%s\x00%s\x00", table, where)
+			found = true
+		}
+	}
+
+	if !found {
+		return ""
+	}
+
+	return rowFiltersCommentPrefix + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// rowFiltersMatch reports whether the publication was created with the row filters.
+func (l *listener) rowFiltersMatch(conn *pgx.Conn, publicationName string, tables []string, rowFilters map[string]string) (bool, error) {
+	var comment string
+	err := conn.QueryRow(context.Background(),
+		"SELECT COALESCE(obj_description(oid, 'pg_publication'), '') FROM pg_publication WHERE pubname = $1",
+		publicationName).Scan(&comment)
+	if err != nil && err != pgx.ErrNoRows {
+		return false, err
+	}
+
+	if !strings.HasPrefix(comment, rowFiltersCommentPrefix) {
+		comment = ""
+	}
+
+	return comment == rowFiltersFingerprint(tables, rowFilters), nil
+}
+
+// commentRowFilters records the row filters of the created publication.
+func (l *listener) commentRowFilters(conn *pgx.Conn, publicationName string, tables []string, rowFilters map[string]string) error {
+	fingerprint := rowFiltersFingerprint(tables, rowFilters)
+	if fingerprint == "" {
+		return nil
+	}
+
+	sql := fmt.Sprintf("COMMENT ON PUBLICATION %s IS '%s';", publicationName, fingerprint)
+	if _, err := conn.Exec(context.Background(), sql); err != nil {
+		return fmt.Errorf("failed to comment publication %s: %w", publicationName, err)
+	}
+
+	return nil
+}
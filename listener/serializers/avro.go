@@ -0,0 +1,648 @@
+package serializers
+
+import (
+	"ditto/common"
+	"ditto/models"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const contentTypeAvro = "application/vnd.confluent.avro"
+
+// AvroConfig config of the Avro output format.
+type AvroConfig struct {
+	// RegistryURL url of the Confluent-compatible schema registry.
+	RegistryURL string `yaml:"registry_url"`
+}
+
+// avroKind primitive or complex type of a column in the Avro schema.
+type avroKind int
+
+const (
+	avroBoolean avroKind = iota
+	avroInt
+	avroLong
+	avroFloat
+	avroDouble
+	avroString
+	avroBytes
+	avroDecimal
+	avroArray
+)
+
+var avroKindNames = map[avroKind]string{
+	avroBoolean: "boolean",
+	avroInt:     "int",
+	avroLong:    "long",
+	avroFloat:   "float",
+	avroDouble:  "double",
+	avroString:  "string",
+	avroBytes:   "bytes",
+}
+
+// avroType type of a column value, all values are nullable in the schema.
+type avroType struct {
+	kind      avroKind
+	logical   string
+	precision int
+	scale     int
+	// divisor converts epoch date values to days.
+	divisor int64
+	items   *avroType
+}
+
+// schema returns the JSON form of the type.
+func (t *avroType) schema() any {
+	switch t.kind {
+	case avroDecimal:
+		return map[string]any{"type": "bytes", "logicalType": "decimal", "precision": t.precision, "scale": t.scale}
+	case avroArray:
+		return map[string]any{"type": "array", "items": t.items.union()}
+	}
+
+	if t.logical != "" {
+		return map[string]any{"type": avroKindNames[t.kind], "logicalType": t.logical}
+	}
+
+	return avroKindNames[t.kind]
+}
+
+// union returns the nullable type, decimals have a string branch for the
+// values which they can't hold: NaN, ±Infinity and values with more digits
+// than the precision or the scale of the type.
+func (t *avroType) union() []any {
+	if t.kind == avroDecimal {
+		return []any{"null", t.schema(), "string"}
+	}
+
+	return []any{"null", t.schema()}
+}
+
+// avroColumnType maps the column type to Avro, types without a counterpart are
+// strings. Dates and times are logical types only when they are decoded to epoch numbers.
+func avroColumnType(oid uint32, typeModifier int, format models.TimeFormat) *avroType {
+	epochMicros := format == models.TimeFormatEpochMicros
+	epochMillis := format == models.TimeFormatEpochMillis
+
+	switch oid {
+	case common.BoolOID:
+		return &avroType{kind: avroBoolean}
+	case common.Int2OID, common.Int4OID:
+		return &avroType{kind: avroInt}
+	case common.Int8OID, common.OIDOID, common.XIDOID, common.CIDOID, common.Xid8OID:
+		return &avroType{kind: avroLong}
+	case common.Float4OID:
+		return &avroType{kind: avroFloat}
+	case common.Float8OID:
+		return &avroType{kind: avroDouble}
+	case common.Numeric:
+		// typmod of numeric(p,s) is ((p << 16) | s) + VARHDRSZ
+		if typeModifier >= 4 {
+			precision, scale := (typeModifier-4)>>16&0xffff, (typeModifier-4)&0xffff
+			if precision > 0 && scale <= precision {
+				return &avroType{kind: avroDecimal, precision: precision, scale: scale}
+			}
+		}
+		return &avroType{kind: avroString}
+	case common.ByteaOID:
+		return &avroType{kind: avroBytes}
+	case common.UUIDOID:
+		return &avroType{kind: avroString, logical: "uuid"}
+	case common.TimestampOID, common.TimestamptzOID:
+		switch {
+		case epochMicros:
+			return &avroType{kind: avroLong, logical: "timestamp-micros"}
+		case epochMillis:
+			return &avroType{kind: avroLong, logical: "timestamp-millis"}
+		}
+	case common.DateOID:
+		switch {
+		case epochMicros:
+			return &avroType{kind: avroInt, logical: "date", divisor: 86_400_000_000}
+		case epochMillis:
+			return &avroType{kind: avroInt, logical: "date", divisor: 86_400_000}
+		}
+	case common.TimeOID, common.TimetzOID:
+		switch {
+		case epochMicros:
+			return &avroType{kind: avroLong, logical: "time-micros"}
+		case epochMillis:
+			return &avroType{kind: avroInt, logical: "time-millis"}
+		}
+	default:
+		if t, ok := pgTypeMap.TypeForOID(oid); ok {
+			if c, ok := t.Codec.(*pgtype.ArrayCodec); ok {
+				return &avroType{kind: avroArray, items: avroColumnType(c.ElementType.OID, -1, format)}
+			}
+		}
+	}
+
+	return &avroType{kind: avroString}
+}
+
+// pgTypeMap built-in types, used to find element types of arrays.
+var pgTypeMap = pgtype.NewMap()
+
+// avroField column of the table in the Avro record.
+type avroField struct {
+	name   string
+	column string
+	typ    *avroType
+}
+
+// avroRecord Avro schema of the table rows.
+type avroRecord struct {
+	fields []avroField
+	keys   []avroField
+	schema string
+	key    string
+}
+
+// avroSerializer writes events in the Confluent wire format: magic byte,
+// schema ID and the Avro binary encoding of the envelope record.
+type avroSerializer struct {
+	registry   SchemaRegistry
+	timeFormat models.TimeFormat
+
+	mu      sync.Mutex
+	records map[string]*avroRecord
+	ids     map[string]int
+}
+
+func newAvroSerializer(cfg AvroConfig, opts Options) (*avroSerializer, error) {
+	registry := opts.SchemaRegistry
+	if registry == nil {
+		if cfg.RegistryURL == "" {
+			return nil, errors.New("avro output format requires output.avro.registry_url")
+		}
+
+		var err error
+		if registry, err = NewHTTPSchemaRegistry(cfg.RegistryURL); err != nil {
+			return nil, err
+		}
+	}
+
+	return &avroSerializer{
+		registry:   registry,
+		timeFormat: opts.Decode.TimeFormat,
+		records:    make(map[string]*avroRecord),
+		ids:        make(map[string]int),
+	}, nil
+}
+
+func (s *avroSerializer) Serialize(topic string, event models.Event) (models.Message, error) {
+	switch event.Action {
+	case string(models.ActionKindInsert), string(models.ActionKindUpdate),
+		string(models.ActionKindDelete), string(models.ActionKindTruncate):
+	default:
+		return models.Message{}, fmt.Errorf("%w: %s has no avro representation", ErrSkipEvent, event.Action)
+	}
+
+	record, err := s.record(event)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	id, err := s.schemaID(topic+"-value", record.schema)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	var data, dataOld map[string]any
+	switch event.Action {
+	case string(models.ActionKindInsert), string(models.ActionKindUpdate):
+		data = event.Data
+	}
+	if len(event.DataOld) > 0 {
+		dataOld = event.DataOld
+	}
+
+	buf := appendWireHeader(nil, id)
+	buf = appendAvroString(buf, event.ID.String())
+	buf = appendAvroString(buf, event.Action)
+	buf = appendAvroLong(buf, event.LSN)
+	buf = appendAvroLong(buf, int64(event.XID))
+	buf = appendAvroLong(buf, int64(event.Seq))
+	buf = appendAvroLong(buf, event.EventTime.UnixMicro())
+	for _, row := range []map[string]any{data, dataOld} {
+		if buf, err = appendAvroRow(buf, record.fields, row); err != nil {
+			return models.Message{}, fmt.Errorf("encode %s.%s: %w", event.Schema, event.Table, err)
+		}
+	}
+	buf = appendAvroStrings(buf, event.UnchangedToast)
+
+	msg := models.Message{Value: buf, ContentType: contentTypeAvro}
+
+	if len(record.keys) == 0 || len(event.Key) == 0 {
+		return msg, nil
+	}
+
+	keyID, err := s.schemaID(topic+"-key", record.key)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	key := appendWireHeader(nil, keyID)
+	for _, f := range record.keys {
+		if key, err = appendAvroNullable(key, f.typ, event.Key[f.column]); err != nil {
+			return models.Message{}, fmt.Errorf("encode key of %s.%s: %w", event.Schema, event.Table, err)
+		}
+	}
+	msg.Key = key
+
+	return msg, nil
+}
+
+func (s *avroSerializer) RequiresHeaders() bool {
+	return false
+}
+
+// record returns the schema of the table, it is built again when the columns change.
+func (s *avroSerializer) record(event models.Event) (*avroRecord, error) {
+	var sig strings.Builder
+	sig.WriteString(event.Schema + "." + event.Table)
+	for _, c := range event.Columns {
+		fmt.Fprintf(&sig, "|%s:%d:%d:%t", c.Name, c.TypeOID, c.TypeModifier, c.IsKey)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.records[sig.String()]; ok {
+		return r, nil
+	}
+
+	namespace := "ditto." + avroName(event.Schema) + "." + avroName(event.Table)
+	r := &avroRecord{}
+	var valueFields, keyFields []any
+
+	names := make(map[string]string, len(event.Columns))
+	for _, c := range event.Columns {
+		f := avroField{name: avroName(c.Name), column: c.Name, typ: avroColumnType(c.TypeOID, c.TypeModifier, s.timeFormat)}
+		if other, ok := names[f.name]; ok {
+			return nil, fmt.Errorf("columns %q and %q of %s.%s have the same avro name %s, exclude or rename one of them",
+				other, c.Name, event.Schema, event.Table, f.name)
+		}
+		names[f.name] = c.Name
+
+		r.fields = append(r.fields, f)
+		valueFields = append(valueFields, avroFieldSchema(f.name, f.typ.union()))
+		if c.IsKey {
+			r.keys = append(r.keys, f)
+			keyFields = append(keyFields, avroFieldSchema(f.name, f.typ.union()))
+		}
+	}
+
+	envelope := map[string]any{
+		"type":      "record",
+		"name":      "Envelope",
+		"namespace": namespace,
+		"fields": []any{
+			map[string]any{"name": "id", "type": map[string]any{"type": "string", "logicalType": "uuid"}},
+			map[string]any{"name": "action", "type": "string"},
+			map[string]any{"name": "lsn", "type": "long"},
+			map[string]any{"name": "xid", "type": "long"},
+			map[string]any{"name": "seq", "type": "long"},
+			map[string]any{"name": "commit_time", "type": map[string]any{"type": "long", "logicalType": "timestamp-micros"}},
+			avroFieldSchema("data", []any{"null", map[string]any{"type": "record", "name": "Value", "fields": nonNil(valueFields)}}),
+			avroFieldSchema("data_old", []any{"null", "Value"}),
+			map[string]any{"name": "unchanged_toast", "type": map[string]any{"type": "array", "items": "string"}, "default": []any{}},
+		},
+	}
+
+	schema, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, err
+	}
+	r.schema = string(schema)
+
+	if len(keyFields) > 0 {
+		key, err := json.Marshal(map[string]any{"type": "record", "name": "Key", "namespace": namespace, "fields": keyFields})
+		if err != nil {
+			return nil, err
+		}
+		r.key = string(key)
+	}
+
+	s.records[sig.String()] = r
+
+	return r, nil
+}
+
+// schemaID registers the schema under the subject once, a new schema of
+// the subject is registered as its next version.
+func (s *avroSerializer) schemaID(subject, schema string) (int, error) {
+	s.mu.Lock()
+	id, ok := s.ids[subject+"\x00"+schema]
+	s.mu.Unlock()
+
+	if ok {
+		return id, nil
+	}
+
+	id, err := s.registry.Register(subject, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.ids[subject+"\x00"+schema] = id
+	s.mu.Unlock()
+
+	return id, nil
+}
+
+func avroFieldSchema(name string, typ any) map[string]any {
+	return map[string]any{"name": name, "type": typ, "default": nil}
+}
+
+func nonNil(fields []any) []any {
+	if fields == nil {
+		return []any{}
+	}
+
+	return fields
+}
+
+// avroName replaces the characters which are not allowed in Avro names.
+func avroName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+
+	return string(b)
+}
+
+func appendWireHeader(buf []byte, id int) []byte {
+	buf = append(buf, 0)
+	return binary.BigEndian.AppendUint32(buf, uint32(id))
+}
+
+// appendAvroRow writes the nullable row record.
+func appendAvroRow(buf []byte, fields []avroField, row map[string]any) ([]byte, error) {
+	if row == nil {
+		return appendAvroLong(buf, 0), nil
+	}
+
+	buf = appendAvroLong(buf, 1)
+	for _, f := range fields {
+		var err error
+		if buf, err = appendAvroNullable(buf, f.typ, row[f.column]); err != nil {
+			return nil, fmt.Errorf("column %s: %w", f.column, err)
+		}
+	}
+
+	return buf, nil
+}
+
+// appendAvroNullable writes the union of the type, see avroType.union.
+func appendAvroNullable(buf []byte, t *avroType, v any) ([]byte, error) {
+	if v == nil {
+		return appendAvroLong(buf, 0), nil
+	}
+
+	if t.kind == avroDecimal {
+		return appendAvroDecimal(buf, t, v)
+	}
+
+	return appendAvroValue(appendAvroLong(buf, 1), t, v)
+}
+
+// appendAvroDecimal writes the decimal branch of the union, or the string
+// branch when the decimal can't hold the value.
+func appendAvroDecimal(buf []byte, t *avroType, v any) ([]byte, error) {
+	var s string
+	switch d := v.(type) {
+	case string:
+		s = d
+	case json.Number:
+		s = string(d)
+	default:
+		return nil, fmt.Errorf("%T is not a decimal", v)
+	}
+
+	if b, ok := avroDecimalBytes(s, t.precision, t.scale); ok {
+		return appendAvroBytes(appendAvroLong(buf, 1), b), nil
+	}
+
+	return appendAvroString(appendAvroLong(buf, 2), s), nil
+}
+
+func appendAvroValue(buf []byte, t *avroType, v any) ([]byte, error) {
+	switch t.kind {
+	case avroBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%T is not boolean", v)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+
+	case avroInt, avroLong:
+		n, err := avroInteger(t, v)
+		if err != nil {
+			return nil, err
+		}
+		return appendAvroLong(buf, n), nil
+
+	case avroFloat:
+		f, err := avroFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+
+	case avroDouble:
+		f, err := avroFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+
+	case avroBytes:
+		switch b := v.(type) {
+		case []byte:
+			return appendAvroBytes(buf, b), nil
+		case string:
+			return appendAvroBytes(buf, []byte(b)), nil
+		}
+		return nil, fmt.Errorf("%T is not bytes", v)
+
+	case avroArray:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%T is not an array", v)
+		}
+		if len(items) > 0 {
+			buf = appendAvroLong(buf, int64(len(items)))
+			for _, item := range items {
+				if _, nested := item.([]any); nested {
+					return nil, errors.New("multi-dimensional arrays are not supported")
+				}
+				var err error
+				if buf, err = appendAvroNullable(buf, t.items, item); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return appendAvroLong(buf, 0), nil
+
+	default:
+		switch s := v.(type) {
+		case string:
+			return appendAvroString(buf, s), nil
+		case fmt.Stringer:
+			return appendAvroString(buf, s.String()), nil
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return appendAvroBytes(buf, b), nil
+	}
+}
+
+// avroInteger converts the value to the int or long type. The ±infinity of
+// dates and timestamps are the maximum and the minimum of the type, other
+// values out of the range of the type are an error.
+func avroInteger(t *avroType, v any) (int64, error) {
+	lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+	if t.kind == avroInt {
+		lo, hi = math.MinInt32, math.MaxInt32
+	}
+
+	switch v {
+	case "infinity":
+		return hi, nil
+	case "-infinity":
+		return lo, nil
+	}
+
+	n, err := avroInt64(v)
+	if err != nil {
+		return 0, err
+	}
+	if t.divisor != 0 {
+		n /= t.divisor
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("%d is out of the range of %s", n, avroKindNames[t.kind])
+	}
+
+	return n, nil
+}
+
+// avroInt64 converts integers and epoch values.
+func avroInt64(v any) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint32:
+		return int64(n), nil
+	case uint64:
+		if n > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows long", n)
+		}
+		return int64(n), nil
+	case json.Number:
+		return n.Int64()
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	}
+
+	return 0, fmt.Errorf("%T is not an integer", v)
+}
+
+// avroFloat64 converts numbers, NaN and ±Infinity strings are parsed.
+func avroFloat64(v any) (float64, error) {
+	switch f := v.(type) {
+	case float32:
+		return float64(f), nil
+	case float64:
+		return f, nil
+	case int:
+		return float64(f), nil
+	case int64:
+		return float64(f), nil
+	case json.Number:
+		return f.Float64()
+	case string:
+		return strconv.ParseFloat(f, 64)
+	}
+
+	return 0, fmt.Errorf("%T is not a number", v)
+}
+
+// avroDecimalBytes returns the unscaled value as big-endian two's complement.
+// It reports false for NaN, ±Infinity and the values with more digits than
+// the precision or the scale.
+func avroDecimalBytes(s string, precision, scale int) ([]byte, bool) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, false
+	}
+
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !r.IsInt() {
+		return nil, false
+	}
+
+	n := r.Num()
+	if len(new(big.Int).Abs(n).String()) > precision {
+		return nil, false
+	}
+
+	size := n.BitLen()/8 + 1
+	if n.Sign() >= 0 {
+		return n.FillBytes(make([]byte, size)), true
+	}
+
+	m := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+	return m.Add(m, n).FillBytes(make([]byte, size)), true
+}
+
+// appendAvroLong writes zig-zag varint.
+func appendAvroLong(buf []byte, n int64) []byte {
+	return binary.AppendUvarint(buf, uint64(n<<1)^uint64(n>>63))
+}
+
+func appendAvroBytes(buf []byte, b []byte) []byte {
+	return append(appendAvroLong(buf, int64(len(b))), b...)
+}
+
+func appendAvroString(buf []byte, s string) []byte {
+	return append(appendAvroLong(buf, int64(len(s))), s...)
+}
+
+// appendAvroStrings writes the array of strings in one block.
+func appendAvroStrings(buf []byte, items []string) []byte {
+	if len(items) > 0 {
+		buf = appendAvroLong(buf, int64(len(items)))
+		for _, item := range items {
+			buf = appendAvroString(buf, item)
+		}
+	}
+
+	return appendAvroLong(buf, 0)
+}
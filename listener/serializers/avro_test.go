@@ -0,0 +1,222 @@
+package serializers
+
+import (
+	"ditto/common"
+	"ditto/models"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// numeric(10,2) typmod
+const numeric10x2 = (10<<16 | 2) + 4
+
+// avroEvent returns the UPDATE of an orders row with an unchanged TOAST column.
+func avroEvent(total any) models.Event {
+	return models.Event{
+		ID:        models.EventID(0x16B374D848, 0),
+		LSN:       0x16B374D848,
+		XID:       1042,
+		Schema:    "public",
+		Table:     "orders",
+		Action:    string(models.ActionKindUpdate),
+		EventTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Data:      map[string]any{"id": int32(7), "total": total, "tags": []any{"a", nil}},
+		Key:       map[string]any{"id": int32(7)},
+		Columns: []models.ColumnType{
+			{Name: "id", TypeOID: common.Int4OID, TypeModifier: -1, IsKey: true},
+			{Name: "total", TypeOID: common.Numeric, TypeModifier: numeric10x2},
+			{Name: "tags", TypeOID: 1009, TypeModifier: -1},
+			{Name: "note", TypeOID: common.TextOID, TypeModifier: -1},
+		},
+		UnchangedToast: []string{"note"},
+	}
+}
+
+// decodeAvro decodes the message in the Confluent wire format with the
+// schema from the registry.
+func decodeAvro(t *testing.T, registry *MemorySchemaRegistry, msg []byte) map[string]any {
+	t.Helper()
+
+	if len(msg) < 5 || msg[0] != 0 {
+		t.Fatalf("no wire header in % x", msg)
+	}
+	schema, ok := registry.Schema(int(binary.BigEndian.Uint32(msg[1:5])))
+	if !ok {
+		t.Fatalf("schema %d is not registered", binary.BigEndian.Uint32(msg[1:5]))
+	}
+
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		t.Fatalf("invalid schema: %v\n%s", err, schema)
+	}
+
+	native, rest, err := codec.NativeFromBinary(msg[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("%d bytes after the record", len(rest))
+	}
+
+	return native.(map[string]any)
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		total any
+		want  any
+	}{
+		{name: "decimal", total: "12.50", want: map[string]any{"bytes.decimal": big.NewRat(25, 2)}},
+		{name: "negative decimal", total: "-0.01", want: map[string]any{"bytes.decimal": big.NewRat(-1, 100)}},
+		{name: "NaN", total: "NaN", want: map[string]any{"string": "NaN"}},
+		{name: "Infinity", total: "Infinity", want: map[string]any{"string": "Infinity"}},
+		{name: "over the scale", total: "1.005", want: map[string]any{"string": "1.005"}},
+		{name: "over the precision", total: "123456789.5", want: map[string]any{"string": "123456789.5"}},
+		{name: "null", total: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewMemorySchemaRegistry()
+			s, err := New(Config{Format: FormatAvro}, Options{SchemaRegistry: registry})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := s.Serialize("ditto.orders", avroEvent(tt.total))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			value := decodeAvro(t, registry, msg.Value)
+			if value["action"] != "UPDATE" || value["xid"] != int64(1042) {
+				t.Errorf("got envelope %v", value)
+			}
+			if got := value["unchanged_toast"]; !reflect.DeepEqual(got, []any{"note"}) {
+				t.Errorf("got unchanged_toast %v", got)
+			}
+			if value["data_old"] != nil {
+				t.Errorf("got data_old %v", value["data_old"])
+			}
+
+			data := value["data"].(map[string]any)["ditto.public.orders.Value"].(map[string]any)
+			if got := data["total"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got total %#v, want %#v", got, tt.want)
+			}
+			if got := data["id"]; !reflect.DeepEqual(got, map[string]any{"int": int32(7)}) {
+				t.Errorf("got id %#v", got)
+			}
+			if got := data["tags"]; !reflect.DeepEqual(got, map[string]any{"array": []any{map[string]any{"string": "a"}, nil}}) {
+				t.Errorf("got tags %#v", got)
+			}
+
+			key := decodeAvro(t, registry, msg.Key)
+			if got := key["id"]; !reflect.DeepEqual(got, map[string]any{"int": int32(7)}) {
+				t.Errorf("got key %#v", got)
+			}
+		})
+	}
+}
+
+func TestAvroNameCollision(t *testing.T) {
+	event := avroEvent("1.00")
+	event.Columns = append(event.Columns,
+		models.ColumnType{Name: "unit_price", TypeOID: common.TextOID, TypeModifier: -1},
+		models.ColumnType{Name: "unit price", TypeOID: common.TextOID, TypeModifier: -1})
+
+	s, err := New(Config{Format: FormatAvro}, Options{SchemaRegistry: NewMemorySchemaRegistry()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Serialize("ditto.orders", event)
+	if err == nil || !strings.Contains(err.Error(), `"unit price"`) {
+		t.Fatalf("got %v, want the name collision", err)
+	}
+	if errors.Is(err, ErrSkipEvent) {
+		t.Fatal("the collision is not a skipped event")
+	}
+}
+
+func TestAvroInteger(t *testing.T) {
+	date := &avroType{kind: avroInt, logical: "date", divisor: 86_400_000_000}
+	tests := []struct {
+		name    string
+		typ     *avroType
+		value   any
+		want    int64
+		wantErr bool
+	}{
+		{name: "int", typ: &avroType{kind: avroInt}, value: int32(-5), want: -5},
+		{name: "int out of range", typ: &avroType{kind: avroInt}, value: int64(1 << 31), wantErr: true},
+		{name: "long", typ: &avroType{kind: avroLong}, value: "9007199254740993", want: 9007199254740993},
+		{name: "date", typ: date, value: int64(86_400_000_000 * 3), want: 3},
+		{name: "date infinity", typ: date, value: "infinity", want: 1<<31 - 1},
+		{name: "date -infinity", typ: date, value: "-infinity", want: -1 << 31},
+		{name: "timestamp infinity", typ: &avroType{kind: avroLong}, value: "infinity", want: 1<<63 - 1},
+		{name: "not a number", typ: &avroType{kind: avroLong}, value: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := avroInteger(tt.typ, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvroTransformedColumn(t *testing.T) {
+	var watchList map[string]models.WatchConfig
+	if err := yaml.Unmarshal([]byte(`orders: {transforms: {total: {type: mask, keep: 2}}}`), &watchList); err != nil {
+		t.Fatal(err)
+	}
+	if err := watchList["orders"].Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	commit := time.Now()
+	w := models.NewWalTransaction()
+	w.CommitTime = &commit
+	w.RelationStore[1] = models.RelationData{Schema: "public", Table: "orders", Replica: 'd', Columns: []models.Column{
+		{Name: "id", ValueType: common.Int4OID, ValueModifier: -1, IsKey: true},
+		{Name: "total", ValueType: common.Numeric, ValueModifier: numeric10x2},
+	}}
+	a, err := w.CreateActionData(1, nil, []common.TupleData{
+		{Kind: common.TextDataType, Value: []byte("7")},
+		{Kind: common.TextDataType, Value: []byte("12.50")},
+	}, models.ActionKindInsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Actions = append(w.Actions, a)
+
+	registry := NewMemorySchemaRegistry()
+	s, err := New(Config{Format: FormatAvro}, Options{SchemaRegistry: registry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := s.Serialize("ditto.orders", w.CreateEventsWithWatchList(watchList)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the masked numeric is a string of the schema instead of a decimal
+	data := decodeAvro(t, registry, msg.Value)["data"].(map[string]any)["ditto.public.orders.Value"].(map[string]any)
+	if got := data["total"]; !reflect.DeepEqual(got, map[string]any{"string": "***50"}) {
+		t.Errorf("got total %#v", got)
+	}
+}
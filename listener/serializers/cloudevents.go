@@ -0,0 +1,135 @@
+package serializers
+
+import (
+	"ditto/models"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const contentTypeCloudEvents = "application/cloudevents+json"
+
+// CloudEventsMode content mode of the CloudEvents messages.
+type CloudEventsMode string
+
+// kind of CloudEvents mode.
+const (
+	// CloudEventsStructured puts the attributes and the event into one JSON document.
+	CloudEventsStructured CloudEventsMode = "structured"
+	// CloudEventsBinary puts the attributes into ce-* headers and the event into the value.
+	CloudEventsBinary CloudEventsMode = "binary"
+)
+
+// CloudEventsConfig config of the CloudEvents output format.
+type CloudEventsConfig struct {
+	Mode CloudEventsMode `yaml:"mode"` // "structured" by default
+	// Source prefix of the source attribute, "ditto/<database>" by default.
+	Source string `yaml:"source"`
+}
+
+// cloudEvent CloudEvents 1.0 envelope in structured mode.
+type cloudEvent struct {
+	SpecVersion     string       `json:"specversion"`
+	ID              string       `json:"id"`
+	Source          string       `json:"source"`
+	Type            string       `json:"type"`
+	Subject         string       `json:"subject,omitempty"`
+	Time            string       `json:"time"`
+	DataContentType string       `json:"datacontenttype"`
+	Data            models.Event `json:"data"`
+}
+
+// cloudEventsSerializer wraps the events in CloudEvents 1.0 envelope.
+type cloudEventsSerializer struct {
+	mode   CloudEventsMode
+	source string
+}
+
+func newCloudEventsSerializer(cfg CloudEventsConfig, opts Options) (*cloudEventsSerializer, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = CloudEventsStructured
+	case CloudEventsStructured, CloudEventsBinary:
+	default:
+		return nil, fmt.Errorf("unsupported cloudevents mode: %s", cfg.Mode)
+	}
+
+	source := cfg.Source
+	if source == "" {
+		source = "ditto/" + opts.Database
+	}
+
+	return &cloudEventsSerializer{mode: cfg.Mode, source: strings.TrimSuffix(source, "/")}, nil
+}
+
+func (s *cloudEventsSerializer) Serialize(_ string, event models.Event) (models.Message, error) {
+	ce := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              event.ID.String(),
+		Source:          s.eventSource(event),
+		Type:            eventType(event),
+		Time:            event.EventTime.UTC().Format(time.RFC3339Nano),
+		DataContentType: contentTypeJSON,
+		Data:            event,
+	}
+
+	key, err := messageKey(event)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	if s.mode == CloudEventsStructured {
+		value, err := json.Marshal(ce)
+		if err != nil {
+			return models.Message{}, fmt.Errorf("marshal cloudevent failed: %w", err)
+		}
+
+		return models.Message{Key: key, Value: value, ContentType: contentTypeCloudEvents}, nil
+	}
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		return models.Message{}, fmt.Errorf("marshal event failed: %w", err)
+	}
+
+	return models.Message{
+		Key:         key,
+		Value:       value,
+		ContentType: contentTypeJSON,
+		Headers: map[string]string{
+			"ce-specversion": ce.SpecVersion,
+			"ce-id":          ce.ID,
+			"ce-source":      ce.Source,
+			"ce-type":        ce.Type,
+			"ce-time":        ce.Time,
+			"content-type":   contentTypeJSON,
+		},
+	}, nil
+}
+
+// RequiresHeaders reports true in binary mode, the attributes are lost without headers.
+func (s *cloudEventsSerializer) RequiresHeaders() bool {
+	return s.mode == CloudEventsBinary
+}
+
+// eventSource returns source of the event, e.g. ditto/bank/public.deposit_events.
+func (s *cloudEventsSerializer) eventSource(event models.Event) string {
+	if event.Table == "" {
+		return s.source
+	}
+
+	return s.source + "/" + event.Schema + "." + event.Table
+}
+
+// eventType returns type of the event, e.g. ditto.deposit_events.insert,
+// or ditto.ddl for the events which are not bound to a table.
+func eventType(event models.Event) string {
+	action := strings.ToLower(event.Action)
+	if event.Table == "" {
+		return "ditto." + action
+	}
+
+	return "ditto." + event.Table + "." + action
+}
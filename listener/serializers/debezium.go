@@ -0,0 +1,184 @@
+package serializers
+
+import (
+	"ditto/models"
+	"fmt"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+// debeziumUnavailableValue placeholder of unchanged TOAST values, the same as
+// the default unavailable.value.placeholder of Debezium.
+const debeziumUnavailableValue = "__debezium_unavailable_value"
+
+// DebeziumConfig config of the Debezium output format.
+type DebeziumConfig struct {
+	// ServerName name of the source block, the database name by default.
+	ServerName string `yaml:"server_name"`
+}
+
+// debeziumSource source block of the change event.
+type debeziumSource struct {
+	Connector string `json:"connector"`
+	Name      string `json:"name"`
+	TsMs      int64  `json:"ts_ms"`
+	Snapshot  string `json:"snapshot"`
+	DB        string `json:"db"`
+	Schema    string `json:"schema"`
+	Table     string `json:"table"`
+	TxID      uint32 `json:"txId"`
+	LSN       int64  `json:"lsn"`
+}
+
+// debeziumEnvelope change event without the schema (schemas.enable=false).
+type debeziumEnvelope struct {
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after"`
+	Source debeziumSource `json:"source"`
+	Op     string         `json:"op"`
+	TsMs   int64          `json:"ts_ms"`
+}
+
+// debeziumTransaction event of the Debezium transaction topic.
+type debeziumTransaction struct {
+	Status          string                   `json:"status"`
+	ID              string                   `json:"id"`
+	EventCount      *int                     `json:"event_count"`
+	DataCollections []debeziumDataCollection `json:"data_collections"`
+	TsMs            int64                    `json:"ts_ms"`
+}
+
+type debeziumDataCollection struct {
+	DataCollection string `json:"data_collection"`
+	EventCount     int    `json:"event_count"`
+}
+
+// debeziumOps operation codes of the row actions.
+var debeziumOps = map[string]string{
+	string(models.ActionKindInsert):   "c",
+	string(models.ActionKindUpdate):   "u",
+	string(models.ActionKindDelete):   "d",
+	string(models.ActionKindTruncate): "t",
+}
+
+// debeziumSerializer writes events in the format of the Debezium PostgreSQL connector.
+type debeziumSerializer struct {
+	name     string
+	database string
+}
+
+func newDebeziumSerializer(cfg DebeziumConfig, opts Options) *debeziumSerializer {
+	name := cfg.ServerName
+	if name == "" {
+		name = opts.Database
+	}
+
+	return &debeziumSerializer{name: name, database: opts.Database}
+}
+
+func (s *debeziumSerializer) Serialize(_ string, event models.Event) (models.Message, error) {
+	switch event.Action {
+	case string(models.ActionKindBegin), string(models.ActionKindCommit):
+		return s.serializeTransaction(event)
+	}
+
+	op, ok := debeziumOps[event.Action]
+	if !ok {
+		return models.Message{}, fmt.Errorf("%w: %s has no debezium representation", ErrSkipEvent, event.Action)
+	}
+
+	env := debeziumEnvelope{
+		Source: debeziumSource{
+			Connector: "postgresql",
+			Name:      s.name,
+			TsMs:      event.EventTime.UnixMilli(),
+			Snapshot:  "false",
+			DB:        s.database,
+			Schema:    event.Schema,
+			Table:     event.Table,
+			TxID:      event.XID,
+			LSN:       event.LSN,
+		},
+		Op:   op,
+		TsMs: time.Now().UnixMilli(),
+	}
+
+	switch event.Action {
+	case string(models.ActionKindInsert):
+		env.After = debeziumRow(event.Data, event.UnchangedToast)
+	case string(models.ActionKindUpdate):
+		env.After = debeziumRow(event.Data, event.UnchangedToast)
+		if len(event.DataOld) > 0 {
+			env.Before = event.DataOld
+		}
+	case string(models.ActionKindDelete):
+		env.Before = event.DataOld
+	}
+
+	value, err := json.Marshal(env)
+	if err != nil {
+		return models.Message{}, fmt.Errorf("marshal debezium event failed: %w", err)
+	}
+
+	key, err := messageKey(event)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	return models.Message{Key: key, Value: value, ContentType: contentTypeJSON}, nil
+}
+
+// serializeTransaction writes BEGIN and COMMIT markers as the events of the
+// Debezium transaction topic, COMMIT is the END status.
+func (s *debeziumSerializer) serializeTransaction(event models.Event) (models.Message, error) {
+	tx := debeziumTransaction{
+		Status: "BEGIN",
+		ID:     fmt.Sprintf("%d:%d", event.XID, event.LSN),
+		TsMs:   event.EventTime.UnixMilli(),
+	}
+
+	if event.Transaction != nil {
+		tx.Status = "END"
+		tx.EventCount = &event.Transaction.EventCount
+		for _, t := range event.Transaction.Tables {
+			tx.DataCollections = append(tx.DataCollections, debeziumDataCollection{
+				DataCollection: t.Table,
+				EventCount:     t.EventCount,
+			})
+		}
+	}
+
+	value, err := json.Marshal(tx)
+	if err != nil {
+		return models.Message{}, fmt.Errorf("marshal debezium transaction failed: %w", err)
+	}
+
+	key, err := json.Marshal(map[string]string{"id": tx.ID})
+	if err != nil {
+		return models.Message{}, fmt.Errorf("marshal debezium key failed: %w", err)
+	}
+
+	return models.Message{Key: key, Value: value, ContentType: contentTypeJSON}, nil
+}
+
+func (s *debeziumSerializer) RequiresHeaders() bool {
+	return false
+}
+
+// debeziumRow returns the row with the placeholder for unchanged TOAST values.
+func debeziumRow(data map[string]any, unchangedToast []string) map[string]any {
+	if len(unchangedToast) == 0 {
+		return data
+	}
+
+	row := make(map[string]any, len(data)+len(unchangedToast))
+	for k, v := range data {
+		row[k] = v
+	}
+	for _, name := range unchangedToast {
+		row[name] = debeziumUnavailableValue
+	}
+
+	return row
+}
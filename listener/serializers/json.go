@@ -0,0 +1,46 @@
+package serializers
+
+import (
+	"ditto/models"
+	"fmt"
+
+	"github.com/goccy/go-json"
+)
+
+const contentTypeJSON = "application/json"
+
+// jsonSerializer writes the event as is.
+type jsonSerializer struct{}
+
+func (jsonSerializer) Serialize(_ string, event models.Event) (models.Message, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return models.Message{}, fmt.Errorf("marshal event failed: %w", err)
+	}
+
+	key, err := messageKey(event)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	return models.Message{Key: key, Value: value, ContentType: contentTypeJSON}, nil
+}
+
+func (jsonSerializer) RequiresHeaders() bool {
+	return false
+}
+
+// messageKey returns the key of the event in JSON, e.g. {"id":1}, it is nil
+// for the events without a key.
+func messageKey(event models.Event) ([]byte, error) {
+	if len(event.Key) == 0 {
+		return nil, nil
+	}
+
+	key, err := json.Marshal(event.Key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal event key failed: %w", err)
+	}
+
+	return key, nil
+}
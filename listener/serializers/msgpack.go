@@ -0,0 +1,255 @@
+package serializers
+
+import (
+	"bytes"
+	"ditto/common"
+	"ditto/models"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/goccy/go-json"
+)
+
+const contentTypeMsgpack = "application/msgpack"
+
+// msgpackSerializer writes events as MessagePack maps with the keys of the JSON format.
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) Serialize(_ string, event models.Event) (models.Message, error) {
+	envelope, err := jsonValue(event)
+	if err != nil {
+		return models.Message{}, fmt.Errorf("marshal event failed: %w", err)
+	}
+
+	// column values keep their decoded types, e.g. bytea stays binary
+	types := columnTypes(event.Columns)
+	fields := envelope.(map[string]any)
+	fields["data"] = msgpackRow{row: event.Data, types: types}
+	fields["dataOld"] = msgpackRow{row: event.DataOld, types: types}
+	if event.Key != nil {
+		fields["key"] = msgpackRow{row: event.Key, types: types}
+	}
+
+	value, err := appendMsgpack(nil, fields)
+	if err != nil {
+		return models.Message{}, fmt.Errorf("marshal event failed: %w", err)
+	}
+
+	key, err := messageKey(event)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	return models.Message{Key: key, Value: value, ContentType: contentTypeMsgpack}, nil
+}
+
+func (msgpackSerializer) RequiresHeaders() bool {
+	return false
+}
+
+// msgpackRow row of the event with the types of its columns.
+type msgpackRow struct {
+	row   map[string]any
+	types map[string]uint32
+}
+
+func columnTypes(columns []models.ColumnType) map[string]uint32 {
+	types := make(map[string]uint32, len(columns))
+	for _, c := range columns {
+		types[c.Name] = c.TypeOID
+	}
+
+	return types
+}
+
+// jsonValue returns the value as it is seen by JSON consumers, numbers are json.Number.
+func jsonValue(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var out any
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// appendMsgpack encodes the value, keys of the maps are sorted.
+func appendMsgpack(buf []byte, v any) ([]byte, error) {
+	switch val := v.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if val {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case int:
+		return appendMsgpackInt(buf, int64(val)), nil
+	case int32:
+		return appendMsgpackInt(buf, int64(val)), nil
+	case int64:
+		return appendMsgpackInt(buf, val), nil
+	case uint32:
+		return appendMsgpackUint(buf, uint64(val)), nil
+	case uint64:
+		return appendMsgpackUint(buf, val), nil
+	case float32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xca), math.Float32bits(val)), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(val)), nil
+	case json.Number:
+		if n, err := strconv.ParseInt(string(val), 10, 64); err == nil {
+			return appendMsgpackInt(buf, n), nil
+		}
+		if f, err := strconv.ParseFloat(string(val), 64); err == nil {
+			return appendMsgpack(buf, f)
+		}
+		return appendMsgpackString(buf, string(val)), nil
+	case string:
+		return appendMsgpackString(buf, val), nil
+	case []byte:
+		return appendMsgpackBin(buf, val), nil
+	case fmt.Stringer:
+		return appendMsgpackString(buf, val.String()), nil
+	case []any:
+		buf = appendMsgpackHeader(buf, len(val), 0x90, 0xdc)
+		for _, item := range val {
+			var err error
+			if buf, err = appendMsgpack(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case []float32:
+		buf = appendMsgpackHeader(buf, len(val), 0x90, 0xdc)
+		for _, f := range val {
+			buf = binary.BigEndian.AppendUint32(append(buf, 0xca), math.Float32bits(f))
+		}
+		return buf, nil
+	case map[string]any:
+		return appendMsgpackMap(buf, val, nil)
+	case msgpackRow:
+		if val.row == nil {
+			return append(buf, 0xc0), nil
+		}
+		return appendMsgpackMap(buf, val.row, val.types)
+	}
+
+	// the other types are written as they are seen in JSON
+	jv, err := jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendMsgpack(buf, jv)
+}
+
+// appendMsgpackMap writes the map, NUMERIC columns are written as strings
+// to keep their precision.
+func appendMsgpackMap(buf []byte, m map[string]any, types map[string]uint32) ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	buf = appendMsgpackHeader(buf, len(keys), 0x80, 0xde)
+	for _, k := range keys {
+		buf = appendMsgpackString(buf, k)
+
+		v := m[k]
+		if n, ok := v.(json.Number); ok && types[k] == common.Numeric {
+			v = string(n)
+		}
+
+		var err error
+		if buf, err = appendMsgpack(buf, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+	}
+
+	return buf, nil
+}
+
+// appendMsgpackHeader writes the header of the array or the map, fix is the
+// code of the fixarray or the fixmap, code16 is the code of the 16-bit length.
+func appendMsgpackHeader(buf []byte, n int, fix, code16 byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, code16+1), uint32(n))
+	}
+}
+
+func appendMsgpackInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0:
+		return appendMsgpackUint(buf, uint64(n))
+	case n >= -32:
+		return append(buf, byte(n))
+	case n >= math.MinInt8:
+		return append(buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(n))
+	}
+}
+
+func appendMsgpackUint(buf []byte, n uint64) []byte {
+	switch {
+	case n < 128:
+		return append(buf, byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), n)
+	}
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+
+	return append(buf, s...)
+}
+
+func appendMsgpackBin(buf []byte, b []byte) []byte {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xc5), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xc6), uint32(n))
+	}
+
+	return append(buf, b...)
+}
@@ -0,0 +1,113 @@
+package serializers
+
+import (
+	"ditto/common"
+	"ditto/models"
+	"fmt"
+	"slices"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	contentTypeText  = "text/plain; charset=utf-8"
+	contentTypeBytes = "application/octet-stream"
+)
+
+// outboxSerializer writes the payload of the outbox row as the value, the
+// aggregate ID as the key and the other columns as the headers.
+type outboxSerializer struct {
+	cfg models.OutboxConfig
+}
+
+// NewOutbox creates serializer of the rows of the outbox table.
+func NewOutbox(cfg models.OutboxConfig) Serializer {
+	return outboxSerializer{cfg: cfg}
+}
+
+func (s outboxSerializer) Serialize(_ string, event models.Event) (models.Message, error) {
+	// only inserts reach the serializer, unless a script returned an event without a row
+	if event.Data == nil {
+		return models.Message{}, fmt.Errorf("%w: %s of outbox table %s has no row", ErrSkipEvent, event.Action, event.Table)
+	}
+
+	msg, err := s.payload(event)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	if id := event.Data[s.cfg.AggregateIDColumn]; id != nil {
+		key, err := outboxText(id)
+		if err != nil {
+			return models.Message{}, fmt.Errorf("outbox aggregate ID: %w", err)
+		}
+		msg.Key = []byte(key)
+	}
+
+	msg.Headers = make(map[string]string)
+	for name, v := range event.Data {
+		if v == nil || !s.cfg.IsHeader(name) {
+			continue
+		}
+		if msg.Headers[name], err = outboxText(v); err != nil {
+			return models.Message{}, fmt.Errorf("outbox header %s: %w", name, err)
+		}
+	}
+
+	return msg, nil
+}
+
+// payload returns the value of the message: JSON of json and jsonb payloads,
+// the text of text payloads and the bytes of bytea payloads. A NULL payload
+// is an empty value.
+func (s outboxSerializer) payload(event models.Event) (models.Message, error) {
+	v := event.Data[s.cfg.PayloadColumn]
+	if v == nil {
+		return models.Message{}, nil
+	}
+
+	var oid uint32
+	if i := slices.IndexFunc(event.Columns, func(c models.ColumnType) bool { return c.Name == s.cfg.PayloadColumn }); i >= 0 {
+		oid = event.Columns[i].TypeOID
+	}
+
+	switch p := v.(type) {
+	case []byte:
+		return models.Message{Value: p, ContentType: contentTypeBytes}, nil
+	case string:
+		if oid != common.JSONOID && oid != common.JSONBOID {
+			return models.Message{Value: []byte(p), ContentType: contentTypeText}, nil
+		}
+	}
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		return models.Message{}, fmt.Errorf("marshal outbox payload failed: %w", err)
+	}
+
+	return models.Message{Value: value, ContentType: contentTypeJSON}, nil
+}
+
+// RequiresHeaders reports true, the aggregate ID is sent as the key and the
+// other columns as headers, a publisher without them would drop both.
+func (outboxSerializer) RequiresHeaders() bool {
+	return true
+}
+
+// outboxText returns the text of the key or the header, strings as they are
+// and other values in JSON.
+func outboxText(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case fmt.Stringer:
+		return t.String(), nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,92 @@
+package serializers
+
+import (
+	"ditto/common"
+	"ditto/models"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goccy/go-json"
+)
+
+// outboxEvent returns the insert of an outbox row with the payload of the type.
+func outboxEvent(payload any, oid uint32) models.Event {
+	return models.Event{
+		Schema: "public",
+		Table:  "outbox",
+		Action: string(models.ActionKindInsert),
+		Data: map[string]any{
+			"id":             int64(1),
+			"aggregate_type": "Order",
+			"aggregate_id":   int64(42),
+			"type":           "OrderCreated",
+			"meta":           map[string]any{"v": json.Number("2")},
+			"note":           nil,
+			"payload":        payload,
+		},
+		Columns: []models.ColumnType{
+			{Name: "id", TypeOID: common.Int8OID, TypeModifier: -1, IsKey: true},
+			{Name: "payload", TypeOID: oid, TypeModifier: -1},
+		},
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	cfg := models.OutboxConfig{AggregateTypeColumn: "aggregate_type", AggregateIDColumn: "aggregate_id", PayloadColumn: "payload"}
+
+	tests := []struct {
+		name        string
+		event       models.Event
+		value       string
+		contentType string
+	}{
+		{
+			name:        "jsonb",
+			event:       outboxEvent(map[string]any{"id": json.Number("9007199254740993"), "total": json.Number("2.50")}, common.JSONBOID),
+			value:       `{"id":9007199254740993,"total":2.50}`,
+			contentType: contentTypeJSON,
+		},
+		{name: "json string", event: outboxEvent("a", common.JSONOID), value: `"a"`, contentType: contentTypeJSON},
+		{name: "text", event: outboxEvent(`{"a":1}`, common.TextOID), value: `{"a":1}`, contentType: contentTypeText},
+		{name: "bytea", event: outboxEvent([]byte{0, 1}, common.ByteaOID), value: "\x00\x01", contentType: contentTypeBytes},
+		{name: "null", event: outboxEvent(nil, common.JSONBOID)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := NewOutbox(cfg).Serialize("events.Order", tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(msg.Value) != tt.value || msg.ContentType != tt.contentType {
+				t.Errorf("got value %q of %q, want %q of %q", msg.Value, msg.ContentType, tt.value, tt.contentType)
+			}
+			if string(msg.Key) != "42" {
+				t.Errorf("got key %q", msg.Key)
+			}
+			want := map[string]string{"id": "1", "type": "OrderCreated", "meta": `{"v":2}`}
+			if !reflect.DeepEqual(msg.Headers, want) {
+				t.Errorf("got headers %v, want %v", msg.Headers, want)
+			}
+		})
+	}
+}
+
+func TestOutboxWithoutRow(t *testing.T) {
+	event := outboxEvent(nil, common.JSONBOID)
+	event.Data = nil
+
+	_, err := NewOutbox(models.OutboxConfig{PayloadColumn: "payload"}).Serialize("events", event)
+	if !errors.Is(err, ErrSkipEvent) {
+		t.Fatalf("got error %v, want a skipped event", err)
+	}
+}
+
+func TestOutboxRequiresHeaders(t *testing.T) {
+	// the key and the headers are lost without them
+	if !NewOutbox(models.OutboxConfig{}).RequiresHeaders() {
+		t.Fatal("outbox doesn't require headers")
+	}
+}
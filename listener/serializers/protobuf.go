@@ -0,0 +1,263 @@
+package serializers
+
+import (
+	"ditto/common"
+	"ditto/models"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/goccy/go-json"
+)
+
+const contentTypeProtobuf = "application/x-protobuf; messageType=ditto.v1.Event"
+
+// protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// fields of ditto.v1.Value, see proto/ditto/v1/event.proto.
+const (
+	valueNull = iota + 1
+	valueBool
+	valueInt
+	valueUint
+	valueDouble
+	valueString
+	valueBytes
+	valueDecimal
+	valueJSON
+	valueList
+	valueFloat
+	valueMap
+)
+
+// protobufSerializer writes events as ditto.v1.Event messages.
+type protobufSerializer struct{}
+
+func (protobufSerializer) Serialize(_ string, event models.Event) (models.Message, error) {
+	types := make(map[string]uint32, len(event.Columns))
+	for _, c := range event.Columns {
+		types[c.Name] = c.TypeOID
+	}
+
+	// id goes first, the message always starts with 0x0a
+	buf := appendProtoString(nil, 1, event.ID.String())
+	buf = appendProtoString(buf, 2, event.Schema)
+	buf = appendProtoString(buf, 3, event.Table)
+	buf = appendProtoString(buf, 4, event.Action)
+	buf = appendProtoVarint(buf, 5, uint64(event.LSN))
+	buf = appendProtoVarint(buf, 6, uint64(event.XID))
+	buf = appendProtoVarint(buf, 7, uint64(event.Seq))
+	buf = appendProtoVarint(buf, 8, uint64(event.EventTime.UnixMicro()))
+
+	var err error
+	if buf, err = appendProtoRow(buf, 9, event.Data, types); err != nil {
+		return models.Message{}, err
+	}
+	if buf, err = appendProtoRow(buf, 10, event.DataOld, types); err != nil {
+		return models.Message{}, err
+	}
+
+	for _, name := range event.UnchangedToast {
+		buf = appendProtoString(buf, 11, name)
+	}
+
+	buf = appendProtoVarint(buf, 12, uint64(event.TxIndex))
+	buf = appendProtoVarint(buf, 13, uint64(event.TxTotal))
+	if !event.BeginTime.IsZero() {
+		buf = appendProtoVarint(buf, 14, uint64(event.BeginTime.UnixMicro()))
+	}
+
+	if buf, err = appendProtoJSON(buf, 15, event.SchemaChange); err != nil {
+		return models.Message{}, err
+	}
+	if buf, err = appendProtoJSON(buf, 16, event.DDL); err != nil {
+		return models.Message{}, err
+	}
+	if buf, err = appendProtoJSON(buf, 17, event.Transaction); err != nil {
+		return models.Message{}, err
+	}
+	if buf, err = appendProtoRow(buf, 18, event.Key, types); err != nil {
+		return models.Message{}, err
+	}
+	if event.Changed != nil {
+		var changed []byte
+		for _, name := range event.Changed {
+			changed = appendProtoBytes(changed, 1, []byte(name))
+		}
+		buf = appendProtoBytes(buf, 19, changed)
+	}
+
+	key, err := messageKey(event)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	return models.Message{Key: key, Value: buf, ContentType: contentTypeProtobuf}, nil
+}
+
+func (protobufSerializer) RequiresHeaders() bool {
+	return false
+}
+
+// appendProtoJSON writes the optional object as a JSON string field.
+func appendProtoJSON[T any](buf []byte, field uint64, v *T) ([]byte, error) {
+	if v == nil {
+		return buf, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendProtoBytes(buf, field, b), nil
+}
+
+// appendProtoRow writes the row as map<string, Value> field, keys are sorted
+// so the same row is always encoded the same way.
+func appendProtoRow(buf []byte, field uint64, row map[string]any, types map[string]uint32) ([]byte, error) {
+	names := make([]string, 0, len(row))
+	for name := range row {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		value, err := protoValue(row[name], types[name])
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+
+		entry := appendProtoString(nil, 1, name)
+		entry = appendProtoBytes(entry, 2, value)
+		buf = appendProtoBytes(buf, field, entry)
+	}
+
+	return buf, nil
+}
+
+// protoValue encodes ditto.v1.Value of the decoded column value.
+func protoValue(v any, oid uint32) ([]byte, error) {
+	switch oid {
+	case common.JSONOID, common.JSONBOID:
+		if v != nil {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return appendProtoBytes(nil, valueJSON, b), nil
+		}
+	case common.Numeric:
+		if s, ok := v.(string); ok {
+			return appendProtoBytes(nil, valueDecimal, []byte(s)), nil
+		}
+	}
+
+	switch val := v.(type) {
+	case nil:
+		return appendProtoOneofVarint(nil, valueNull, 1), nil
+	case bool:
+		n := uint64(0)
+		if val {
+			n = 1
+		}
+		return appendProtoOneofVarint(nil, valueBool, n), nil
+	case int:
+		return appendProtoOneofVarint(nil, valueInt, zigzag(int64(val))), nil
+	case int32:
+		return appendProtoOneofVarint(nil, valueInt, zigzag(int64(val))), nil
+	case int64:
+		return appendProtoOneofVarint(nil, valueInt, zigzag(val)), nil
+	case uint32:
+		return appendProtoOneofVarint(nil, valueUint, uint64(val)), nil
+	case uint64:
+		return appendProtoOneofVarint(nil, valueUint, val), nil
+	case float32:
+		buf := appendProtoTag(nil, valueFloat, wireFixed32)
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(val)), nil
+	case float64:
+		buf := appendProtoTag(nil, valueDouble, wireFixed64)
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(val)), nil
+	case json.Number:
+		return appendProtoBytes(nil, valueDecimal, []byte(val)), nil
+	case string:
+		return appendProtoBytes(nil, valueString, []byte(val)), nil
+	case []byte:
+		return appendProtoBytes(nil, valueBytes, val), nil
+	case fmt.Stringer:
+		return appendProtoBytes(nil, valueString, []byte(val.String())), nil
+	case []any:
+		var list []byte
+		for _, item := range val {
+			b, err := protoValue(item, 0)
+			if err != nil {
+				return nil, err
+			}
+			list = appendProtoBytes(list, 1, b)
+		}
+		return appendProtoBytes(nil, valueList, list), nil
+	case []float32:
+		items := make([]any, len(val))
+		for i, f := range val {
+			items[i] = f
+		}
+		return protoValue(items, 0)
+	case map[string]any:
+		m, err := appendProtoRow(nil, 1, val, nil)
+		if err != nil {
+			return nil, err
+		}
+		return appendProtoBytes(nil, valueMap, m), nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendProtoBytes(nil, valueJSON, b), nil
+}
+
+func zigzag(n int64) uint64 {
+	return uint64(n<<1) ^ uint64(n>>63)
+}
+
+func appendProtoTag(buf []byte, field uint64, wire uint64) []byte {
+	return binary.AppendUvarint(buf, field<<3|wire)
+}
+
+// appendProtoVarint writes the varint field, zero is the default and is omitted.
+func appendProtoVarint(buf []byte, field uint64, n uint64) []byte {
+	if n == 0 {
+		return buf
+	}
+
+	return appendProtoOneofVarint(buf, field, n)
+}
+
+// appendProtoOneofVarint writes the varint field even when it is zero, the
+// field of a oneof is present with the default value.
+func appendProtoOneofVarint(buf []byte, field uint64, n uint64) []byte {
+	return binary.AppendUvarint(appendProtoTag(buf, field, wireVarint), n)
+}
+
+func appendProtoBytes(buf []byte, field uint64, b []byte) []byte {
+	buf = binary.AppendUvarint(appendProtoTag(buf, field, wireBytes), uint64(len(b)))
+	return append(buf, b...)
+}
+
+// appendProtoString writes the string field, empty string is the default and is omitted.
+func appendProtoString(buf []byte, field uint64, s string) []byte {
+	if s == "" {
+		return buf
+	}
+
+	return appendProtoBytes(buf, field, []byte(s))
+}
@@ -0,0 +1,167 @@
+package serializers
+
+import (
+	"bytes"
+	"context"
+	"ditto/models"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// eventDescriptor compiles ditto.v1.Event from proto/ditto/v1/event.proto.
+func eventDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{ImportPaths: []string{"../../proto"}},
+	}
+	files, err := compiler.Compile(context.Background(), "ditto/v1/event.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files[0].Messages().ByName("Event")
+}
+
+// checkKnownFields fails when the message or its submessages have unknown
+// fields, which are fields with another number or wire type than in the schema.
+func checkKnownFields(t *testing.T, path string, m protoreflect.Message) {
+	t.Helper()
+
+	if len(m.GetUnknown()) > 0 {
+		t.Errorf("%s has unknown fields % x", path, m.GetUnknown())
+	}
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := path + "." + string(fd.Name())
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+					checkKnownFields(t, name+"["+k.String()+"]", v.Message())
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				for i := range v.List().Len() {
+					checkKnownFields(t, name, v.List().Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			checkKnownFields(t, name, v.Message())
+		}
+		return true
+	})
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	desc := eventDescriptor(t)
+
+	update := avroEvent("12.50")
+	update.DataOld = map[string]any{"id": int32(7), "total": "10.00", "tags": []any{}}
+	update.Changed = []string{"total"}
+	update.TxIndex, update.TxTotal = 1, 2
+
+	events := map[string]models.Event{
+		"types":  typesEvent(t, models.DecodeOptions{}),
+		"epoch":  typesEvent(t, models.DecodeOptions{TimeFormat: models.TimeFormatEpochMicros, NumericFormat: models.NumericFormatNumber}),
+		"update": update,
+	}
+
+	for name, event := range events {
+		t.Run(name, func(t *testing.T) {
+			msg, err := protobufSerializer{}.Serialize("ditto.orders", event)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := dynamicpb.NewMessage(desc)
+			if err := proto.Unmarshal(msg.Value, decoded); err != nil {
+				t.Fatal(err)
+			}
+			checkKnownFields(t, "Event", decoded)
+
+			// the encoder writes fields in order and map entries sorted by key,
+			// the same as the deterministic marshaling of the protobuf library
+			again, err := proto.MarshalOptions{Deterministic: true}.Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, msg.Value) {
+				t.Errorf("re-encoded message differs\ngot  % x\nwant % x", again, msg.Value)
+			}
+
+			get := func(field string) protoreflect.Value {
+				return decoded.Get(desc.Fields().ByName(protoreflect.Name(field)))
+			}
+			if got := get("id").String(); got != event.ID.String() {
+				t.Errorf("got id %s", got)
+			}
+			if got := get("lsn").Int(); got != event.LSN {
+				t.Errorf("got lsn %d", got)
+			}
+			if got := get("data").Map().Len(); got != len(event.Data) {
+				t.Errorf("got %d columns, want %d", got, len(event.Data))
+			}
+			if got := get("unchanged_toast").List().Len(); got != len(event.UnchangedToast) {
+				t.Errorf("got %d unchanged toast columns", got)
+			}
+			if got := get("tx_total").Int(); got != int64(event.TxTotal) {
+				t.Errorf("got tx_total %d", got)
+			}
+		})
+	}
+}
+
+func TestProtobufValues(t *testing.T) {
+	desc := eventDescriptor(t)
+	value := desc.Fields().ByName("data").MapValue().Message()
+
+	tests := []struct {
+		column string
+		kind   protoreflect.Name
+		want   any
+	}{
+		{"c_bool", "bool_value", true},
+		{"c_int2", "int_value", int64(-32768)},
+		{"c_int8", "int_value", int64(9007199254740993)},
+		{"c_float4", "float_value", float32(1.5)},
+		{"c_float8", "double_value", 1.1},
+		{"c_numeric", "decimal_value", "12345678901234567890.50"},
+		{"c_text", "string_value", "abc"},
+		{"c_jsonb", "json_value", `{"a":[1,2.5]}`},
+		{"c_null", "null_value", true},
+	}
+
+	msg, err := protobufSerializer{}.Serialize("ditto.types", typesEvent(t, models.DecodeOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(msg.Value, decoded); err != nil {
+		t.Fatal(err)
+	}
+	data := decoded.Get(desc.Fields().ByName("data")).Map()
+
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			v := data.Get(protoreflect.ValueOfString(tt.column).MapKey())
+			if !v.IsValid() {
+				t.Fatal("column is missing")
+			}
+			m := v.Message()
+			field := m.WhichOneof(value.Oneofs().ByName("kind"))
+			if field == nil || field.Name() != tt.kind {
+				t.Fatalf("got kind %v, want %s", field, tt.kind)
+			}
+			if got := m.Get(field).Interface(); got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
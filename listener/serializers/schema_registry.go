@@ -0,0 +1,147 @@
+package serializers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const contentTypeSchemaRegistry = "application/vnd.schemaregistry.v1+json"
+
+// SchemaRegistry registers schemas under subjects and returns their IDs.
+type SchemaRegistry interface {
+	Register(subject, schema string) (int, error)
+}
+
+// httpSchemaRegistry client of the Confluent-compatible schema registry REST API.
+type httpSchemaRegistry struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewHTTPSchemaRegistry creates registry client, credentials of the basic auth may be given in the url.
+func NewHTTPSchemaRegistry(rawURL string) (SchemaRegistry, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse schema registry url failed: %w", err)
+	}
+
+	r := &httpSchemaRegistry{client: &http.Client{Timeout: 10 * time.Second}}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+		u.User = nil
+	}
+	r.baseURL = strings.TrimRight(u.String(), "/")
+
+	return r, nil
+}
+
+// Register registers the schema, the registry returns the existing ID for a known schema.
+func (r *httpSchemaRegistry) Register(subject, schema string) (int, error) {
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost,
+		r.baseURL+"/subjects/"+url.PathEscape(subject)+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentTypeSchemaRegistry)
+	req.Header.Set("Accept", contentTypeSchemaRegistry)
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("register schema of %s: %w", subject, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("register schema of %s: %w", subject, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("register schema of %s: status %d: %s", subject, resp.StatusCode, respBody)
+	}
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return 0, fmt.Errorf("register schema of %s: %w", subject, err)
+	}
+
+	return result.ID, nil
+}
+
+// MemorySchemaRegistry in-process registry, a stand-in for the schema registry
+// in tests and local runs. It does not check compatibility.
+type MemorySchemaRegistry struct {
+	mu       sync.Mutex
+	ids      map[string]int
+	subjects map[string][]string
+	schemas  []string
+}
+
+// NewMemorySchemaRegistry creates empty registry.
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{
+		ids:      make(map[string]int),
+		subjects: make(map[string][]string),
+	}
+}
+
+// Register returns the same ID for the same schema in any subject, like the schema registry does.
+func (r *MemorySchemaRegistry) Register(subject, schema string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.ids[schema]
+	if !ok {
+		r.schemas = append(r.schemas, schema)
+		id = len(r.schemas)
+		r.ids[schema] = id
+	}
+
+	if !slices.Contains(r.subjects[subject], schema) {
+		r.subjects[subject] = append(r.subjects[subject], schema)
+	}
+
+	return id, nil
+}
+
+// Schema returns the schema by ID.
+func (r *MemorySchemaRegistry) Schema(id int) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id < 1 || id > len(r.schemas) {
+		return "", false
+	}
+
+	return r.schemas[id-1], true
+}
+
+// Versions returns the schemas registered under the subject in order.
+func (r *MemorySchemaRegistry) Versions(subject string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.subjects[subject]...)
+}
@@ -0,0 +1,70 @@
+package serializers
+
+import (
+	"ditto/models"
+	"errors"
+	"fmt"
+)
+
+// ErrSkipEvent is returned for the events which the format can't represent,
+// they are not published.
+var ErrSkipEvent = errors.New("event is skipped by the output format")
+
+// Serializer converts events to the messages of the output format, the topic
+// is given for the formats which register schemas per topic.
+type Serializer interface {
+	Serialize(topic string, event models.Event) (models.Message, error)
+	// RequiresHeaders reports whether the messages can't be sent without headers.
+	RequiresHeaders() bool
+}
+
+// Format output format of the events.
+type Format string
+
+// kind of output format.
+const (
+	FormatJSON        Format = "json"
+	FormatCloudEvents Format = "cloudevents"
+	FormatDebezium    Format = "debezium"
+	FormatAvro        Format = "avro"
+	FormatProtobuf    Format = "protobuf"
+	FormatMsgpack     Format = "msgpack"
+)
+
+// Config config of the output format.
+type Config struct {
+	Format      Format            `yaml:"format"` // "json" by default
+	CloudEvents CloudEventsConfig `yaml:"cloudevents"`
+	Debezium    DebeziumConfig    `yaml:"debezium"`
+	Avro        AvroConfig        `yaml:"avro"`
+}
+
+// Options settings of the source, they are not configured by the user.
+type Options struct {
+	// Database name of the source database.
+	Database string
+	// Decode options of the column values, they define the schema of dates and times.
+	Decode models.DecodeOptions
+	// SchemaRegistry replaces the registry client of the configured url, e.g. with a stand-in.
+	SchemaRegistry SchemaRegistry
+}
+
+// New creates serializer of the configured format.
+func New(cfg Config, opts Options) (Serializer, error) {
+	switch cfg.Format {
+	case "", FormatJSON:
+		return jsonSerializer{}, nil
+	case FormatCloudEvents:
+		return newCloudEventsSerializer(cfg.CloudEvents, opts)
+	case FormatDebezium:
+		return newDebeziumSerializer(cfg.Debezium, opts), nil
+	case FormatAvro:
+		return newAvroSerializer(cfg.Avro, opts)
+	case FormatProtobuf:
+		return protobufSerializer{}, nil
+	case FormatMsgpack:
+		return msgpackSerializer{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", cfg.Format)
+	}
+}
@@ -0,0 +1,193 @@
+package serializers
+
+import (
+	"bytes"
+	"ditto/common"
+	"ditto/models"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+var processingTime = regexp.MustCompile(`(?m)^(  "ts_ms":) \d+`)
+
+// typeSamples one column of every built-in type with its text value.
+var typeSamples = []struct {
+	name  string
+	oid   int
+	value string
+}{
+	{"c_bool", common.BoolOID, "t"},
+	{"c_int2", common.Int2OID, "-32768"},
+	{"c_int4", common.Int4OID, "42"},
+	{"c_int8", common.Int8OID, "9007199254740993"},
+	{"c_oid", common.OIDOID, "16384"},
+	{"c_xid", common.XIDOID, "771"},
+	{"c_cid", common.CIDOID, "3"},
+	{"c_xid8", common.Xid8OID, "12345678901"},
+	{"c_float4", common.Float4OID, "1.5"},
+	{"c_float8", common.Float8OID, "1.1"},
+	{"c_float8_nan", common.Float8OID, "NaN"},
+	{"c_numeric", common.Numeric, "12345678901234567890.50"},
+	{"c_money", common.MoneyOID, "$1,234.50"},
+	{"c_text", common.TextOID, "abc"},
+	{"c_varchar", common.VarcharOID, "abc"},
+	{"c_bpchar", common.BPCharOID, "ab  "},
+	{"c_char", common.CharOID, "a"},
+	{"c_name", common.NameOID, "deposit_events"},
+	{"c_xml", common.XMLOID, "<a/>"},
+	{"c_jsonpath", common.JSONPathOID, `$."a"`},
+	{"c_bytea", common.ByteaOID, `\x48656c6c6f`},
+	{"c_json", common.JSONOID, `{"a": 1}`},
+	{"c_jsonb", common.JSONBOID, `{"a": [1, 2.50]}`},
+	{"c_uuid", common.UUIDOID, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"},
+	{"c_timestamp", common.TimestampOID, "2024-01-02 03:04:05.123456"},
+	{"c_timestamptz", common.TimestamptzOID, "2024-01-02 03:04:05.123456+00"},
+	{"c_date", common.DateOID, "2024-01-02"},
+	{"c_time", common.TimeOID, "12:00:00"},
+	{"c_timetz", common.TimetzOID, "12:00:00+05:30"},
+	{"c_interval", common.IntervalOID, "1 year 2 mons 3 days 04:05:06.5"},
+	{"c_inet", common.InetOID, "192.168.0.1/24"},
+	{"c_cidr", common.CIDROID, "10.0.0.0/8"},
+	{"c_macaddr", common.MacaddrOID, "08:00:2b:01:02:03"},
+	{"c_macaddr8", common.Macaddr8OID, "08:00:2b:01:02:03:04:05"},
+	{"c_bit", common.BitOID, "1010"},
+	{"c_varbit", common.VarbitOID, "101"},
+	{"c_point", common.PointOID, "(1.5,2)"},
+	{"c_lseg", common.LsegOID, "[(0,0),(1,1)]"},
+	{"c_path", common.PathOID, "((0,0),(1,1))"},
+	{"c_box", common.BoxOID, "(1,1),(0,0)"},
+	{"c_polygon", common.PolygonOID, "((0,0),(1,1),(1,0))"},
+	{"c_line", common.LineOID, "{1,-1,0}"},
+	{"c_circle", common.CircleOID, "<(0,0),1>"},
+	{"c_tid", common.TIDOID, "(0,1)"},
+	{"c_pg_lsn", common.PgLSNOID, "16/B374D848"},
+	{"c_txid_snapshot", common.TxidSnapshotOID, "10:20:10,14,15"},
+	{"c_tsvector", common.TSVectorOID, "'a' 'b'"},
+	{"c_tsquery", common.TSQueryOID, "'a' & 'b'"},
+	{"c_regclass", common.RegclassOID, "deposit_events"},
+	{"c_text_array", 1009, `{a,"b c",NULL}`},
+	{"c_int4_array", 1007, "{1,2}"},
+	{"c_int4range", 3904, "[1,10)"},
+	{"c_null", common.TextOID, ""},
+}
+
+// typesEvent returns the INSERT of a row with the type samples.
+func typesEvent(t *testing.T, options models.DecodeOptions) models.Event {
+	t.Helper()
+
+	tx := models.NewWalTransaction()
+	tx.DecodeOptions = options
+	tx.LSN = 0x16B374D848
+	tx.XID = 1042
+	begin := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	commit := begin.Add(time.Millisecond)
+	tx.BeginTime, tx.CommitTime = &begin, &commit
+
+	rel := models.RelationData{Schema: "public", Table: "types", Replica: 'd'}
+	row := make([]common.TupleData, len(typeSamples))
+	for i, s := range typeSamples {
+		rel.Columns = append(rel.Columns, models.Column{Name: s.name, ValueType: s.oid, ValueModifier: -1, IsKey: i == 2})
+		if s.name == "c_null" {
+			row[i] = common.TupleData{Kind: common.NullDataType}
+		} else {
+			row[i] = common.TupleData{Kind: common.TextDataType, Value: []byte(s.value)}
+		}
+	}
+	tx.RelationStore[1] = rel
+
+	action, err := tx.CreateActionData(1, nil, row, models.ActionKindInsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Actions = append(tx.Actions, action)
+
+	events := tx.CreateEvents()
+	if len(events) != 1 {
+		t.Fatalf("got %d events", len(events))
+	}
+
+	return events[0]
+}
+
+// TestTypesGolden compares the messages of the type samples in every output
+// format with the golden files, go test -run TestTypesGolden -update writes them.
+func TestTypesGolden(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		options models.DecodeOptions
+	}{
+		{name: "json", cfg: Config{Format: FormatJSON}},
+		{name: "json_epoch_number", cfg: Config{Format: FormatJSON},
+			options: models.DecodeOptions{TimeFormat: models.TimeFormatEpochMicros, NumericFormat: models.NumericFormatNumber}},
+		{name: "cloudevents", cfg: Config{Format: FormatCloudEvents}},
+		{name: "debezium", cfg: Config{Format: FormatDebezium}},
+		{name: "avro", cfg: Config{Format: FormatAvro}},
+		{name: "protobuf", cfg: Config{Format: FormatProtobuf}},
+		{name: "msgpack", cfg: Config{Format: FormatMsgpack}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewMemorySchemaRegistry()
+			s, err := New(tt.cfg, Options{Database: "app", Decode: tt.options, SchemaRegistry: registry})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := s.Serialize("ditto.types", typesEvent(t, tt.options))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []byte
+			switch tt.cfg.Format {
+			case FormatJSON, FormatCloudEvents, FormatDebezium:
+				var buf bytes.Buffer
+				if err := json.Indent(&buf, msg.Value, "", "  "); err != nil {
+					t.Fatal(err)
+				}
+				// the processing time of the debezium envelope
+				got = processingTime.ReplaceAll(buf.Bytes(), []byte(`$1 0`))
+				got = append(got, '\n')
+			case FormatAvro:
+				schema, _ := registry.Schema(1)
+				var buf bytes.Buffer
+				if err := json.Indent(&buf, []byte(schema), "", "  "); err != nil {
+					t.Fatal(err)
+				}
+				got = append(buf.Bytes(), '\n')
+				got = append(got, hex.Dump(msg.Value)...)
+			default:
+				got = []byte(hex.Dump(msg.Value))
+			}
+
+			golden := filepath.Join("testdata", "types."+tt.name+".golden")
+			if *update {
+				if err := os.MkdirAll("testdata", 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s differs from the golden file, got:\n%s", tt.name, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package listener
+
+import (
+	"context"
+	"ditto/models"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// typeLoader loads data types from pg_type over a regular (non replication) connection.
+type typeLoader struct {
+	mu    sync.Mutex
+	dbDsn string
+	conn  *pgx.Conn
+}
+
+func newTypeLoader(dbDsn string) *typeLoader {
+	return &typeLoader{dbDsn: dbDsn}
+}
+
+// LoadType reads the type with its enum labels or composite attributes.
+func (t *typeLoader) LoadType(oid uint32) (*models.TypeInfo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ctx := context.Background()
+
+	if err := t.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	info := &models.TypeInfo{OID: oid}
+
+	var (
+		kind    string
+		relID   uint32
+		baseOID uint32
+		elemOID uint32
+	)
+
+	query := `
+		SELECT n.nspname, t.typname,
+			CASE WHEN t.typcategory = 'A' AND t.typelem <> 0 THEN 'A' ELSE t.typtype::text END,
+			t.typbasetype, t.typrelid,
+			CASE
+				WHEN t.typcategory = 'A' THEN t.typelem
+				WHEN t.typtype = 'r' THEN (SELECT rngsubtype FROM pg_range WHERE rngtypid = t.oid)
+				WHEN t.typtype = 'm' THEN (SELECT rngtypid FROM pg_range WHERE rngmultitypid = t.oid)
+				ELSE 0
+			END
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE t.oid = $1;
+	`
+	if err := t.conn.QueryRow(ctx, query, oid).Scan(&info.Namespace, &info.Name, &kind, &baseOID, &relID, &elemOID); err != nil {
+		return nil, err
+	}
+
+	info.Kind = models.TypeKind(kind[0])
+	info.BaseOID = baseOID
+	info.ElemOID = elemOID
+
+	switch info.Kind {
+	case models.TypeKindEnum:
+		rows, err := t.conn.Query(ctx, "SELECT enumlabel FROM pg_enum WHERE enumtypid = $1 ORDER BY enumsortorder;", oid)
+		if err != nil {
+			return nil, err
+		}
+		info.Labels, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+
+	case models.TypeKindComposite:
+		query := `
+			SELECT attname, atttypid
+			FROM pg_attribute
+			WHERE attrelid = $1 AND attnum > 0 AND NOT attisdropped
+			ORDER BY attnum;
+		`
+		rows, err := t.conn.Query(ctx, query, relID)
+		if err != nil {
+			return nil, err
+		}
+		info.Fields, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.TypeField, error) {
+			var f models.TypeField
+			err := row.Scan(&f.Name, &f.TypeOID)
+			return f, err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+// FormatText sends the binary value back as a parameter of its type and reads
+// it as text, so it is rendered by the output function of the type. The
+// connection has the same role and database as the replication one, hence
+// the same lc_monetary and search_path as the walsender in text mode.
+func (t *typeLoader) FormatText(oid uint32, src []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ctx := context.Background()
+
+	if err := t.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	result := t.conn.PgConn().ExecParams(ctx, "SELECT $1::text;",
+		[][]byte{src}, []uint32{oid}, []int16{pgtype.BinaryFormatCode}, []int16{pgtype.TextFormatCode}).Read()
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	if len(result.Rows) != 1 || len(result.Rows[0]) != 1 {
+		return nil, fmt.Errorf("unexpected result of type %d formatting", oid)
+	}
+
+	return result.Rows[0][0], nil
+}
+
+// connect opens the connection when it is not open.
+func (t *typeLoader) connect(ctx context.Context) error {
+	if t.conn != nil && !t.conn.IsClosed() {
+		return nil
+	}
+
+	sqlDsn := strings.ReplaceAll(t.dbDsn, "replication=database", "")
+	conn, err := pgx.Connect(ctx, sqlDsn)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	t.conn = conn
+
+	return nil
+}
+
+// Close closes the connection of the loader.
+func (t *typeLoader) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return nil
+	}
+
+	return t.conn.Close(context.Background())
+}
@@ -0,0 +1,493 @@
+package models
+
+import (
+	"bytes"
+	"ditto/common"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// elementType returns kind of the container type (array, range or multirange)
+// and the oid of its element. Multirange element is its range type.
+func (d *decoder) elementType(oid uint32) (TypeKind, uint32, bool) {
+	if t, ok := pgTypeMap.TypeForOID(oid); ok {
+		switch c := t.Codec.(type) {
+		case *pgtype.ArrayCodec:
+			return TypeKindArray, c.ElementType.OID, true
+		case *pgtype.RangeCodec:
+			return TypeKindRange, c.ElementType.OID, true
+		case *pgtype.MultirangeCodec:
+			return TypeKindMultirange, c.ElementType.OID, true
+		}
+		return 0, 0, false
+	}
+
+	if d == nil || d.types == nil {
+		return 0, 0, false
+	}
+
+	info, err := d.types.Lookup(oid)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	switch info.Kind {
+	case TypeKindArray, TypeKindRange, TypeKindMultirange:
+		return info.Kind, info.ElemOID, info.ElemOID != 0
+	}
+
+	return 0, 0, false
+}
+
+// decodeContainerText converts text of an array, range or multirange.
+func (d *decoder) decodeContainerText(kind TypeKind, elem uint32, src []byte) (any, error) {
+	switch kind {
+	case TypeKindArray:
+		return d.decodeArray(elem, src)
+	case TypeKindRange:
+		return d.decodeRange(elem, src)
+	default:
+		return d.decodeMultirange(elem, src)
+	}
+}
+
+// decodeContainerBinary converts binary array, range or multirange.
+func (d *decoder) decodeContainerBinary(kind TypeKind, elem uint32, src []byte) (any, error) {
+	switch kind {
+	case TypeKindArray:
+		return d.decodeBinaryArray(src)
+	case TypeKindRange:
+		return d.decodeBinaryRange(elem, src)
+	default:
+		return d.decodeBinaryMultirange(elem, src)
+	}
+}
+
+// decodeArray converts array literal, e.g. {{1,2},{NULL,4}}, to nested slices.
+func (d *decoder) decodeArray(elem uint32, src []byte) (any, error) {
+	// skip dimension decoration, e.g. [0:1]={1,2}
+	if len(src) > 0 && src[0] == '[' {
+		i := bytes.IndexByte(src, '=')
+		if i < 0 {
+			return nil, errors.New("malformed array dimensions")
+		}
+		src = src[i+1:]
+	}
+
+	delim := byte(',')
+	if elem == common.BoxOID {
+		delim = ';'
+	}
+
+	p := arrayParser{src: src, delim: delim}
+	val, err := p.parse(d, elem)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(src) {
+		return nil, fmt.Errorf("unexpected %q after array at %d", src[p.pos:], p.pos)
+	}
+
+	return val, nil
+}
+
+type arrayParser struct {
+	src   []byte
+	pos   int
+	delim byte
+}
+
+func (p *arrayParser) parse(d *decoder, elem uint32) ([]any, error) {
+	if p.pos >= len(p.src) || p.src[p.pos] != '{' {
+		return nil, fmt.Errorf("expected '{' at %d", p.pos)
+	}
+	p.pos++
+
+	items := make([]any, 0)
+
+	if p.pos < len(p.src) && p.src[p.pos] == '}' {
+		p.pos++
+		return items, nil
+	}
+
+	for {
+		if p.pos >= len(p.src) {
+			return nil, errors.New("unterminated array")
+		}
+
+		var (
+			item any
+			err  error
+		)
+
+		if p.src[p.pos] == '{' {
+			item, err = p.parse(d, elem)
+		} else {
+			item, err = p.element(d, elem)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		if p.pos >= len(p.src) {
+			return nil, errors.New("unterminated array")
+		}
+
+		switch p.src[p.pos] {
+		case p.delim:
+			p.pos++
+		case '}':
+			p.pos++
+			return items, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", p.src[p.pos], p.pos)
+		}
+	}
+}
+
+func (p *arrayParser) element(d *decoder, elem uint32) (any, error) {
+	var (
+		buf    []byte
+		quoted bool
+	)
+
+	if p.src[p.pos] == '"' {
+		quoted = true
+		p.pos++
+	}
+
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+
+		if quoted && c == '"' {
+			p.pos++
+			break
+		}
+		if !quoted && (c == p.delim || c == '}') {
+			break
+		}
+		if c == '\\' && p.pos+1 < len(p.src) {
+			p.pos++
+			c = p.src[p.pos]
+		}
+
+		buf = append(buf, c)
+		p.pos++
+	}
+
+	if !quoted && bytes.EqualFold(buf, []byte("NULL")) {
+		return nil, nil
+	}
+
+	if buf == nil {
+		buf = []byte{}
+	}
+
+	val, err := d.decodeText(elem, buf)
+	if err != nil && !errors.Is(err, errUnknownOIDType) {
+		return nil, err
+	}
+
+	return val, nil
+}
+
+// decodeRange converts range literal, e.g. [1,10), to an object with its bounds.
+func (d *decoder) decodeRange(elem uint32, src []byte) (any, error) {
+	if string(src) == "empty" {
+		return map[string]any{"empty": true}, nil
+	}
+
+	if len(src) < 3 {
+		return nil, fmt.Errorf("malformed range %q", src)
+	}
+
+	lowerInc := src[0] == '['
+	upperInc := src[len(src)-1] == ']'
+	if (!lowerInc && src[0] != '(') || (!upperInc && src[len(src)-1] != ')') {
+		return nil, fmt.Errorf("malformed range %q", src)
+	}
+
+	// bounds are quoted the same way as the fields of a record
+	rec := make([]byte, 0, len(src))
+	rec = append(rec, '(')
+	rec = append(rec, src[1:len(src)-1]...)
+	rec = append(rec, ')')
+
+	bounds, err := parseRecord(rec)
+	if err != nil || len(bounds) != 2 {
+		return nil, fmt.Errorf("malformed range %q", src)
+	}
+
+	r := map[string]any{
+		"lower":          nil,
+		"upper":          nil,
+		"lowerInclusive": lowerInc,
+		"upperInclusive": upperInc,
+	}
+
+	for i, key := range []string{"lower", "upper"} {
+		if bounds[i] == nil {
+			continue
+		}
+		val, err := d.decodeText(elem, bounds[i])
+		if err != nil && !errors.Is(err, errUnknownOIDType) {
+			return nil, err
+		}
+		r[key] = val
+	}
+
+	return r, nil
+}
+
+// decodeMultirange converts multirange literal, e.g. {[1,3),[5,7)}, to a list of ranges.
+func (d *decoder) decodeMultirange(rangeOID uint32, src []byte) (any, error) {
+	if len(src) < 2 || src[0] != '{' || src[len(src)-1] != '}' {
+		return nil, fmt.Errorf("malformed multirange %q", src)
+	}
+
+	_, elem, ok := d.elementType(rangeOID)
+	if !ok {
+		return nil, fmt.Errorf("unknown range type %d", rangeOID)
+	}
+
+	ranges := make([]any, 0)
+	body := src[1 : len(src)-1]
+
+	for len(body) > 0 {
+		end := -1
+		quoted := false
+		for i := 1; i < len(body); i++ {
+			switch body[i] {
+			case '\\':
+				i++
+			case '"':
+				quoted = !quoted
+			case ')', ']':
+				if !quoted {
+					end = i
+				}
+			}
+			if end >= 0 {
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("malformed multirange %q", src)
+		}
+
+		r, err := d.decodeRange(elem, body[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+
+		body = bytes.TrimPrefix(body[end+1:], []byte{','})
+	}
+
+	return ranges, nil
+}
+
+// maxArrayDimensions limit of array dimensions in postgres (MAXDIM).
+const maxArrayDimensions = 6
+
+// decodeBinaryArray converts binary array (the format of array_send) to nested slices.
+func (d *decoder) decodeBinaryArray(src []byte) (any, error) {
+	r := binaryReader{src: src}
+
+	ndim := int(r.int32())
+	_ = r.int32() // has nulls flag
+	elem := r.uint32()
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed binary array: %w", r.err)
+	}
+	if ndim < 0 || ndim > maxArrayDimensions {
+		return nil, fmt.Errorf("malformed binary array: %d dimensions", ndim)
+	}
+
+	if ndim == 0 {
+		return []any{}, nil
+	}
+
+	dims := make([]int, ndim)
+	for i := range dims {
+		dims[i] = int(r.int32())
+		_ = r.int32() // lower bound
+		if dims[i] < 0 {
+			return nil, errors.New("malformed binary array: negative dimension")
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("malformed binary array: %w", r.err)
+	}
+
+	var read func(dim int) ([]any, error)
+	read = func(dim int) ([]any, error) {
+		items := make([]any, 0, min(dims[dim], len(src)))
+		for i := 0; i < dims[dim]; i++ {
+			if dim+1 < ndim {
+				sub, err := read(dim + 1)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, sub)
+				continue
+			}
+
+			value, isNull := r.value()
+			if r.err != nil {
+				return nil, fmt.Errorf("malformed binary array: %w", r.err)
+			}
+			if isNull {
+				items = append(items, nil)
+				continue
+			}
+
+			val, err := d.decodeBinary(elem, value)
+			if err != nil && !errors.Is(err, errUnknownOIDType) {
+				return nil, err
+			}
+			items = append(items, val)
+		}
+		return items, nil
+	}
+
+	return read(0)
+}
+
+// flags of the binary range (the format of range_send).
+const (
+	rangeEmpty    = 0x01
+	rangeLowerInc = 0x02
+	rangeUpperInc = 0x04
+	rangeLowerInf = 0x08
+	rangeUpperInf = 0x10
+)
+
+// decodeBinaryRange converts binary range to an object with its bounds.
+func (d *decoder) decodeBinaryRange(elem uint32, src []byte) (any, error) {
+	if len(src) == 0 {
+		return nil, errors.New("malformed binary range")
+	}
+
+	flags := src[0]
+	if flags&rangeEmpty != 0 {
+		return map[string]any{"empty": true}, nil
+	}
+
+	r := binaryReader{src: src, pos: 1}
+	res := map[string]any{
+		"lower":          nil,
+		"upper":          nil,
+		"lowerInclusive": flags&rangeLowerInc != 0,
+		"upperInclusive": flags&rangeUpperInc != 0,
+	}
+
+	for _, b := range []struct {
+		key string
+		inf byte
+	}{{"lower", rangeLowerInf}, {"upper", rangeUpperInf}} {
+		if flags&b.inf != 0 {
+			continue
+		}
+
+		value, _ := r.value()
+		if r.err != nil {
+			return nil, fmt.Errorf("malformed binary range: %w", r.err)
+		}
+
+		val, err := d.decodeBinary(elem, value)
+		if err != nil && !errors.Is(err, errUnknownOIDType) {
+			return nil, err
+		}
+		res[b.key] = val
+	}
+
+	return res, nil
+}
+
+// decodeBinaryMultirange converts binary multirange to a list of ranges.
+func (d *decoder) decodeBinaryMultirange(rangeOID uint32, src []byte) (any, error) {
+	_, elem, ok := d.elementType(rangeOID)
+	if !ok {
+		return nil, fmt.Errorf("unknown range type %d", rangeOID)
+	}
+
+	r := binaryReader{src: src}
+	count := int(r.int32())
+	if r.err != nil || count < 0 {
+		return nil, errors.New("malformed binary multirange")
+	}
+
+	ranges := make([]any, 0, min(count, len(src)))
+	for i := 0; i < count; i++ {
+		value, _ := r.value()
+		if r.err != nil {
+			return nil, fmt.Errorf("malformed binary multirange: %w", r.err)
+		}
+
+		val, err := d.decodeBinaryRange(elem, value)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, val)
+	}
+
+	return ranges, nil
+}
+
+// binaryReader reads big endian values, the first error stops the reading.
+type binaryReader struct {
+	src []byte
+	pos int
+	err error
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.src)-r.pos < n {
+		r.err = fmt.Errorf("need %d bytes at offset %d, have %d", n, r.pos, len(r.src)-r.pos)
+		return nil
+	}
+
+	b := r.src[r.pos : r.pos+n]
+	r.pos += n
+
+	return b
+}
+
+func (r *binaryReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *binaryReader) int32() int32 {
+	return int32(r.uint32())
+}
+
+// value reads length prefixed value, length -1 means NULL.
+func (r *binaryReader) value() ([]byte, bool) {
+	size := r.int32()
+	if r.err != nil {
+		return nil, false
+	}
+	if size == -1 {
+		return nil, true
+	}
+
+	b := r.next(int(size))
+	if b == nil && r.err == nil {
+		b = []byte{}
+	}
+
+	return b, false
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"ditto/common"
+	"encoding/binary"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// binaryArray returns the binary array (the format of array_send) of the
+// element type with the dimensions and the elements, nil elements are NULL.
+func binaryArray(elem uint32, dims []int, elements ...[]byte) []byte {
+	hasNull := uint32(0)
+	for _, e := range elements {
+		if e == nil {
+			hasNull = 1
+		}
+	}
+
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(dims)))
+	b = binary.BigEndian.AppendUint32(b, hasNull)
+	b = binary.BigEndian.AppendUint32(b, elem)
+	for _, n := range dims {
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+		b = binary.BigEndian.AppendUint32(b, 1)
+	}
+
+	return append(b, binaryValues(elements...)...)
+}
+
+// binaryValues returns the length prefixed values, nil is NULL.
+func binaryValues(values ...[]byte) []byte {
+	var b []byte
+	for _, v := range values {
+		if v == nil {
+			b = binary.BigEndian.AppendUint32(b, 0xFFFFFFFF)
+			continue
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+		b = append(b, v...)
+	}
+
+	return b
+}
+
+// binaryRange returns the binary range (the format of range_send).
+func binaryRange(flags byte, bounds ...[]byte) []byte {
+	return append([]byte{flags}, binaryValues(bounds...)...)
+}
+
+// int4 returns the binary int4.
+func int4(v int32) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(v))
+}
+
+func TestDecodeContainers(t *testing.T) {
+	multirange := binary.BigEndian.AppendUint32(nil, 2)
+	multirange = append(multirange, binaryValues(
+		binaryRange(rangeLowerInc, int4(1), int4(3)),
+		binaryRange(rangeLowerInc|rangeUpperInf, int4(5)))...)
+
+	tests := []struct {
+		name   string
+		oid    uint32
+		text   string // not decoded when empty
+		binary []byte // not decoded when nil
+		want   string // in JSON
+	}{
+		{"empty array", pgtype.Int4ArrayOID, "{}", binaryArray(common.Int4OID, nil), `[]`},
+		{"array", pgtype.Int4ArrayOID, "{1,2,3}", binaryArray(common.Int4OID, []int{3}, int4(1), int4(2), int4(3)), `[1,2,3]`},
+		{"multi-dimensional with nulls", pgtype.Int4ArrayOID, "{{1,NULL},{NULL,4}}",
+			binaryArray(common.Int4OID, []int{2, 2}, int4(1), nil, nil, int4(4)), `[[1,null],[null,4]]`},
+		{"three dimensions", pgtype.Int4ArrayOID, "{{{1},{2}},{{3},{4}}}",
+			binaryArray(common.Int4OID, []int{2, 2, 1}, int4(1), int4(2), int4(3), int4(4)), `[[[1],[2]],[[3],[4]]]`},
+		{"lower bound", pgtype.Int4ArrayOID, "[0:1]={1,2}", nil, `[1,2]`},
+		{"lower bounds of dimensions", pgtype.Int4ArrayOID, "[-1:0][2:3]={{1,2},{3,4}}", nil, `[[1,2],[3,4]]`},
+		{"quoted elements", pgtype.TextArrayOID, `{"a,b","say \"hi\"","back\\slash","{}",NULL,"NULL","",plain}`, nil,
+			`["a,b","say \"hi\"","back\\slash","{}",null,"NULL","","plain"]`},
+		{"binary text elements", pgtype.TextArrayOID, "", binaryArray(common.TextOID, []int{3}, []byte("a,b"), nil, []byte("")), `["a,b",null,""]`},
+		{"box delimiter", pgtype.BoxArrayOID, "{(1,1),(0,0);(3,3),(2,2)}", nil, `["(1,1),(0,0)","(3,3),(2,2)"]`},
+		{"empty range", pgtype.Int4rangeOID, "empty", binaryRange(rangeEmpty), `{"empty":true}`},
+		{"range", pgtype.Int4rangeOID, "[1,10)", binaryRange(rangeLowerInc, int4(1), int4(10)),
+			`{"lower":1,"lowerInclusive":true,"upper":10,"upperInclusive":false}`},
+		{"unbounded lower", pgtype.Int4rangeOID, "(,5)", binaryRange(rangeLowerInf, int4(5)),
+			`{"lower":null,"lowerInclusive":false,"upper":5,"upperInclusive":false}`},
+		{"unbounded upper", pgtype.Int4rangeOID, "[3,)", binaryRange(rangeLowerInc|rangeUpperInf, int4(3)),
+			`{"lower":3,"lowerInclusive":true,"upper":null,"upperInclusive":false}`},
+		{"unbounded", pgtype.Int4rangeOID, "(,)", binaryRange(rangeLowerInf | rangeUpperInf),
+			`{"lower":null,"lowerInclusive":false,"upper":null,"upperInclusive":false}`},
+		{"exclusive lower inclusive upper", pgtype.NumrangeOID, "(1.5,2.5]", nil,
+			`{"lower":"1.5","lowerInclusive":false,"upper":"2.5","upperInclusive":true}`},
+		{"quoted bounds", pgtype.TsrangeOID, `["2024-01-02 03:04:05","2024-01-03 00:00:00")`, nil,
+			`{"lower":"2024-01-02T03:04:05Z","lowerInclusive":true,"upper":"2024-01-03T00:00:00Z","upperInclusive":false}`},
+		{"empty multirange", pgtype.Int4multirangeOID, "{}", binary.BigEndian.AppendUint32(nil, 0), `[]`},
+		{"multirange", pgtype.Int4multirangeOID, "{[1,3),[5,)}", multirange,
+			`[{"lower":1,"lowerInclusive":true,"upper":3,"upperInclusive":false},{"lower":5,"lowerInclusive":true,"upper":null,"upperInclusive":false}]`},
+		{"multirange quoted bounds", pgtype.TsmultirangeOID, `{["2024-01-02 00:00:00","2024-01-03 00:00:00"]}`, nil,
+			`[{"lower":"2024-01-02T00:00:00Z","lowerInclusive":true,"upper":"2024-01-03T00:00:00Z","upperInclusive":true}]`},
+		{"array of ranges", pgtype.Int4rangeArrayOID, `{"[1,2)",empty}`, nil,
+			`[{"lower":1,"lowerInclusive":true,"upper":2,"upperInclusive":false},{"empty":true}]`},
+	}
+
+	d := &decoder{codecs: NewCodecRegistry()}
+
+	check := func(t *testing.T, format string, got any, err error, want string) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		b, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s: got %s, want %s", format, b, want)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.text != "" {
+				got, err := d.decodeText(tt.oid, []byte(tt.text))
+				check(t, "text", got, err, tt.want)
+			}
+			if tt.binary != nil {
+				got, err := d.decodeBinary(tt.oid, tt.binary)
+				check(t, "binary", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeContainersInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		oid    uint32
+		text   string
+		binary []byte
+	}{
+		{"unterminated array", pgtype.Int4ArrayOID, "{1,2", nil},
+		{"data after array", pgtype.Int4ArrayOID, "{1}x", nil},
+		{"dimensions without =", pgtype.Int4ArrayOID, "[0:1]{1,2}", nil},
+		{"short binary array", pgtype.Int4ArrayOID, "", binaryArray(common.Int4OID, []int{2}, int4(1))},
+		{"too many dimensions", pgtype.Int4ArrayOID, "", binaryArray(common.Int4OID, []int{1, 1, 1, 1, 1, 1, 1}, int4(1))},
+		{"range without brackets", pgtype.Int4rangeOID, "1,2", []byte{}},
+		{"range with one bound", pgtype.Int4rangeOID, "[1)", binaryRange(rangeLowerInc, int4(1))},
+		{"multirange without braces", pgtype.Int4multirangeOID, "[1,2)", []byte{0, 0}},
+	}
+
+	d := &decoder{codecs: NewCodecRegistry()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.text != "" {
+				if got, err := d.decodeText(tt.oid, []byte(tt.text)); err == nil {
+					t.Errorf("text: got %v", got)
+				}
+			}
+			if tt.binary != nil {
+				if got, err := d.decodeBinary(tt.oid, tt.binary); err == nil {
+					t.Errorf("binary: got %v", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"ditto/common"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// pgTypeMap codecs of the built-in types used to read binary tuple data.
+var pgTypeMap = pgtype.NewMap()
+
+// AssertBinaryValue converts bytes received in binary format, the result
+// is the same as AssertValue gives for the text format of the value.
+func (c *Column) AssertBinaryValue(src []byte) {
+	if src == nil {
+		c.value = nil
+		return
+	}
+
+	val, err := c.decoder.decodeBinary(uint32(c.ValueType), src)
+	c.setValue(val, err)
+}
+
+// decodeBinary converts binary representation of the value with the binary
+// codec registered for the type, or by rendering it as text with pgtype
+// codecs and passing it to the text decoder.
+func (d *decoder) decodeBinary(oid uint32, src []byte) (any, error) {
+	if codec, ok := d.codec(oid).(BinaryTypeCodec); ok {
+		return codec.DecodeBinary(d, src)
+	}
+
+	if serverFormatted(oid) && d != nil && d.types != nil {
+		if text, ok, err := d.types.FormatText(oid, src); ok {
+			if err != nil {
+				return d.unknownValue(src), err
+			}
+			return d.decodeText(oid, text)
+		}
+	}
+
+	if text, ok, err := builtinBinaryToText(oid, src); ok {
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeText(oid, text)
+	}
+
+	if kind, elem, ok := d.elementType(oid); ok {
+		return d.decodeContainerBinary(kind, elem, src)
+	}
+
+	t, ok := pgTypeMap.TypeForOID(oid)
+	if !ok {
+		return d.decodeCustomBinary(oid, src)
+	}
+
+	val, err := t.Codec.DecodeValue(pgTypeMap, oid, pgtype.BinaryFormatCode, src)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := binaryValueToText(oid, val)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.decodeText(oid, text)
+}
+
+// binaryValueToText renders the value as text like postgres does.
+func binaryValueToText(oid uint32, val any) ([]byte, error) {
+	if v, ok := val.(pgtype.InfinityModifier); ok {
+		return []byte(v.String()), nil
+	}
+
+	return pgTypeMap.Encode(oid, pgtype.TextFormatCode, val, nil)
+}
+
+// serverFormatted reports whether the text of the type depends on the locale
+// or the catalog (money, reg* types), such values are rendered as text by the
+// server.
+func serverFormatted(oid uint32) bool {
+	if oid == common.MoneyOID {
+		return true
+	}
+
+	return isRegType(oid)
+}
+
+// isRegType reports whether the type is an oid alias type, e.g. regclass.
+func isRegType(oid uint32) bool {
+	switch oid {
+	case common.RegprocOID, common.RegprocedureOID, common.RegoperOID, common.RegoperatorOID,
+		common.RegclassOID, common.RegtypeOID, common.RegconfigOID, common.RegdictionaryOID,
+		common.RegnamespaceOID, common.RegroleOID, common.RegcollationOID:
+		return true
+	}
+
+	return false
+}
+
+// builtinBinaryToText renders as text the built-in types which have no pgtype codec.
+// Without a connection to the server money has no currency symbol and reg*
+// types are written as oid, because their text form depends on the locale
+// and the catalog.
+func builtinBinaryToText(oid uint32, src []byte) ([]byte, bool, error) {
+	short := func(n int) error {
+		if len(src) < n {
+			return fmt.Errorf("binary value of type %d: need %d bytes, have %d", oid, n, len(src))
+		}
+		return nil
+	}
+
+	switch oid {
+	case common.MoneyOID:
+		if err := short(8); err != nil {
+			return nil, true, err
+		}
+		cents := int64(binary.BigEndian.Uint64(src))
+		sign := ""
+		if cents < 0 {
+			sign, cents = "-", -cents
+		}
+		return fmt.Appendf(nil, "%s%d.%02d", sign, cents/100, cents%100), true, nil
+
+	case common.TSVectorOID:
+		text, err := tsvectorBinaryToText(src)
+		return text, true, err
+
+	case common.TSQueryOID:
+		text, err := tsqueryBinaryToText(src)
+		return text, true, err
+
+	case common.PgLSNOID:
+		if err := short(8); err != nil {
+			return nil, true, err
+		}
+		lsn := binary.BigEndian.Uint64(src)
+		return fmt.Appendf(nil, "%X/%X", lsn>>32, uint32(lsn)), true, nil
+
+	case common.TxidSnapshotOID, common.PgSnapshotOID:
+		if err := short(20); err != nil {
+			return nil, true, err
+		}
+		n := int(int32(binary.BigEndian.Uint32(src)))
+		if n < 0 {
+			return nil, true, fmt.Errorf("binary value of type %d: negative xip count", oid)
+		}
+		if err := short(20 + 8*n); err != nil {
+			return nil, true, err
+		}
+		text := fmt.Appendf(nil, "%d:%d:", binary.BigEndian.Uint64(src[4:]), binary.BigEndian.Uint64(src[12:]))
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				text = append(text, ',')
+			}
+			text = strconv.AppendUint(text, binary.BigEndian.Uint64(src[20+8*i:]), 10)
+		}
+		return text, true, nil
+
+	case common.RegprocOID, common.RegprocedureOID, common.RegoperOID, common.RegoperatorOID,
+		common.RegclassOID, common.RegtypeOID, common.RegconfigOID, common.RegdictionaryOID,
+		common.RegnamespaceOID, common.RegroleOID, common.RegcollationOID:
+		if err := short(4); err != nil {
+			return nil, true, err
+		}
+		return strconv.AppendUint(nil, uint64(binary.BigEndian.Uint32(src)), 10), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// decodeCustomBinary converts binary value of an enum, domain or composite type.
+func (d *decoder) decodeCustomBinary(oid uint32, src []byte) (any, error) {
+	if d == nil || d.types == nil {
+		return d.unknownValue(src), errUnknownOIDType
+	}
+
+	info, err := d.types.Lookup(oid)
+	if err != nil {
+		// the unknown type policy applies, skip must leave the column out
+		return d.unknownValue(src), fmt.Errorf("%w: %w", errUnknownOIDType, err)
+	}
+
+	switch info.Kind {
+	case TypeKindEnum:
+		return string(src), nil
+	case TypeKindDomain:
+		return d.decodeBinary(info.BaseOID, src)
+	case TypeKindComposite:
+		return d.decodeBinaryComposite(info, src)
+	default:
+		return d.unknownValue(src), errUnknownOIDType
+	}
+}
+
+// decodeBinaryComposite converts binary record (the format of record_send)
+// to a map of its attributes.
+func (d *decoder) decodeBinaryComposite(info *TypeInfo, src []byte) (any, error) {
+	if len(src) < 4 {
+		return nil, fmt.Errorf("composite %s: short record", info.Name)
+	}
+
+	count := int(int32(binary.BigEndian.Uint32(src)))
+	if count != len(info.Fields) {
+		return nil, fmt.Errorf("composite %s: got %d fields, type has %d", info.Name, count, len(info.Fields))
+	}
+
+	m := make(map[string]any, count)
+	pos := 4
+
+	for _, f := range info.Fields {
+		if len(src) < pos+8 {
+			return nil, fmt.Errorf("composite %s field %s: short record", info.Name, f.Name)
+		}
+
+		fieldOID := binary.BigEndian.Uint32(src[pos:])
+		size := int(int32(binary.BigEndian.Uint32(src[pos+4:])))
+		pos += 8
+
+		if size < 0 {
+			m[f.Name] = nil
+			continue
+		}
+
+		if len(src) < pos+size {
+			return nil, fmt.Errorf("composite %s field %s: short record", info.Name, f.Name)
+		}
+
+		val, err := d.decodeBinary(fieldOID, src[pos:pos+size])
+		if err != nil && !errors.Is(err, errUnknownOIDType) {
+			return nil, fmt.Errorf("composite %s field %s: %w", info.Name, f.Name, err)
+		}
+		m[f.Name] = val
+		pos += size
+	}
+
+	return m, nil
+}
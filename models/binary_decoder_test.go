@@ -0,0 +1,163 @@
+package models
+
+import (
+	"ditto/common"
+	"encoding/binary"
+	"testing"
+)
+
+// formattingLoader renders the values like a server with an en_US lc_monetary.
+type formattingLoader struct {
+	countingLoader
+	formatted int
+}
+
+func (l *formattingLoader) FormatText(oid uint32, src []byte) ([]byte, error) {
+	l.formatted++
+	switch oid {
+	case common.MoneyOID:
+		return []byte("$1,234.50"), nil
+	case common.RegclassOID:
+		return []byte("deposit_events"), nil
+	default:
+		return []byte("'a' 'b'"), nil
+	}
+}
+
+func TestDecodeBinaryFormattedOnServer(t *testing.T) {
+	loader := &formattingLoader{}
+	d := &decoder{codecs: NewCodecRegistry(), types: NewTypeStore(loader)}
+
+	money := binary.BigEndian.AppendUint64(nil, 123450)
+	regclass := binary.BigEndian.AppendUint32(nil, 16384)
+
+	tests := []struct {
+		oid  uint32
+		src  []byte
+		want string
+	}{
+		{common.MoneyOID, money, "$1,234.50"},
+		{common.MoneyOID, money, "$1,234.50"},
+		{common.RegclassOID, regclass, "deposit_events"},
+		{common.RegclassOID, regclass, "deposit_events"},
+	}
+	for _, tt := range tests {
+		got, err := d.decodeBinary(tt.oid, tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("type %d: got %v, want %q", tt.oid, got, tt.want)
+		}
+	}
+
+	// the texts of the same values are cached
+	if loader.formatted != 2 {
+		t.Fatalf("formatted %d values, want 2", loader.formatted)
+	}
+}
+
+func TestDecodeBinaryTSearch(t *testing.T) {
+	lexeme := func(s string, positions ...uint16) []byte {
+		b := append([]byte(s), 0)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(positions)))
+		for _, p := range positions {
+			b = binary.BigEndian.AppendUint16(b, p)
+		}
+		return b
+	}
+	vector := func(lexemes ...[]byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(lexemes)))
+		for _, l := range lexemes {
+			b = append(b, l...)
+		}
+		return b
+	}
+	operand := func(s string, weight byte, prefix bool) []byte {
+		p := byte(0)
+		if prefix {
+			p = 1
+		}
+		return append([]byte{1, weight, p}, append([]byte(s), 0)...)
+	}
+	query := func(items ...[]byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(items)))
+		for _, item := range items {
+			b = append(b, item...)
+		}
+		return b
+	}
+	and, or, not := []byte{2, 2}, []byte{2, 3}, []byte{2, 1}
+	phrase := func(distance uint16) []byte { return binary.BigEndian.AppendUint16([]byte{2, 4}, distance) }
+
+	tests := []struct {
+		name string
+		oid  uint32
+		src  []byte
+		want string
+	}{
+		{"empty tsvector", common.TSVectorOID, vector(), ""},
+		{"tsvector", common.TSVectorOID, vector(lexeme("cat"), lexeme("fat", 2, 3<<14|11)), "'cat' 'fat':2,11A"},
+		{"tsvector weights", common.TSVectorOID, vector(lexeme("a", 1<<14|1, 2<<14|2, 3)), "'a':1C,2B,3"},
+		{"tsvector quotes", common.TSVectorOID, vector(lexeme(`it's`), lexeme(`a\b`)), `'it''s' 'a\\b'`},
+		{"tsvector utf-8", common.TSVectorOID, vector(lexeme("größe", 1)), "'größe':1"},
+		{"empty tsquery", common.TSQueryOID, query(), ""},
+		{"tsquery operand", common.TSQueryOID, query(operand("cat", 0, false)), "'cat'"},
+		{"tsquery prefix weight", common.TSQueryOID, query(operand("sup", 12, true)), "'sup':*AB"},
+		{"tsquery precedence", common.TSQueryOID,
+			query(and, or, not, operand("c", 0, false), operand("b", 0, false), operand("a", 0, false)),
+			"'a' & ( 'b' | !'c' )"},
+		{"tsquery or of and", common.TSQueryOID,
+			query(or, and, operand("c", 0, false), operand("b", 0, false), operand("a", 0, false)),
+			"'a' | 'b' & 'c'"},
+		{"tsquery not of and", common.TSQueryOID,
+			query(not, and, operand("b", 0, false), operand("a", 0, false)),
+			"!( 'a' & 'b' )"},
+		{"tsquery phrase", common.TSQueryOID,
+			query(phrase(2), operand("c", 0, false), phrase(1), operand("b", 0, false), operand("a", 0, false)),
+			"'a' <-> 'b' <2> 'c'"},
+		{"tsquery right phrase", common.TSQueryOID,
+			query(phrase(1), phrase(1), operand("c", 0, false), operand("b", 0, false), operand("a", 0, false)),
+			"'a' <-> ( 'b' <-> 'c' )"},
+		{"tsquery quotes", common.TSQueryOID, query(operand(`it's`, 0, false)), `'it''s'`},
+	}
+
+	// decoded without a round trip to the server
+	loader := &formattingLoader{}
+	d := &decoder{codecs: NewCodecRegistry(), types: NewTypeStore(loader)}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.decodeBinary(tt.oid, tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if loader.formatted != 0 {
+		t.Errorf("formatted %d values on the server", loader.formatted)
+	}
+
+	for _, src := range [][]byte{{0, 0}, vector(lexeme("a", 1))[:8], query(or, operand("a", 0, false)), query([]byte{2, 9})} {
+		if _, err := d.decodeBinary(common.TSQueryOID, src); err == nil {
+			t.Errorf("decoded invalid tsquery % x", src)
+		}
+	}
+}
+
+func TestDecodeBinaryWithoutServer(t *testing.T) {
+	d := &decoder{codecs: NewCodecRegistry(), types: NewTypeStore(nil)}
+
+	cents := int64(-123450)
+	got, err := d.decodeBinary(common.MoneyOID, binary.BigEndian.AppendUint64(nil, uint64(cents)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "-1234.50" {
+		t.Fatalf("got %v", got)
+	}
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// decodeFloat converts float4 and float8. NaN and ±Infinity have no
+// JSON number representation, they are kept as strings.
+func decodeFloat(src string, bitSize int) (any, error) {
+	f, err := strconv.ParseFloat(src, bitSize)
+	if err != nil {
+		return src, err
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return src, nil
+	}
+
+	if bitSize == 32 {
+		return float32(f), nil
+	}
+
+	return f, nil
+}
+
+// decodeBytea converts bytea in hex (\x0102) or escape format to bytes,
+// they are written to JSON as a base64 string.
+func decodeBytea(src string) (any, error) {
+	if strings.HasPrefix(src, `\x`) {
+		return hex.DecodeString(src[2:])
+	}
+
+	buf := make([]byte, 0, len(src))
+	for i := 0; i < len(src); i++ {
+		if src[i] != '\\' {
+			buf = append(buf, src[i])
+			continue
+		}
+
+		if i+1 < len(src) && src[i+1] == '\\' {
+			buf = append(buf, '\\')
+			i++
+			continue
+		}
+
+		if i+4 > len(src) {
+			return nil, fmt.Errorf("invalid bytea escape at %d", i)
+		}
+		b, err := strconv.ParseUint(src[i+1:i+4], 8, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bytea escape at %d: %w", i, err)
+		}
+		buf = append(buf, byte(b))
+		i += 3
+	}
+
+	return buf, nil
+}
+
+// decodeInterval converts interval to an ISO 8601 duration, e.g. P1Y2M3DT4H5M6.5S.
+func decodeInterval(src string) (any, error) {
+	var iv pgtype.Interval
+	if err := iv.Scan(src); err != nil {
+		return src, err
+	}
+
+	return formatISODuration(iv.Months, iv.Days, iv.Microseconds), nil
+}
+
+func formatISODuration(months, days int32, microseconds int64) string {
+	var sb strings.Builder
+	sb.WriteByte('P')
+
+	if y := months / 12; y != 0 {
+		fmt.Fprintf(&sb, "%dY", y)
+	}
+	if m := months % 12; m != 0 {
+		fmt.Fprintf(&sb, "%dM", m)
+	}
+	if days != 0 {
+		fmt.Fprintf(&sb, "%dD", days)
+	}
+
+	if microseconds != 0 {
+		sb.WriteByte('T')
+
+		const (
+			usPerSecond = 1000000
+			usPerMinute = 60 * usPerSecond
+			usPerHour   = 60 * usPerMinute
+		)
+
+		if h := microseconds / usPerHour; h != 0 {
+			fmt.Fprintf(&sb, "%dH", h)
+		}
+		if m := microseconds % usPerHour / usPerMinute; m != 0 {
+			fmt.Fprintf(&sb, "%dM", m)
+		}
+		if us := microseconds % usPerMinute; us != 0 {
+			sec := strconv.FormatFloat(float64(us)/usPerSecond, 'f', -1, 64)
+			fmt.Fprintf(&sb, "%sS", sec)
+		}
+	}
+
+	if sb.Len() == 1 {
+		return "PT0S"
+	}
+
+	return sb.String()
+}
+
+// decodePoint converts point (x,y) to an object with x and y.
+func decodePoint(src string) (any, error) {
+	var p pgtype.Point
+	if err := p.Scan(src); err != nil {
+		return src, err
+	}
+
+	return map[string]any{"x": p.P.X, "y": p.P.Y}, nil
+}
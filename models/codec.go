@@ -0,0 +1,210 @@
+package models
+
+import (
+	"bytes"
+	"ditto/common"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+)
+
+// DecodeContext gives codecs access to the options and to the decoders of other types.
+type DecodeContext interface {
+	Options() DecodeOptions
+	// DecodeText converts text representation of a value of any type, e.g. an element of a container.
+	DecodeText(oid uint32, src []byte) (any, error)
+}
+
+// TypeCodec converts text representation of the column value to a value of the event.
+type TypeCodec interface {
+	DecodeText(ctx DecodeContext, src []byte) (any, error)
+}
+
+// BinaryTypeCodec codec which also supports the binary format. Values of the
+// types without a binary codec are handled by the unknown type policy in binary mode.
+type BinaryTypeCodec interface {
+	TypeCodec
+	DecodeBinary(ctx DecodeContext, src []byte) (any, error)
+}
+
+// TypeCodecFunc adapter to use an ordinary function as a TypeCodec.
+type TypeCodecFunc func(ctx DecodeContext, src []byte) (any, error)
+
+// DecodeText calls f(ctx, src).
+func (f TypeCodecFunc) DecodeText(ctx DecodeContext, src []byte) (any, error) {
+	return f(ctx, src)
+}
+
+// CodecRegistry codecs keyed by type oid, and by type name for types
+// of extensions which have different oids in every database.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	byOID  map[uint32]TypeCodec
+	byName map[string]TypeCodec
+}
+
+// NewCodecRegistry create registry with codecs of the built-in types.
+func NewCodecRegistry() *CodecRegistry {
+	r := &CodecRegistry{
+		byOID:  make(map[uint32]TypeCodec),
+		byName: make(map[string]TypeCodec),
+	}
+	registerBuiltinCodecs(r)
+	registerExtensionCodecs(r)
+
+	return r
+}
+
+// DefaultCodecs registry used by the WAL transactions unless it is replaced.
+var DefaultCodecs = NewCodecRegistry()
+
+// RegisterOID registers codec for the type oid, it replaces the existing one.
+func (r *CodecRegistry) RegisterOID(oid uint32, codec TypeCodec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.byOID[oid] = codec
+}
+
+// RegisterName registers codec for the type name, either qualified with
+// the schema ("public.geometry") or not ("geometry").
+func (r *CodecRegistry) RegisterName(name string, codec TypeCodec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.byName[name] = codec
+}
+
+// lookup returns codec by the oid, or by the name of the type from the type store.
+func (r *CodecRegistry) lookup(oid uint32, types *TypeStore) TypeCodec {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	codec, ok := r.byOID[oid]
+	noNames := len(r.byName) == 0
+	r.mu.RUnlock()
+
+	if ok || noNames || types == nil || isBuiltinOID(oid) {
+		return codec
+	}
+
+	info, err := types.Lookup(oid)
+	if err != nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if codec, ok := r.byName[info.Namespace+"."+info.Name]; ok {
+		return codec
+	}
+
+	return r.byName[info.Name]
+}
+
+// isBuiltinOID reports whether the oid belongs to the initial catalog (below FirstNormalObjectId).
+func isBuiltinOID(oid uint32) bool {
+	return oid < 16384
+}
+
+// decodeJSON converts json and jsonb, a value followed by anything but
+// whitespace is an error. With useNumber the numbers are json.Number, so
+// large integers such as IDs keep their digits.
+func decodeJSON(src []byte, useNumber bool) (any, error) {
+	d := json.NewDecoder(bytes.NewReader(src))
+	if useNumber {
+		d.UseNumber()
+	}
+
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if err := d.Decode(new(any)); err != io.EOF {
+		return nil, fmt.Errorf("invalid json value: data after the value at offset %d", d.InputOffset())
+	}
+
+	return v, nil
+}
+
+func stringCodec(_ DecodeContext, src []byte) (any, error) {
+	return string(src), nil
+}
+
+func registerBuiltinCodecs(r *CodecRegistry) {
+	codecs := []struct {
+		codec TypeCodecFunc
+		oids  []uint32
+	}{
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return strconv.ParseBool(string(src))
+		}, []uint32{common.BoolOID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return strconv.Atoi(string(src))
+		}, []uint32{common.Int2OID, common.Int4OID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return strconv.ParseInt(string(src), 10, 64)
+		}, []uint32{common.Int8OID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			u, err := strconv.ParseUint(string(src), 10, 32)
+			return uint32(u), err
+		}, []uint32{common.OIDOID, common.XIDOID, common.CIDOID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return strconv.ParseUint(string(src), 10, 64)
+		}, []uint32{common.Xid8OID}},
+		{func(ctx DecodeContext, src []byte) (any, error) {
+			return decodeNumeric(ctx.Options(), string(src))
+		}, []uint32{common.Numeric}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return decodeFloat(string(src), 32)
+		}, []uint32{common.Float4OID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return decodeFloat(string(src), 64)
+		}, []uint32{common.Float8OID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return decodeBytea(string(src))
+		}, []uint32{common.ByteaOID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return decodeInterval(string(src))
+		}, []uint32{common.IntervalOID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return uuid.Parse(string(src))
+		}, []uint32{common.UUIDOID}},
+		{func(ctx DecodeContext, src []byte) (any, error) {
+			return decodeJSON(src, ctx.Options().JSONNumbers)
+		}, []uint32{common.JSONOID, common.JSONBOID}},
+		{func(_ DecodeContext, src []byte) (any, error) {
+			return decodePoint(string(src))
+		}, []uint32{common.PointOID}},
+		{stringCodec, []uint32{
+			common.TextOID, common.VarcharOID, common.BPCharOID, common.CharOID, common.NameOID,
+			common.XMLOID, common.JSONPathOID, common.MoneyOID,
+			common.InetOID, common.CIDROID, common.MacaddrOID, common.Macaddr8OID,
+			common.BitOID, common.VarbitOID,
+			common.LsegOID, common.PathOID, common.BoxOID, common.PolygonOID, common.LineOID, common.CircleOID,
+			common.TIDOID, common.TSVectorOID, common.TSQueryOID, common.PgLSNOID,
+			common.TxidSnapshotOID, common.PgSnapshotOID,
+			common.RegprocOID, common.RegprocedureOID, common.RegoperOID, common.RegoperatorOID,
+			common.RegclassOID, common.RegtypeOID, common.RegconfigOID, common.RegdictionaryOID,
+			common.RegnamespaceOID, common.RegroleOID, common.RegcollationOID,
+		}},
+	}
+
+	for _, c := range codecs {
+		for _, oid := range c.oids {
+			r.byOID[oid] = c.codec
+		}
+	}
+
+	for _, oid := range []uint32{common.TimestampOID, common.TimestamptzOID, common.DateOID, common.TimeOID, common.TimetzOID} {
+		r.byOID[oid] = timeCodec{oid: oid}
+	}
+}
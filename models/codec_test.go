@@ -0,0 +1,233 @@
+package models
+
+import (
+	"ditto/common"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// namedLoader loads the types of the map.
+type namedLoader map[uint32]*TypeInfo
+
+func (l namedLoader) LoadType(oid uint32) (*TypeInfo, error) {
+	if info, ok := l[oid]; ok {
+		return info, nil
+	}
+	return nil, errors.New("type does not exist")
+}
+
+// constCodec decodes every value to its name.
+type constCodec string
+
+func (c constCodec) DecodeText(DecodeContext, []byte) (any, error) {
+	return string(c), nil
+}
+
+func TestCodecRegistryLookup(t *testing.T) {
+	loader := namedLoader{
+		90000: {OID: 90000, Namespace: "public", Name: "geometry", Kind: TypeKindBase},
+		90001: {OID: 90001, Namespace: "postgis", Name: "geometry", Kind: TypeKindBase},
+		90002: {OID: 90002, Namespace: "public", Name: "box2d", Kind: TypeKindBase},
+		90003: {OID: 90003, Namespace: "public", Name: "text", Kind: TypeKindBase},
+	}
+
+	r := NewCodecRegistry()
+	r.RegisterName("geometry", constCodec("by name"))
+	r.RegisterName("public.geometry", constCodec("by qualified name"))
+	r.RegisterName("text", constCodec("text by name"))
+	r.RegisterName("box2d", constCodec("box2d by name"))
+	r.RegisterOID(90002, constCodec("by oid"))
+	r.RegisterOID(common.Int4OID, constCodec("int4 replaced"))
+
+	tests := []struct {
+		name string
+		oid  uint32
+		want any
+	}{
+		{name: "qualified name first", oid: 90000, want: "by qualified name"},
+		{name: "name in another schema", oid: 90001, want: "by name"},
+		{name: "oid before name", oid: 90002, want: "by oid"},
+		{name: "extension type named like a built-in", oid: 90003, want: "text by name"},
+		{name: "built-in replaced by oid", oid: common.Int4OID, want: "int4 replaced"},
+		{name: "built-in not looked up by name", oid: common.TextOID, want: "1"},
+	}
+
+	d := &decoder{codecs: r, types: NewTypeStore(loader)}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.decodeText(tt.oid, []byte("1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	// a later registration replaces the codec
+	r.RegisterName("geometry", constCodec("replaced"))
+	if got, _ := d.decodeText(90001, []byte("1")); got != "replaced" {
+		t.Errorf("got %#v after the replacement", got)
+	}
+
+	// the registrations don't leak into the other registries
+	if got, _ := (&decoder{codecs: NewCodecRegistry()}).decodeText(common.Int4OID, []byte("1")); got == "int4 replaced" {
+		t.Errorf("got %#v from a new registry", got)
+	}
+}
+
+func TestUnknownTypePolicy(t *testing.T) {
+	const unknownOID = 90010
+
+	tests := []struct {
+		policy UnknownTypePolicy
+		want   any
+	}{
+		{policy: "", want: "(1,2)"},
+		{policy: UnknownTypeString, want: "(1,2)"},
+		{policy: UnknownTypeBase64, want: "KDEsMik="},
+		{policy: UnknownTypeSkip, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			d := &decoder{codecs: NewCodecRegistry(), types: NewTypeStore(namedLoader{}), options: DecodeOptions{UnknownTypePolicy: tt.policy}}
+
+			got, err := d.decodeText(unknownOID, []byte("(1,2)"))
+			if got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+			if !errors.Is(err, errUnknownOIDType) || !strings.Contains(err.Error(), "type does not exist") {
+				t.Errorf("got error %v, want the failed lookup", err)
+			}
+
+			// the column is left out of the event only by skip
+			commit := time.Now()
+			w := NewWalTransaction()
+			w.CommitTime = &commit
+			w.DecodeOptions = d.options
+			w.TypeStore = d.types
+			w.RelationStore[1] = RelationData{Schema: "public", Table: "shapes", Replica: 'd', Columns: []Column{
+				{Name: "id", ValueType: common.Int4OID, ValueModifier: -1, IsKey: true},
+				{Name: "shape", ValueType: unknownOID, ValueModifier: -1},
+			}}
+			a, err := w.CreateActionData(1, nil, []common.TupleData{
+				{Kind: common.TextDataType, Value: []byte("1")},
+				{Kind: common.TextDataType, Value: []byte("(1,2)")},
+			}, ActionKindInsert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Actions = append(w.Actions, a)
+
+			value, ok := w.CreateEvents()[0].Data["shape"]
+			if ok == (tt.policy == UnknownTypeSkip) || value != tt.want {
+				t.Errorf("got shape %#v (%v)", value, ok)
+			}
+		})
+	}
+
+	if err := (DecodeOptions{UnknownTypePolicy: "error"}).Validate(); err == nil {
+		t.Error("unsupported policy is accepted")
+	}
+}
+
+func TestUnknownTypeWithoutLoader(t *testing.T) {
+	d := &decoder{codecs: NewCodecRegistry(), options: DecodeOptions{UnknownTypePolicy: UnknownTypeBase64}}
+
+	got, err := d.decodeBinary(90011, []byte{0, 1})
+	if !errors.Is(err, errUnknownOIDType) || got != "AAE=" {
+		t.Fatalf("got %#v, %v", got, err)
+	}
+}
+
+func TestExtensionCodecs(t *testing.T) {
+	store := NewTypeStore(nil)
+	for oid, name := range map[uint32]string{90020: "hstore", 90021: "vector", 90022: "ltree", 90023: "citext"} {
+		store.Announce(common.DataType{ID: int32(oid), Namespace: "public", Name: name})
+	}
+	d := &decoder{codecs: NewCodecRegistry(), types: store}
+
+	hstoreBinary := binary.BigEndian.AppendUint32(nil, 2)
+	for _, s := range []string{"a", "1", "b"} {
+		hstoreBinary = binary.BigEndian.AppendUint32(hstoreBinary, uint32(len(s)))
+		hstoreBinary = append(hstoreBinary, s...)
+	}
+	hstoreBinary = binary.BigEndian.AppendUint32(hstoreBinary, math.MaxUint32)
+
+	vectorBinary := []byte{0, 3, 0, 0}
+	for _, f := range []float32{1, 2.5, -3} {
+		vectorBinary = binary.BigEndian.AppendUint32(vectorBinary, math.Float32bits(f))
+	}
+
+	tests := []struct {
+		name   string
+		oid    uint32
+		text   string
+		binary []byte
+		want   any
+	}{
+		{"hstore", 90020, `"a"=>"1", "b"=>NULL`, hstoreBinary, map[string]any{"a": "1", "b": nil}},
+		{"hstore escapes", 90020, `"k \"q\""=>"c:\\d", "e"=>""`, nil, map[string]any{`k "q"`: `c:\d`, "e": ""}},
+		{"hstore empty", 90020, ``, []byte{0, 0, 0, 0}, map[string]any{}},
+		{"vector", 90021, `[1,2.5,-3]`, vectorBinary, []float32{1, 2.5, -3}},
+		{"vector empty", 90021, `[]`, []byte{0, 0, 0, 0}, []float32{}},
+		{"ltree", 90022, `top.science.astronomy`, append([]byte{1}, "top.science.astronomy"...), "top.science.astronomy"},
+		{"citext", 90023, `Straße`, []byte("Straße"), "Straße"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.decodeText(tt.oid, []byte(tt.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("text: got %#v, want %#v", got, tt.want)
+			}
+
+			if tt.binary == nil {
+				return
+			}
+			got, err = d.decodeBinary(tt.oid, tt.binary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("binary: got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name   string
+		oid    uint32
+		text   string
+		binary []byte
+	}{
+		{"hstore without arrow", 90020, `"a" "1"`, []byte{0, 0, 0, 1, 0, 0, 0, 1}},
+		{"hstore unterminated", 90020, `"a"=>"1`, nil},
+		{"vector brackets", 90021, `1,2`, []byte{0, 2, 0, 0, 0, 0, 0, 0}},
+		{"ltree version", 90022, "", []byte{2, 'a'}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.text != "" {
+				if _, err := d.decodeText(tt.oid, []byte(tt.text)); err == nil {
+					t.Error("text: invalid value is accepted")
+				}
+			}
+			if tt.binary != nil {
+				if _, err := d.decodeBinary(tt.oid, tt.binary); err == nil {
+					t.Error("binary: invalid value is accepted")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/goccy/go-json"
+)
+
+// DDLMessagePrefix prefix of the logical decoding messages emitted by the Ditto event trigger.
+const DDLMessagePrefix = "ditto_ddl"
+
+// DDLCommand DDL statement captured by the event trigger.
+type DDLCommand struct {
+	// Event name of the trigger event: ddl_command_end or sql_drop.
+	Event string `json:"event"`
+	// Tag command tag, e.g. CREATE TABLE.
+	Tag     string      `json:"tag"`
+	Query   string      `json:"query,omitempty"`
+	Objects []DDLObject `json:"objects"`
+}
+
+// DDLObject object affected by the DDL statement.
+type DDLObject struct {
+	ObjectType string `json:"objectType"`
+	Schema     string `json:"schema"`
+	Identity   string `json:"identity"`
+	CommandTag string `json:"commandTag,omitempty"`
+}
+
+// CreateDDLAction create action from the content of a DDL message.
+func (w *WalTransaction) CreateDDLAction(content []byte) (a ActionData, err error) {
+	var cmd DDLCommand
+	if err := json.Unmarshal(content, &cmd); err != nil {
+		return a, fmt.Errorf("unmarshal ddl command: %w", err)
+	}
+
+	a = ActionData{
+		Kind: ActionKindDDL,
+		DDL:  &cmd,
+	}
+
+	if len(cmd.Objects) > 0 {
+		a.Schema = cmd.Objects[0].Schema
+	}
+
+	return a, nil
+}
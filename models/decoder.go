@@ -0,0 +1,133 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"github.com/goccy/go-json"
+)
+
+// NumericFormat representation of NUMERIC values in events.
+type NumericFormat string
+
+// kind of numeric format.
+const (
+	// NumericFormatString keeps the exact value as a JSON string, e.g. "12.50".
+	NumericFormatString NumericFormat = "string"
+	// NumericFormatNumber keeps the exact value as a JSON number, e.g. 12.50.
+	NumericFormatNumber NumericFormat = "number"
+)
+
+// UnknownTypePolicy what to publish for values of the types without a codec.
+type UnknownTypePolicy string
+
+// kind of unknown type policy.
+const (
+	// UnknownTypeString publishes the value as PostgreSQL sends it.
+	UnknownTypeString UnknownTypePolicy = "string"
+	// UnknownTypeBase64 publishes the value base64 encoded, it is safe for binary mode.
+	UnknownTypeBase64 UnknownTypePolicy = "base64"
+	// UnknownTypeSkip omits the column from the event.
+	UnknownTypeSkip UnknownTypePolicy = "skip"
+)
+
+// DecodeOptions options of the conversion of column values.
+type DecodeOptions struct {
+	NumericFormat     NumericFormat     `yaml:"numeric_format"`
+	UnknownTypePolicy UnknownTypePolicy `yaml:"unknown_type_policy"`
+	TimeFormat        TimeFormat        `yaml:"time_format"`
+	// JSONNumbers decodes the numbers of json and jsonb as json.Number, it
+	// is set for the outbox payloads which are published as they are.
+	JSONNumbers bool `yaml:"-"`
+}
+
+// Validate checks the options.
+func (o DecodeOptions) Validate() error {
+	switch o.NumericFormat {
+	case "", NumericFormatString, NumericFormatNumber:
+	default:
+		return fmt.Errorf("unsupported numeric format: %s", o.NumericFormat)
+	}
+
+	switch o.UnknownTypePolicy {
+	case "", UnknownTypeString, UnknownTypeBase64, UnknownTypeSkip:
+	default:
+		return fmt.Errorf("unsupported unknown type policy: %s", o.UnknownTypePolicy)
+	}
+
+	switch o.TimeFormat {
+	case "", TimeFormatRFC3339Nano, TimeFormatEpochMillis, TimeFormatEpochMicros:
+	default:
+		return fmt.Errorf("unsupported time format: %s", o.TimeFormat)
+	}
+
+	return nil
+}
+
+// decoder converts tuple data using the codecs, the types of the connection and the options.
+type decoder struct {
+	codecs  *CodecRegistry
+	types   *TypeStore
+	options DecodeOptions
+}
+
+// Options returns the decode options, it implements DecodeContext.
+func (d *decoder) Options() DecodeOptions {
+	if d == nil {
+		return DecodeOptions{}
+	}
+
+	return d.options
+}
+
+// DecodeText converts the value of the type, it implements DecodeContext.
+func (d *decoder) DecodeText(oid uint32, src []byte) (any, error) {
+	return d.decodeText(oid, src)
+}
+
+// codec returns the codec registered for the type.
+func (d *decoder) codec(oid uint32) TypeCodec {
+	if d == nil {
+		return DefaultCodecs.lookup(oid, nil)
+	}
+
+	codecs := d.codecs
+	if codecs == nil {
+		codecs = DefaultCodecs
+	}
+
+	return codecs.lookup(oid, d.types)
+}
+
+// unknownValue converts the value of the type without a codec according to the policy.
+// Skipped values are nil, the column itself is omitted by the caller.
+func (d *decoder) unknownValue(src []byte) any {
+	switch d.Options().UnknownTypePolicy {
+	case UnknownTypeBase64:
+		return base64.StdEncoding.EncodeToString(src)
+	case UnknownTypeSkip:
+		return nil
+	default:
+		return string(src)
+	}
+}
+
+// decodeNumeric converts NUMERIC without loss of precision. NaN and
+// Infinity have no JSON number representation and are always strings.
+func decodeNumeric(options DecodeOptions, src string) (any, error) {
+	switch src {
+	case "NaN", "Infinity", "-Infinity":
+		return src, nil
+	}
+
+	if _, ok := new(big.Rat).SetString(src); !ok {
+		return src, fmt.Errorf("invalid numeric value %q", src)
+	}
+
+	if options.NumericFormat == NumericFormatNumber {
+		return json.Number(src), nil
+	}
+
+	return src, nil
+}
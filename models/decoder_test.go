@@ -0,0 +1,106 @@
+package models
+
+import (
+	"ditto/common"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestDecodeNumeric(t *testing.T) {
+	huge := "1" + strings.Repeat("0", 130000) + "." + strings.Repeat("9", 16383)
+
+	tests := []struct {
+		name string
+		src  string
+		json string // in the number format
+	}{
+		{"integer", "42", "42"},
+		{"scale", "12.50", "12.50"},
+		{"zero scale", "0.000", "0.000"},
+		{"negative", "-0.0001", "-0.0001"},
+		{"precision", "123456789012345678901234567890.123456789012345678901234567890", "123456789012345678901234567890.123456789012345678901234567890"},
+		{"beyond float64", "179769313486231570000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001", ""},
+		{"tiny", "0." + strings.Repeat("0", 1000) + "1", ""},
+		{"max", huge, ""},
+		{"nan", "NaN", `"NaN"`},
+		{"infinity", "Infinity", `"Infinity"`},
+		{"negative infinity", "-Infinity", `"-Infinity"`},
+	}
+
+	text := &decoder{codecs: NewCodecRegistry()}
+	number := &decoder{codecs: NewCodecRegistry(), options: DecodeOptions{NumericFormat: NumericFormatNumber}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.json
+			if want == "" {
+				want = tt.src
+			}
+
+			got, err := text.decodeText(common.Numeric, []byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.src {
+				t.Errorf("string format: got %.40v", got)
+			}
+
+			got, err = number.decodeText(common.Numeric, []byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != want {
+				t.Errorf("number format: got %.40s", b)
+			}
+
+			// the binary format gives the same value
+			var n pgtype.Numeric
+			if err := n.Scan(tt.src); err != nil {
+				t.Fatal(err)
+			}
+			src, err := pgTypeMap.Encode(common.Numeric, pgtype.BinaryFormatCode, n, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = text.decodeBinary(common.Numeric, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.src {
+				t.Errorf("binary: got %.40v", got)
+			}
+		})
+	}
+}
+
+func TestDecodeNumericInvalid(t *testing.T) {
+	d := &decoder{codecs: NewCodecRegistry()}
+	for _, src := range []string{"", "12,5", "1e", "abc"} {
+		if _, err := d.decodeText(common.Numeric, []byte(src)); err == nil {
+			t.Errorf("no error for %q", src)
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	d := &decoder{codecs: NewCodecRegistry()}
+
+	for _, src := range []string{`{"a": 1}`, " [1, 2] \n", `"a"`, `null`, `18446744073709551617`} {
+		if _, err := d.decodeText(common.JSONBOID, []byte(src)); err != nil {
+			t.Errorf("%q: %v", src, err)
+		}
+	}
+
+	for _, src := range []string{``, `{"a": 1} x`, `{"a": 1}{}`, `1 2`, `"a"]`, `{"a": 1`} {
+		if _, err := d.decodeText(common.JSONOID, []byte(src)); err == nil {
+			t.Errorf("no error for %q", src)
+		}
+	}
+}
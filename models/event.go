@@ -2,20 +2,150 @@ package models
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// eventIDNamespace namespace of the UUIDv5 event identifiers.
+var eventIDNamespace = uuid.MustParse("6f1f5a0e-8d3c-5b7a-9e2d-4c1b0a9f8e7d")
+
 // Event structure for publishing to the NATS server.
 type Event struct {
-	ID        uuid.UUID      `json:"id"`
+	// ID is derived from LSN and Seq, it is the same when the change is replayed.
+	// SCHEMA_CHANGE and DDL events have IDs of their own, see DerivedEventID.
+	ID  uuid.UUID `json:"id"`
+	LSN int64     `json:"lsn"` // commit LSN of the transaction
+	XID uint32    `json:"xid"` // transaction ID
+	// Seq number of the row change in the transaction, from 0. SCHEMA_CHANGE
+	// and DDL events have the Seq of the next change.
+	Seq int `json:"seq"`
+	// TxIndex position of the event among the published events of the transaction.
+	TxIndex int `json:"txIndex"`
+	// TxTotal number of the published events of the transaction.
+	TxTotal   int            `json:"txTotal"`
+	BeginTime time.Time      `json:"beginTime"`
 	Schema    string         `json:"schema"`
 	Table     string         `json:"table"`
 	Action    string         `json:"action"`
 	Data      map[string]any `json:"data"`
 	DataOld   map[string]any `json:"dataOld"`
-	EventTime time.Time      `json:"commitTime"`
+	// Key values of the replica identity columns, from the old row of deletes
+	// and the new row otherwise. It is empty for tables without a key.
+	Key map[string]any `json:"key,omitempty"`
+	// Changed columns whose values differ between DataOld and Data of UPDATE
+	// events. It is nil when the old row is unknown, without REPLICA IDENTITY
+	// FULL, and left out of JSON when it is empty.
+	Changed []string `json:"changed,omitempty"`
+	// UnchangedToast columns with unchanged TOAST values, they are omitted from Data.
+	UnchangedToast []string `json:"unchangedToast,omitempty"`
+	// SchemaChange difference of the table structure for SCHEMA_CHANGE events.
+	SchemaChange *SchemaChange `json:"schemaChange,omitempty"`
+	// DDL captured statement for DDL events.
+	DDL *DDLCommand `json:"ddl,omitempty"`
+	// Transaction events of the transaction for COMMIT markers.
+	Transaction *TransactionSummary `json:"transaction,omitempty"`
+	EventTime   time.Time           `json:"commitTime"`
+	// KeyColumns names of the replica identity columns, they are used by the serializers.
+	KeyColumns []string `json:"-"`
+	// Columns of the table, they are used by the serializers with schemas.
+	Columns []ColumnType `json:"-"`
+	// rowKey key of the outbox row before the transforms and the scripts.
+	rowKey *RowKey
+}
+
+// OutboxRow returns the key of the replicated outbox row of the event as it
+// was before the transforms and the scripts, nil for the other events.
+func (e *Event) OutboxRow() *RowKey {
+	return e.rowKey
+}
+
+// ColumnType type of the table column.
+type ColumnType struct {
+	Name         string
+	TypeOID      uint32
+	TypeModifier int
+	IsKey        bool
+}
+
+// EventID returns identifier of the change by the commit LSN of its
+// transaction and its number in the transaction.
+func EventID(lsn int64, seq int) uuid.UUID {
+	return uuid.NewSHA1(eventIDNamespace, fmt.Appendf(nil, "%d/%d", lsn, seq))
+}
+
+// DerivedEventID returns identifier of the n-th SCHEMA_CHANGE or DDL event of
+// the kind in the transaction, it doesn't collide with the IDs of the changes.
+func DerivedEventID(lsn int64, kind ActionKind, n int) uuid.UUID {
+	return uuid.NewSHA1(eventIDNamespace, fmt.Appendf(nil, "%d/%s/%d", lsn, kind, n))
+}
+
+// keyValues returns values of the key columns, the old row of deletes holds
+// the key and the new row of the other row changes. It is nil for the
+// events without a row and when the row lacks any of the key columns.
+func (e *Event) keyValues() map[string]any {
+	var row map[string]any
+	switch e.Action {
+	case string(ActionKindInsert), string(ActionKindUpdate):
+		row = e.Data
+	case string(ActionKindDelete):
+		row = e.DataOld
+	}
+	if len(e.KeyColumns) == 0 || len(row) == 0 {
+		return nil
+	}
+
+	key := make(map[string]any, len(e.KeyColumns))
+	for _, name := range e.KeyColumns {
+		value, ok := row[name]
+		if !ok {
+			return nil
+		}
+		key[name] = value
+	}
+
+	return key
+}
+
+// filterColumns removes the columns which are not published from the event.
+func (e *Event) filterColumns(published func(name string) bool) {
+	notPublished := func(name string) bool { return !published(name) }
+
+	for _, row := range []map[string]any{e.Data, e.DataOld, e.Key} {
+		maps.DeleteFunc(row, func(name string, _ any) bool { return !published(name) })
+	}
+	if len(e.Key) == 0 {
+		e.Key = nil
+	}
+
+	e.UnchangedToast = slices.DeleteFunc(e.UnchangedToast, notPublished)
+	e.Changed = slices.DeleteFunc(e.Changed, notPublished)
+	e.KeyColumns = slices.DeleteFunc(e.KeyColumns, notPublished)
+	e.Columns = slices.DeleteFunc(slices.Clone(e.Columns), func(c ColumnType) bool { return !published(c.Name) })
+	if e.SchemaChange != nil {
+		e.SchemaChange = e.SchemaChange.filter(published)
+	}
+}
+
+// isNoopUpdate reports whether the update is known to change none of the
+// columns, any column when no columns are given.
+func (e *Event) isNoopUpdate(columns []string) bool {
+	if e.Action != string(ActionKindUpdate) || e.Changed == nil {
+		return false
+	}
+	if len(columns) == 0 {
+		return len(e.Changed) == 0
+	}
+
+	for _, name := range e.Changed {
+		if slices.Contains(columns, name) {
+			return false
+		}
+	}
+
+	return true
 }
 
 // SubjectName creates subject name from the prefix, schema and table name. Also using topic map from cfg.
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"ditto/common"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEventIDsSkipDerivedEvents(t *testing.T) {
+	commit := time.Now()
+	rel := RelationData{Schema: "public", Table: "orders", Replica: 'd', Columns: []Column{
+		{Name: "id", ValueType: common.Int4OID, ValueModifier: -1, IsKey: true},
+	}}
+	row := []common.TupleData{{Kind: common.TextDataType, Value: []byte("1")}}
+
+	events := func(schemaChange bool) []Event {
+		w := NewWalTransaction()
+		w.LSN = 100
+		w.CommitTime = &commit
+		w.RelationStore[1] = rel
+
+		for i := range 2 {
+			if schemaChange && i == 1 {
+				w.Actions = append(w.Actions, ActionData{Schema: "public", Table: "orders",
+					Kind: ActionKindSchemaChange, SchemaChange: &SchemaChange{}})
+			}
+			a, err := w.CreateActionData(1, nil, row, ActionKindInsert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Actions = append(w.Actions, a)
+		}
+
+		return w.CreateEvents()
+	}
+
+	plain, altered := events(false), events(true)
+	if len(altered) != 3 {
+		t.Fatalf("got %d events", len(altered))
+	}
+
+	if altered[0].ID != plain[0].ID || altered[2].ID != plain[1].ID || altered[2].Seq != 1 {
+		t.Fatal("schema change shifted the IDs of the changes")
+	}
+	if change := altered[1]; change.Seq != 1 || change.ID != DerivedEventID(100, ActionKindSchemaChange, 0) {
+		t.Fatalf("got %+v", change)
+	}
+}
+
+func TestEventKeyValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  map[string]any
+	}{
+		{name: "insert", event: Event{Action: "INSERT", Data: map[string]any{"id": 1, "v": "a"}}, want: map[string]any{"id": 1}},
+		{name: "null key", event: Event{Action: "INSERT", Data: map[string]any{"id": nil}}, want: map[string]any{"id": nil}},
+		{name: "delete", event: Event{Action: "DELETE", Data: map[string]any{}, DataOld: map[string]any{"id": 2}}, want: map[string]any{"id": 2}},
+		{name: "missing column", event: Event{Action: "UPDATE", Data: map[string]any{"v": "a"}}},
+		{name: "truncate", event: Event{Action: "TRUNCATE", Data: map[string]any{}}},
+		{name: "schema change", event: Event{Action: "SCHEMA_CHANGE", Data: map[string]any{}}},
+		{name: "ddl", event: Event{Action: "DDL", Data: map[string]any{"id": 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.KeyColumns = []string{"id"}
+			if got := tt.event.keyValues(); !maps.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventIsNoopUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   Event
+		columns []string
+		want    bool
+	}{
+		{name: "nothing changed", event: Event{Action: "UPDATE", Changed: []string{}}, want: true},
+		{name: "changed", event: Event{Action: "UPDATE", Changed: []string{"v"}}},
+		{name: "compared column changed", event: Event{Action: "UPDATE", Changed: []string{"v", "updated_at"}}, columns: []string{"v"}},
+		{name: "other column changed", event: Event{Action: "UPDATE", Changed: []string{"updated_at"}}, columns: []string{"v"}, want: true},
+		{name: "changes unknown", event: Event{Action: "UPDATE"}},
+		{name: "insert", event: Event{Action: "INSERT", Changed: []string{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.isNoopUpdate(tt.columns); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventFilterColumns(t *testing.T) {
+	columns := []ColumnType{{Name: "id", IsKey: true}, {Name: "email"}, {Name: "note"}, {Name: "status"}}
+	event := Event{
+		Action:         "UPDATE",
+		Data:           map[string]any{"id": 1, "email": "a@b.c", "status": "PAID"},
+		DataOld:        map[string]any{"id": 1, "email": "old@b.c", "status": "NEW"},
+		Key:            map[string]any{"id": 1},
+		KeyColumns:     []string{"id"},
+		Changed:        []string{"email", "status"},
+		UnchangedToast: []string{"note"},
+		Columns:        columns,
+	}
+
+	cfg := WatchConfig{ExcludeColumns: []string{"email", "note"}}
+	event.filterColumns(cfg.PublishesColumn)
+
+	if !maps.Equal(event.Data, map[string]any{"id": 1, "status": "PAID"}) || !maps.Equal(event.DataOld, map[string]any{"id": 1, "status": "NEW"}) {
+		t.Errorf("got data %v, old %v", event.Data, event.DataOld)
+	}
+	if !maps.Equal(event.Key, map[string]any{"id": 1}) || !slices.Equal(event.KeyColumns, []string{"id"}) {
+		t.Errorf("got key %v of %v", event.Key, event.KeyColumns)
+	}
+	if !slices.Equal(event.Changed, []string{"status"}) || len(event.UnchangedToast) != 0 {
+		t.Errorf("got changed %v, unchanged toast %v", event.Changed, event.UnchangedToast)
+	}
+	if len(event.Columns) != 2 || event.Columns[0].Name != "id" || event.Columns[1].Name != "status" {
+		t.Errorf("got columns %v", event.Columns)
+	}
+	// the columns of the relation are shared by the events
+	if len(columns) != 4 || columns[1].Name != "email" {
+		t.Errorf("filter changed the relation columns %v", columns)
+	}
+
+	// a key of only excluded columns is left out
+	event = Event{Action: "INSERT", Data: map[string]any{"email": "a@b.c"}, Key: map[string]any{"email": "a@b.c"}, KeyColumns: []string{"email"}}
+	event.filterColumns(WatchConfig{Columns: []string{"id"}}.PublishesColumn)
+	if event.Key != nil || len(event.KeyColumns) != 0 || len(event.Data) != 0 {
+		t.Errorf("got %+v", event)
+	}
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// registerExtensionCodecs registers codecs of the common extension types.
+// Extension types get their oids on CREATE EXTENSION, so they are registered by name.
+func registerExtensionCodecs(r *CodecRegistry) {
+	r.byName["hstore"] = hstoreCodec{}
+	r.byName["citext"] = textCodec{}
+	r.byName["ltree"] = ltreeCodec{}
+	r.byName["vector"] = vectorCodec{}
+}
+
+// textCodec keeps the value as a string, binary format is the same as text.
+type textCodec struct{}
+
+func (textCodec) DecodeText(_ DecodeContext, src []byte) (any, error) {
+	return string(src), nil
+}
+
+func (textCodec) DecodeBinary(_ DecodeContext, src []byte) (any, error) {
+	return string(src), nil
+}
+
+// ltreeCodec keeps the label path as a string, e.g. "top.science.astronomy".
+type ltreeCodec struct{}
+
+func (ltreeCodec) DecodeText(_ DecodeContext, src []byte) (any, error) {
+	return string(src), nil
+}
+
+// DecodeBinary strips the version byte of ltree_send.
+func (ltreeCodec) DecodeBinary(_ DecodeContext, src []byte) (any, error) {
+	if len(src) == 0 || src[0] != 1 {
+		return nil, fmt.Errorf("unsupported ltree binary version")
+	}
+
+	return string(src[1:]), nil
+}
+
+// hstoreCodec converts hstore to an object, NULL values are null.
+type hstoreCodec struct{}
+
+// DecodeText parses hstore output, e.g. "a"=>"1", "b"=>NULL.
+func (hstoreCodec) DecodeText(_ DecodeContext, src []byte) (any, error) {
+	m := make(map[string]any)
+	s := string(src)
+
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return m, nil
+		}
+
+		key, rest, ok := hstoreString(s)
+		if !ok {
+			return nil, fmt.Errorf("hstore: invalid key in %q", src)
+		}
+
+		rest, ok = strings.CutPrefix(strings.TrimLeft(rest, " "), "=>")
+		if !ok {
+			return nil, fmt.Errorf("hstore: missing => in %q", src)
+		}
+		rest = strings.TrimLeft(rest, " ")
+
+		if after, isNull := strings.CutPrefix(rest, "NULL"); isNull {
+			m[key] = nil
+			rest = after
+		} else {
+			var val string
+			val, rest, ok = hstoreString(rest)
+			if !ok {
+				return nil, fmt.Errorf("hstore: invalid value in %q", src)
+			}
+			m[key] = val
+		}
+
+		rest = strings.TrimLeft(rest, " ")
+		if rest != "" && rest[0] != ',' {
+			return nil, fmt.Errorf("hstore: missing separator in %q", src)
+		}
+		s = strings.TrimPrefix(rest, ",")
+	}
+}
+
+// hstoreString reads the double quoted string with backslash escapes.
+func hstoreString(s string) (val, rest string, ok bool) {
+	if s == "" || s[0] != '"' {
+		return "", s, false
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", s, false
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", s, false
+}
+
+// DecodeBinary reads hstore_send format: count, then length prefixed
+// keys and values, value length -1 means NULL.
+func (hstoreCodec) DecodeBinary(_ DecodeContext, src []byte) (any, error) {
+	r := &binaryReader{src: src}
+
+	count := r.int32()
+	if r.err == nil && count < 0 {
+		return nil, fmt.Errorf("hstore: invalid pair count %d", count)
+	}
+
+	m := make(map[string]any)
+	for i := int32(0); i < count && r.err == nil; i++ {
+		key, null := r.value()
+		if null {
+			return nil, fmt.Errorf("hstore: null key")
+		}
+
+		val, null := r.value()
+		if null {
+			m[string(key)] = nil
+			continue
+		}
+		m[string(key)] = string(val)
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("hstore: %w", r.err)
+	}
+
+	return m, nil
+}
+
+// vectorCodec converts pgvector vector to an array of numbers.
+type vectorCodec struct{}
+
+// DecodeText parses vector output, e.g. [1,2.5,3].
+func (vectorCodec) DecodeText(_ DecodeContext, src []byte) (any, error) {
+	s, ok := strings.CutPrefix(string(src), "[")
+	if ok {
+		s, ok = strings.CutSuffix(s, "]")
+	}
+	if !ok {
+		return nil, fmt.Errorf("vector: invalid value %q", src)
+	}
+
+	if strings.TrimSpace(s) == "" {
+		return []float32{}, nil
+	}
+
+	parts := strings.Split(s, ",")
+	vec := make([]float32, 0, len(parts))
+	for _, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return nil, fmt.Errorf("vector: %w", err)
+		}
+		vec = append(vec, float32(f))
+	}
+
+	return vec, nil
+}
+
+// DecodeBinary reads vector_send format: dimensions and an unused
+// int16, then float4 elements.
+func (vectorCodec) DecodeBinary(_ DecodeContext, src []byte) (any, error) {
+	if len(src) < 4 {
+		return nil, fmt.Errorf("vector: short value")
+	}
+
+	dim := int(binary.BigEndian.Uint16(src))
+	if len(src) != 4+dim*4 {
+		return nil, fmt.Errorf("vector: %d dimensions in %d bytes", dim, len(src))
+	}
+
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.BigEndian.Uint32(src[4+i*4:]))
+	}
+
+	return vec, nil
+}
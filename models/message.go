@@ -0,0 +1,12 @@
+package models
+
+// Message serialized event ready to be sent to the broker.
+type Message struct {
+	// Key identifies the entity of the event, sinks use it for partitioning.
+	Key []byte
+	// Headers are sent only by the sinks which support them.
+	Headers map[string]string
+	Value   []byte
+	// ContentType media type of the Value, e.g. application/json.
+	ContentType string
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"gopkg.in/yaml.v3"
+)
+
+// ProcessedRows what happens to the published rows of an outbox table.
+type ProcessedRows string
+
+// kind of processed rows.
+const (
+	// ProcessedRowsIgnore leaves the rows to the service, the DELETE events
+	// of the table are ignored.
+	ProcessedRowsIgnore ProcessedRows = "ignore"
+	// ProcessedRowsDelete deletes the published rows, the DELETE events of the
+	// rows deleted by the service are ignored with a warning.
+	ProcessedRowsDelete ProcessedRows = "delete"
+)
+
+// OutboxConfig routes the rows of an outbox table: the topic is the aggregate
+// type, the message key is the aggregate ID, the value is the payload and the
+// other columns are headers.
+type OutboxConfig struct {
+	// AggregateTypeColumn column with the topic of the row, "aggregate_type" by default.
+	AggregateTypeColumn string `yaml:"aggregate_type_column"`
+	// AggregateIDColumn column with the message key of the row, "aggregate_id" by default.
+	AggregateIDColumn string `yaml:"aggregate_id_column"`
+	// PayloadColumn column with the message value of the row, "payload" by default.
+	PayloadColumn string `yaml:"payload_column"`
+	// ProcessedRows deletes the published rows or ignores the DELETE events
+	// of the table, "ignore" by default.
+	ProcessedRows ProcessedRows `yaml:"processed_rows"`
+
+	topic TopicTemplate
+}
+
+// UnmarshalYAML sets the default columns of the config.
+func (c *OutboxConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain OutboxConfig
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.AggregateTypeColumn == "" {
+		c.AggregateTypeColumn = "aggregate_type"
+	}
+	if c.AggregateIDColumn == "" {
+		c.AggregateIDColumn = "aggregate_id"
+	}
+	if c.PayloadColumn == "" {
+		c.PayloadColumn = "payload"
+	}
+	if c.ProcessedRows == "" {
+		c.ProcessedRows = ProcessedRowsIgnore
+	}
+
+	topic, err := NewTopicTemplate("{data." + c.AggregateTypeColumn + "}")
+	if err != nil {
+		return err
+	}
+	// aggregate types are often qualified names such as com.acme.Order
+	topic.dotted = true
+	c.topic = topic
+
+	return nil
+}
+
+// Validate checks the outbox config.
+func (c OutboxConfig) Validate() error {
+	if c.AggregateTypeColumn == c.PayloadColumn || c.AggregateIDColumn == c.PayloadColumn {
+		return errors.New("outbox payload_column can't be the aggregate type or ID")
+	}
+
+	switch c.ProcessedRows {
+	case "", ProcessedRowsIgnore, ProcessedRowsDelete:
+	default:
+		return fmt.Errorf("unsupported outbox processed_rows: %s", c.ProcessedRows)
+	}
+
+	return nil
+}
+
+// Topic returns the topic template of the rows, the aggregate type.
+func (c OutboxConfig) Topic() TopicTemplate {
+	return c.topic
+}
+
+// DeletesProcessed reports whether the published rows are deleted.
+func (c OutboxConfig) DeletesProcessed() bool {
+	return c.ProcessedRows == ProcessedRowsDelete
+}
+
+// OutboxPayloads returns the payload columns of the outbox tables of the
+// watch list by table.
+func OutboxPayloads(watchList map[string]WatchConfig) map[string]string {
+	payloads := make(map[string]string)
+	for table, w := range watchList {
+		if w.Outbox != nil {
+			payloads[table] = w.Outbox.PayloadColumn
+		}
+	}
+
+	return payloads
+}
+
+// IsHeader reports whether the column is sent in the headers.
+func (c OutboxConfig) IsHeader(name string) bool {
+	return name != c.AggregateTypeColumn && name != c.AggregateIDColumn && name != c.PayloadColumn
+}
+
+// OutboxRows rows of the outbox tables deleted after they were published,
+// their DELETE events are expected. It is safe for concurrent use.
+type OutboxRows struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// NewOutboxRows creates an empty set of rows.
+func NewOutboxRows() *OutboxRows {
+	return &OutboxRows{keys: make(map[string]bool)}
+}
+
+// Add remembers the deleted row.
+func (r *OutboxRows) Add(row RowKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys[row.String()] = true
+}
+
+// Forget reports whether the row of the DELETE event was added and forgets it.
+func (r *OutboxRows) Forget(e Event) bool {
+	row := newRowKey(e)
+	if r == nil || row == nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := row.String()
+	if !r.keys[key] {
+		return false
+	}
+	delete(r.keys, key)
+
+	return true
+}
+
+// RowKey identifies the replicated row of an event by its replica identity.
+type RowKey struct {
+	Schema  string
+	Table   string
+	Columns []string
+	Values  map[string]any
+}
+
+// newRowKey returns the key of the event row, nil when it has no key. The
+// values are copied, the transforms change the key of the event in place.
+func newRowKey(e Event) *RowKey {
+	if len(e.KeyColumns) == 0 || len(e.Key) == 0 {
+		return nil
+	}
+
+	return &RowKey{Schema: e.Schema, Table: e.Table, Columns: e.KeyColumns, Values: maps.Clone(e.Key)}
+}
+
+// String returns the table and the key values of the row.
+func (k RowKey) String() string {
+	values, _ := json.Marshal(k.Values)
+
+	return k.Schema + "." + k.Table + " " + string(values)
+}
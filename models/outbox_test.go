@@ -0,0 +1,194 @@
+package models
+
+import (
+	"ditto/common"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"gopkg.in/yaml.v3"
+)
+
+// outboxTransaction returns a transaction of the outbox table with the
+// watch list of the config.
+func outboxTransaction(t *testing.T, config string) (*WalTransaction, map[string]WatchConfig) {
+	t.Helper()
+
+	var watchList map[string]WatchConfig
+	if err := yaml.Unmarshal([]byte(config), &watchList); err != nil {
+		t.Fatal(err)
+	}
+
+	commit := time.Now()
+	w := NewWalTransaction()
+	w.LSN = 100
+	w.CommitTime = &commit
+	w.OutboxPayloads = OutboxPayloads(watchList)
+	w.RelationStore[1] = RelationData{Schema: "public", Table: "outbox", Replica: 'd', Columns: []Column{
+		{Name: "id", ValueType: common.Int8OID, ValueModifier: -1, IsKey: true},
+		{Name: "aggregate_type", ValueType: common.TextOID, ValueModifier: -1},
+		{Name: "aggregate_id", ValueType: common.TextOID, ValueModifier: -1},
+		{Name: "payload", ValueType: common.JSONBOID, ValueModifier: -1},
+		{Name: "meta", ValueType: common.JSONBOID, ValueModifier: -1},
+	}}
+
+	return w, watchList
+}
+
+// outboxRow returns the tuple of the outbox row with the id.
+func outboxRow(id string) []common.TupleData {
+	text := func(s string) common.TupleData { return common.TupleData{Kind: common.TextDataType, Value: []byte(s)} }
+
+	return []common.TupleData{
+		text(id),
+		text("Order"),
+		text("42"),
+		text(`{"id": 9007199254740993, "total": 2.50}`),
+		text(`{"n": 9007199254740993}`),
+	}
+}
+
+func TestOutboxPayloadNumbers(t *testing.T) {
+	w, _ := outboxTransaction(t, `outbox: {outbox: {}}`)
+
+	a, err := w.CreateActionData(1, nil, outboxRow("1"), ActionKindInsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := columnsData(a.NewColumns)
+
+	payload := data["payload"].(map[string]any)
+	if payload["id"] != json.Number("9007199254740993") || payload["total"] != json.Number("2.50") {
+		t.Errorf("got payload %#v", payload)
+	}
+	// the other json columns are decoded as usual
+	if meta := data["meta"].(map[string]any); meta["n"] != float64(9007199254740993) {
+		t.Errorf("got meta %#v", meta)
+	}
+}
+
+func TestOutboxDeletes(t *testing.T) {
+	tests := []struct {
+		processed string
+		deleted   bool
+	}{
+		{processed: "ignore"},
+		{processed: "delete", deleted: true},
+		{processed: "delete"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.processed, func(t *testing.T) {
+			w, watchList := outboxTransaction(t, `outbox: {outbox: {processed_rows: `+tt.processed+`}}`)
+			w.DeletedOutboxRows = NewOutboxRows()
+
+			for _, kind := range []ActionKind{ActionKindInsert, ActionKindUpdate, ActionKindDelete} {
+				old, row := outboxRow("1"), outboxRow("1")
+				switch kind {
+				case ActionKindInsert:
+					old = nil
+				case ActionKindDelete:
+					row = nil
+				}
+				a, err := w.CreateActionData(1, old, row, kind)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w.Actions = append(w.Actions, a)
+			}
+
+			events := w.CreateEventsWithWatchList(watchList)
+			if len(events) != 1 || events[0].Action != string(ActionKindInsert) {
+				t.Fatalf("got %d events, want the insert", len(events))
+			}
+
+			if tt.deleted {
+				w.DeletedOutboxRows.Add(*events[0].OutboxRow())
+				w.CreateEventsWithWatchList(watchList)
+			}
+
+			// the DELETE event forgets the deleted row
+			if w.DeletedOutboxRows.Forget(events[0]) {
+				t.Error("the deleted row is still expected")
+			}
+		})
+	}
+}
+
+func TestOutboxRows(t *testing.T) {
+	insert := Event{Schema: "public", Table: "outbox", KeyColumns: []string{"id", "part"}, Key: map[string]any{"id": int64(1), "part": "a"}}
+	other := Event{Schema: "public", Table: "outbox", KeyColumns: []string{"id", "part"}, Key: map[string]any{"id": int64(2), "part": "a"}}
+
+	rows := NewOutboxRows()
+	rows.Add(*newRowKey(insert))
+
+	if rows.Forget(other) {
+		t.Error("forgot a row which was not added")
+	}
+	if !rows.Forget(insert) {
+		t.Error("the added row is not known")
+	}
+	if rows.Forget(insert) {
+		t.Error("the row is forgotten once")
+	}
+	if (*OutboxRows)(nil).Forget(insert) || rows.Forget(Event{Schema: "public", Table: "outbox"}) {
+		t.Error("forgot a row without a set or a key")
+	}
+}
+
+func TestOutboxRowBeforeTransforms(t *testing.T) {
+	w, watchList := outboxTransaction(t, `outbox: {outbox: {processed_rows: delete}, transforms: {id: {type: hash}}}`)
+	if err := watchList["outbox"].Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := w.CreateActionData(1, nil, outboxRow("1"), ActionKindInsert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Actions = append(w.Actions, a)
+
+	event := w.CreateEventsWithWatchList(watchList)[0]
+	if event.Key["id"] == int64(1) {
+		t.Fatal("the key is not transformed")
+	}
+
+	row := event.OutboxRow()
+	if row == nil || row.Schema != "public" || row.Table != "outbox" || row.Values["id"] != int64(1) || len(row.Columns) != 1 {
+		t.Fatalf("got row %+v", row)
+	}
+	// the row key is not shared with the event
+	event.Key["id"] = "x"
+	if row.Values["id"] != int64(1) {
+		t.Error("the row key changed with the event")
+	}
+}
+
+func TestOutboxConfig(t *testing.T) {
+	var c OutboxConfig
+	if err := yaml.Unmarshal([]byte(`{}`), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.AggregateTypeColumn != "aggregate_type" || c.AggregateIDColumn != "aggregate_id" ||
+		c.PayloadColumn != "payload" || c.ProcessedRows != ProcessedRowsIgnore || c.DeletesProcessed() {
+		t.Errorf("got defaults %+v", c)
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{`{processed_rows: keep}`, "unsupported outbox processed_rows: keep"},
+		{`{payload_column: aggregate_id}`, "payload_column can't be the aggregate type or ID"},
+	}
+	for _, tt := range tests {
+		var c OutboxConfig
+		if err := yaml.Unmarshal([]byte(tt.config), &c); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.config, err, tt.want)
+		}
+	}
+}
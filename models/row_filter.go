@@ -0,0 +1,85 @@
+package models
+
+import (
+	"ditto/filter"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rowFilterVars variables of the row filter expressions.
+var rowFilterVars = []string{"schema", "table", "action", "data", "dataOld", "key", "changed"}
+
+// RowFilter filter expression of the row events of a table, it is compiled
+// when the config is loaded.
+type RowFilter struct {
+	*filter.Expression
+	pushedDown atomic.Bool
+}
+
+// NewRowFilter compiles the filter expression.
+func NewRowFilter(src string) (*RowFilter, error) {
+	expr, err := filter.Compile(src, rowFilterVars...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RowFilter{Expression: expr}, nil
+}
+
+// UnmarshalYAML compiles the expression of the config.
+func (f *RowFilter) UnmarshalYAML(value *yaml.Node) error {
+	var src string
+	if err := value.Decode(&src); err != nil {
+		return err
+	}
+
+	compiled, err := NewRowFilter(src)
+	if err != nil {
+		return err
+	}
+	f.Expression = compiled.Expression
+
+	return nil
+}
+
+// SQL returns the publication row filter of the expression over the columns
+// of the table, see filter.Expression.SQL.
+func (f *RowFilter) SQL(columns map[string]filter.ColumnType) (string, bool) {
+	return f.Expression.SQL("data", columns)
+}
+
+// Columns returns the columns of the table which the expression references in data.
+func (f *RowFilter) Columns() []string {
+	return f.Expression.Columns("data")
+}
+
+// SetPushedDown marks the filter as evaluated by the publication, it is not
+// evaluated by the service then.
+func (f *RowFilter) SetPushedDown(pushedDown bool) {
+	f.pushedDown.Store(pushedDown)
+}
+
+// match evaluates the filter over the row event, errors such as a missing
+// column are reported with false. data of a DELETE is its old row, the same
+// as in the publication row filters.
+func (f *RowFilter) match(e *Event) (bool, error) {
+	if f.pushedDown.Load() {
+		return true, nil
+	}
+
+	data := e.Data
+	if e.Action == string(ActionKindDelete) {
+		data = e.DataOld
+	}
+
+	return f.Match(map[string]any{
+		"schema":  e.Schema,
+		"table":   e.Table,
+		"action":  e.Action,
+		"data":    data,
+		"dataOld": e.DataOld,
+		"key":     e.Key,
+		"changed": e.Changed,
+	})
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestRowFilterMatch(t *testing.T) {
+	f, err := NewRowFilter(`data.status == "PAID"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		event Event
+		want  bool
+	}{
+		{name: "insert", event: Event{Action: "INSERT", Data: map[string]any{"status": "PAID"}}, want: true},
+		{name: "update", event: Event{Action: "UPDATE", Data: map[string]any{"status": "NEW"}, DataOld: map[string]any{"status": "PAID"}}},
+		{name: "delete", event: Event{Action: "DELETE", Data: map[string]any{}, DataOld: map[string]any{"status": "PAID"}}, want: true},
+		{name: "delete of other row", event: Event{Action: "DELETE", Data: map[string]any{}, DataOld: map[string]any{"status": "NEW"}}},
+		{name: "delete without the column", event: Event{Action: "DELETE", Data: map[string]any{}, DataOld: map[string]any{"id": 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := f.match(&tt.event)
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package models
+
+import "slices"
+
+// SchemaChange difference between the cached relation and the new Relation message.
+type SchemaChange struct {
+	AddedColumns          []ColumnChange `json:"addedColumns,omitempty"`
+	DroppedColumns        []ColumnChange `json:"droppedColumns,omitempty"`
+	RetypedColumns        []ColumnChange `json:"retypedColumns,omitempty"`
+	KeyChangedColumns     []ColumnChange `json:"keyChangedColumns,omitempty"`
+	ReplicaIdentityBefore string         `json:"replicaIdentityBefore"`
+	ReplicaIdentityAfter  string         `json:"replicaIdentityAfter"`
+}
+
+// ColumnChange column of the schema change.
+type ColumnChange struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	TypeOID      int    `json:"typeOid"`
+	OldType      string `json:"oldType,omitempty"`
+	OldTypeOID   int    `json:"oldTypeOid,omitempty"`
+	TypeModifier int    `json:"typeModifier"`
+	IsKey        bool   `json:"isKey"`
+}
+
+// replicaIdentity name of the replica identity setting (relreplident in pg_class).
+func replicaIdentity(replica int8) string {
+	switch replica {
+	case 'd':
+		return "default"
+	case 'n':
+		return "nothing"
+	case 'f':
+		return "full"
+	case 'i':
+		return "index"
+	default:
+		return string(rune(replica))
+	}
+}
+
+// DiffRelations compares the cached relation with the received one, it
+// returns nil if the structure of the table is the same.
+func (w *WalTransaction) DiffRelations(before, after RelationData) *SchemaChange {
+	change := &SchemaChange{
+		ReplicaIdentityBefore: replicaIdentity(before.Replica),
+		ReplicaIdentityAfter:  replicaIdentity(after.Replica),
+	}
+
+	oldColumns := make(map[string]Column, len(before.Columns))
+	for _, c := range before.Columns {
+		oldColumns[c.Name] = c
+	}
+
+	newColumns := make(map[string]bool, len(after.Columns))
+	for _, c := range after.Columns {
+		newColumns[c.Name] = true
+
+		old, ok := oldColumns[c.Name]
+		if !ok {
+			change.AddedColumns = append(change.AddedColumns, w.columnChange(c))
+			continue
+		}
+
+		if old.ValueType != c.ValueType || old.ValueModifier != c.ValueModifier {
+			cc := w.columnChange(c)
+			cc.OldTypeOID = old.ValueType
+			cc.OldType = w.typeName(old.ValueType)
+			change.RetypedColumns = append(change.RetypedColumns, cc)
+		}
+
+		if old.IsKey != c.IsKey {
+			change.KeyChangedColumns = append(change.KeyChangedColumns, w.columnChange(c))
+		}
+	}
+
+	for _, c := range before.Columns {
+		if !newColumns[c.Name] {
+			change.DroppedColumns = append(change.DroppedColumns, w.columnChange(c))
+		}
+	}
+
+	if len(change.AddedColumns) == 0 && len(change.DroppedColumns) == 0 &&
+		len(change.RetypedColumns) == 0 && len(change.KeyChangedColumns) == 0 &&
+		before.Replica == after.Replica {
+		return nil
+	}
+
+	return change
+}
+
+// filter returns the change of the published columns, nil when only the
+// columns which are not published have changed.
+func (c *SchemaChange) filter(published func(name string) bool) *SchemaChange {
+	notPublished := func(cc ColumnChange) bool { return !published(cc.Name) }
+
+	change := &SchemaChange{
+		AddedColumns:          slices.DeleteFunc(slices.Clone(c.AddedColumns), notPublished),
+		DroppedColumns:        slices.DeleteFunc(slices.Clone(c.DroppedColumns), notPublished),
+		RetypedColumns:        slices.DeleteFunc(slices.Clone(c.RetypedColumns), notPublished),
+		KeyChangedColumns:     slices.DeleteFunc(slices.Clone(c.KeyChangedColumns), notPublished),
+		ReplicaIdentityBefore: c.ReplicaIdentityBefore,
+		ReplicaIdentityAfter:  c.ReplicaIdentityAfter,
+	}
+
+	if len(change.AddedColumns) == 0 && len(change.DroppedColumns) == 0 &&
+		len(change.RetypedColumns) == 0 && len(change.KeyChangedColumns) == 0 &&
+		change.ReplicaIdentityBefore == change.ReplicaIdentityAfter {
+		return nil
+	}
+
+	return change
+}
+
+func (w *WalTransaction) columnChange(c Column) ColumnChange {
+	return ColumnChange{
+		Name:         c.Name,
+		Type:         w.typeName(c.ValueType),
+		TypeOID:      c.ValueType,
+		TypeModifier: c.ValueModifier,
+		IsKey:        c.IsKey,
+	}
+}
+
+// typeName returns name of the data type or an empty string if it is unknown.
+func (w *WalTransaction) typeName(oid int) string {
+	if t, ok := pgTypeMap.TypeForOID(uint32(oid)); ok {
+		return t.Name
+	}
+
+	if w.TypeStore != nil {
+		if info, err := w.TypeStore.Lookup(uint32(oid)); err == nil {
+			return info.Name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"ditto/common"
+	"testing"
+	"time"
+)
+
+func TestDiffRelationsKeyChange(t *testing.T) {
+	w := NewWalTransaction()
+	before := RelationData{Schema: "public", Table: "orders", Replica: 'd', Columns: []Column{
+		{Name: "id", ValueType: common.Int4OID, ValueModifier: -1, IsKey: true},
+		{Name: "code", ValueType: common.TextOID, ValueModifier: -1},
+	}}
+	after := RelationData{Schema: "public", Table: "orders", Replica: 'i', Columns: []Column{
+		{Name: "id", ValueType: common.Int4OID, ValueModifier: -1},
+		{Name: "code", ValueType: common.TextOID, ValueModifier: -1, IsKey: true},
+	}}
+
+	change := w.DiffRelations(before, after)
+	if change == nil {
+		t.Fatal("key change is not reported")
+	}
+	if len(change.KeyChangedColumns) != 2 {
+		t.Fatalf("got %+v", change.KeyChangedColumns)
+	}
+	if c := change.KeyChangedColumns[0]; c.Name != "id" || c.IsKey {
+		t.Errorf("got %+v", c)
+	}
+	if c := change.KeyChangedColumns[1]; c.Name != "code" || !c.IsKey {
+		t.Errorf("got %+v", c)
+	}
+
+	// the key changes even when the replica identity stays the default
+	after.Replica = 'd'
+	if w.DiffRelations(before, after) == nil {
+		t.Fatal("key change with the same replica identity is not reported")
+	}
+
+	if change := w.DiffRelations(before, before); change != nil {
+		t.Fatalf("got %+v for the same relation", change)
+	}
+}
+
+func TestSchemaChangeColumnLists(t *testing.T) {
+	commit := time.Now()
+	w := NewWalTransaction()
+	w.LSN = 100
+	w.CommitTime = &commit
+	before := RelationData{Schema: "public", Table: "users", Replica: 'd', Columns: []Column{
+		{Name: "id", ValueType: common.Int4OID, ValueModifier: -1, IsKey: true},
+		{Name: "email", ValueType: common.TextOID, ValueModifier: -1},
+		{Name: "ssn", ValueType: common.TextOID, ValueModifier: -1},
+	}}
+	after := RelationData{Schema: "public", Table: "users", Replica: 'd', Columns: []Column{
+		{Name: "id", ValueType: common.Int4OID, ValueModifier: -1, IsKey: true},
+		{Name: "email", ValueType: common.VarcharOID, ValueModifier: -1},
+		{Name: "ssn", ValueType: common.VarcharOID, ValueModifier: -1},
+		{Name: "password", ValueType: common.TextOID, ValueModifier: -1},
+	}}
+
+	events := func(cfg WatchConfig, after RelationData) []Event {
+		w.Actions = []ActionData{{Schema: "public", Table: "users", Kind: ActionKindSchemaChange,
+			SchemaChange: w.DiffRelations(before, after)}}
+
+		return w.CreateEventsWithWatchList(map[string]WatchConfig{"users": cfg})
+	}
+
+	got := events(WatchConfig{ExcludeColumns: []string{"ssn", "password"}}, after)
+	if len(got) != 1 {
+		t.Fatalf("got %d events", len(got))
+	}
+	change := got[0].SchemaChange
+	if len(change.AddedColumns) != 0 {
+		t.Errorf("excluded column is added: %+v", change.AddedColumns)
+	}
+	if len(change.RetypedColumns) != 1 || change.RetypedColumns[0].Name != "email" {
+		t.Errorf("got retyped %+v", change.RetypedColumns)
+	}
+	if len(w.Actions[0].SchemaChange.RetypedColumns) != 2 {
+		t.Error("the change of the action was modified")
+	}
+
+	// only the columns which are not published have changed
+	retyped := after
+	retyped.Columns = append([]Column{}, before.Columns...)
+	retyped.Columns[2].ValueType = common.VarcharOID
+	if got := events(WatchConfig{Columns: []string{"id", "email"}}, retyped); len(got) != 0 {
+		t.Errorf("got %+v", got[0].SchemaChange)
+	}
+
+	// the replica identity is reported whatever the columns
+	retyped.Replica = 'f'
+	if got := events(WatchConfig{Columns: []string{"id", "email"}}, retyped); len(got) != 1 {
+		t.Errorf("got %d events", len(got))
+	}
+}
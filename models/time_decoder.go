@@ -0,0 +1,366 @@
+package models
+
+import (
+	"ditto/common"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeFormat representation of date and time values in events.
+type TimeFormat string
+
+// kind of time format.
+const (
+	// TimeFormatRFC3339Nano writes values as RFC 3339 strings, e.g. "2024-01-02T03:04:05.123456Z".
+	TimeFormatRFC3339Nano TimeFormat = "rfc3339nano"
+	// TimeFormatEpochMillis writes values as milliseconds since the Unix epoch.
+	TimeFormatEpochMillis TimeFormat = "epoch_millis"
+	// TimeFormatEpochMicros writes values as microseconds since the Unix epoch.
+	TimeFormatEpochMicros TimeFormat = "epoch_micros"
+)
+
+// postgresEpoch zero point of the binary date and time values.
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// microsPerDay length of the day, time of day values are in [0, microsPerDay].
+const microsPerDay = int64(24 * time.Hour / time.Microsecond)
+
+// timeCodec converts timestamp, timestamptz, date, time and timetz
+// in text (DateStyle ISO) and binary formats.
+type timeCodec struct {
+	oid uint32
+}
+
+func (c timeCodec) DecodeText(ctx DecodeContext, src []byte) (any, error) {
+	s := string(src)
+
+	switch c.oid {
+	case common.TimestampOID, common.TimestamptzOID, common.DateOID:
+		if s == "infinity" || s == "-infinity" {
+			return s, nil
+		}
+	}
+
+	format := ctx.Options().TimeFormat
+
+	switch c.oid {
+	case common.TimestampOID, common.TimestamptzOID:
+		t, err := parseTimestamp(s, c.oid == common.TimestamptzOID)
+		if err != nil {
+			return s, err
+		}
+		// binary values have no offset, the session TimeZone must not
+		// make the text mode differ from them
+		return formatTimestamp(format, t.UTC()), nil
+
+	case common.DateOID:
+		t, err := parseTimestamp(s, false)
+		if err != nil {
+			return s, err
+		}
+		return formatDate(format, t), nil
+
+	default:
+		us, offset, err := parseTimeOfDay(s, c.oid == common.TimetzOID)
+		if err != nil {
+			return s, err
+		}
+		return formatTimeOfDay(format, us, offset, c.oid == common.TimetzOID), nil
+	}
+}
+
+// DecodeBinary reads the values counted from 2000-01-01, timestamps and
+// times in microseconds, dates in days. Maximum and minimum are ±infinity.
+func (c timeCodec) DecodeBinary(ctx DecodeContext, src []byte) (any, error) {
+	format := ctx.Options().TimeFormat
+
+	switch c.oid {
+	case common.TimestampOID, common.TimestamptzOID:
+		if len(src) != 8 {
+			return nil, fmt.Errorf("timestamp: invalid length %d", len(src))
+		}
+		us := int64(binary.BigEndian.Uint64(src))
+		switch us {
+		case math.MaxInt64:
+			return "infinity", nil
+		case math.MinInt64:
+			return "-infinity", nil
+		}
+		return formatTimestamp(format, fromPostgresMicros(us)), nil
+
+	case common.DateOID:
+		if len(src) != 4 {
+			return nil, fmt.Errorf("date: invalid length %d", len(src))
+		}
+		days := int32(binary.BigEndian.Uint32(src))
+		switch days {
+		case math.MaxInt32:
+			return "infinity", nil
+		case math.MinInt32:
+			return "-infinity", nil
+		}
+		return formatDate(format, postgresEpoch.AddDate(0, 0, int(days))), nil
+
+	case common.TimeOID:
+		if len(src) != 8 {
+			return nil, fmt.Errorf("time: invalid length %d", len(src))
+		}
+		return formatTimeOfDay(format, int64(binary.BigEndian.Uint64(src)), 0, false), nil
+
+	default:
+		if len(src) != 12 {
+			return nil, fmt.Errorf("timetz: invalid length %d", len(src))
+		}
+		// zone is stored in seconds west of UTC
+		offset := -int(int32(binary.BigEndian.Uint32(src[8:])))
+		return formatTimeOfDay(format, int64(binary.BigEndian.Uint64(src)), offset, true), nil
+	}
+}
+
+// fromPostgresMicros returns the time us microseconds from 2000-01-01 in UTC.
+// time.Duration covers only ±292 years, so the value is split into seconds.
+func fromPostgresMicros(us int64) time.Time {
+	return time.Unix(postgresEpoch.Unix()+us/1_000_000, us%1_000_000*1000).UTC()
+}
+
+// parseTimestamp parses ISO date or timestamp, e.g. "2024-01-02",
+// "2024-01-02 03:04:05.123456+05:30" or "0044-03-15 12:00:00 BC".
+// Values without time zone are in UTC.
+func parseTimestamp(s string, withTZ bool) (time.Time, error) {
+	src := s
+
+	bc := false
+	if rest, ok := strings.CutSuffix(s, " BC"); ok {
+		s, bc = rest, true
+	}
+
+	year, n := leadingInt(s)
+	if n < 4 || len(s) < n+6 || s[n] != '-' || s[n+3] != '-' {
+		return time.Time{}, fmt.Errorf("invalid date %q", src)
+	}
+	month, mn := leadingInt(s[n+1:])
+	day, dn := leadingInt(s[n+4:])
+	if mn != 2 || dn != 2 || month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("invalid date %q", src)
+	}
+	s = s[n+6:]
+
+	var us int64
+	offset := 0
+	if s != "" {
+		rest, ok := strings.CutPrefix(s, " ")
+		if !ok {
+			rest, ok = strings.CutPrefix(s, "T")
+		}
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", src)
+		}
+
+		var err error
+		us, offset, err = parseTimeOfDay(rest, withTZ)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", src, err)
+		}
+	}
+
+	if bc {
+		// 1 BC is year 0 in the proleptic Gregorian calendar
+		year = 1 - year
+	}
+
+	loc := time.UTC
+	if offset != 0 {
+		loc = time.FixedZone("", offset)
+	}
+
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc).Add(time.Duration(us) * time.Microsecond), nil
+}
+
+// parseTimeOfDay parses time with optional fraction and, when withTZ
+// is set, the offset: "03:04:05.123+05:30", "03:04:05-07" or "03:04:05Z".
+// It returns microseconds since midnight and the offset in seconds east of UTC.
+func parseTimeOfDay(s string, withTZ bool) (us int64, offset int, err error) {
+	src := s
+
+	if len(s) < 8 || s[2] != ':' || s[5] != ':' {
+		return 0, 0, fmt.Errorf("invalid time %q", src)
+	}
+
+	hour, hn := leadingInt(s)
+	minute, mn := leadingInt(s[3:])
+	sec, sn := leadingInt(s[6:])
+	if hn != 2 || mn != 2 || sn != 2 || hour > 24 || minute > 59 || sec > 60 {
+		return 0, 0, fmt.Errorf("invalid time %q", src)
+	}
+	s = s[8:]
+
+	var frac int64
+	if strings.HasPrefix(s, ".") {
+		digits, n := leadingDigits(s[1:])
+		if n == 0 || n > 9 {
+			return 0, 0, fmt.Errorf("invalid fraction in %q", src)
+		}
+		// round nanoseconds to microseconds like postgres does
+		nanos, _ := strconv.ParseInt((digits + "000000000")[:9], 10, 64)
+		frac = (nanos + 500) / 1000
+		s = s[1+n:]
+	}
+
+	us = ((int64(hour)*60+int64(minute))*60+int64(sec))*1_000_000 + frac
+	if us > microsPerDay {
+		return 0, 0, fmt.Errorf("invalid time %q", src)
+	}
+
+	if !withTZ {
+		if s != "" {
+			return 0, 0, fmt.Errorf("unexpected time zone in %q", src)
+		}
+		return us, 0, nil
+	}
+
+	offset, err = parseOffset(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time zone in %q", src)
+	}
+
+	return us, offset, nil
+}
+
+// parseOffset parses "Z", "+05", "+05:30" or "-03:30:15" to seconds east of UTC.
+func parseOffset(s string) (int, error) {
+	if s == "Z" {
+		return 0, nil
+	}
+	if s == "" || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("invalid offset %q", s)
+	}
+
+	sign := 1
+	if s[0] == '-' {
+		sign = -1
+	}
+
+	var parts [3]int
+	rest := s[1:]
+	for i := range parts {
+		v, n := leadingInt(rest)
+		if n != 2 {
+			return 0, fmt.Errorf("invalid offset %q", s)
+		}
+		parts[i] = v
+		rest = rest[n:]
+		if rest == "" {
+			break
+		}
+		if rest[0] != ':' || i == len(parts)-1 {
+			return 0, fmt.Errorf("invalid offset %q", s)
+		}
+		rest = rest[1:]
+	}
+
+	if parts[1] > 59 || parts[2] > 59 {
+		return 0, fmt.Errorf("invalid offset %q", s)
+	}
+
+	return sign * (parts[0]*3600 + parts[1]*60 + parts[2]), nil
+}
+
+// leadingDigits returns the leading decimal digits of s.
+func leadingDigits(s string) (string, int) {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+
+	return s[:n], n
+}
+
+// leadingInt returns the value of the leading decimal digits of s.
+func leadingInt(s string) (int, int) {
+	digits, n := leadingDigits(s)
+	if n == 0 || n > 9 {
+		return 0, 0
+	}
+
+	v, _ := strconv.Atoi(digits)
+
+	return v, n
+}
+
+// formatTimestamp writes the timestamp in UTC in the format.
+func formatTimestamp(format TimeFormat, t time.Time) any {
+	switch format {
+	case TimeFormatEpochMillis:
+		return t.UnixMilli()
+	case TimeFormatEpochMicros:
+		return t.UnixMicro()
+	}
+
+	return formatYear(t.Year()) + t.Format("-01-02T15:04:05.999999Z")
+}
+
+// formatDate writes the date in the format, epoch formats give its midnight in UTC.
+func formatDate(format TimeFormat, t time.Time) any {
+	switch format {
+	case TimeFormatEpochMillis:
+		return t.UnixMilli()
+	case TimeFormatEpochMicros:
+		return t.UnixMicro()
+	}
+
+	return formatYear(t.Year()) + t.Format("-01-02")
+}
+
+// formatYear writes the year with at least four digits, years before
+// 1 AD are negative (1 BC is 0000, 2 BC is -0001) as ISO 8601 has it.
+func formatYear(year int) string {
+	if year < 0 {
+		return fmt.Sprintf("-%04d", -year)
+	}
+
+	return fmt.Sprintf("%04d", year)
+}
+
+// formatTimeOfDay writes time of day in the format, epoch formats give
+// the time since midnight, in UTC for timetz.
+func formatTimeOfDay(format TimeFormat, us int64, offset int, withTZ bool) any {
+	switch format {
+	case TimeFormatEpochMillis, TimeFormatEpochMicros:
+		if withTZ {
+			us = ((us-int64(offset)*1_000_000)%microsPerDay + microsPerDay) % microsPerDay
+		}
+		if format == TimeFormatEpochMillis {
+			return us / 1000
+		}
+		return us
+	}
+
+	sec := us / 1_000_000
+	text := fmt.Sprintf("%02d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+	if frac := us % 1_000_000; frac != 0 {
+		text += strings.TrimRight(fmt.Sprintf(".%06d", frac), "0")
+	}
+
+	if !withTZ {
+		return text
+	}
+
+	if offset == 0 {
+		return text + "Z"
+	}
+
+	sign := byte('+')
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	text += fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		text += fmt.Sprintf(":%02d", offset%60)
+	}
+
+	return text
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"ditto/common"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// timestampBytes returns the binary timestamp of t.
+func timestampBytes(t time.Time) []byte {
+	us := (t.Unix()-postgresEpoch.Unix())*1_000_000 + int64(t.Nanosecond()/1000)
+	return binary.BigEndian.AppendUint64(nil, uint64(us))
+}
+
+// dateBytes returns the binary date of t.
+func dateBytes(t time.Time) []byte {
+	days := (t.Unix() - postgresEpoch.Unix()) / 86400
+	return binary.BigEndian.AppendUint32(nil, uint32(int32(days)))
+}
+
+// timetzBytes returns the binary timetz of the time of day and the offset east of UTC.
+func timetzBytes(us int64, offset int32) []byte {
+	return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint64(nil, uint64(us)), uint32(-offset))
+}
+
+func TestDecodeTime(t *testing.T) {
+	fraction := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	far := time.Date(2500, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(9999, 12, 31, 23, 59, 59, 999999000, time.UTC)
+	ides := time.Date(-43, 3, 15, 12, 0, 0, 0, time.UTC)
+	firstBC := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+	offset := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 19800))
+	session := time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC)
+	lmt := time.Date(1849, 12, 31, 23, 6, 32, 0, time.UTC)
+	infinity := binary.BigEndian.AppendUint64(nil, math.MaxInt64)
+	minusInfinity := binary.BigEndian.AppendUint64(nil, 1<<63)
+	timeOfDay := int64(3*3600+4*60+5)*1_000_000 + 500000
+
+	tests := []struct {
+		name   string
+		oid    uint32
+		text   string // not decoded when empty
+		binary []byte // not decoded when nil
+		want   any    // in rfc3339nano
+		millis any
+		micros any
+	}{
+		{"timestamp fraction", common.TimestampOID, "2024-01-02 03:04:05.123456", timestampBytes(fraction),
+			"2024-01-02T03:04:05.123456Z", fraction.UnixMilli(), fraction.UnixMicro()},
+		{"timestamp after 2262", common.TimestampOID, "2500-01-01 00:00:00", timestampBytes(far),
+			"2500-01-01T00:00:00Z", far.UnixMilli(), far.UnixMicro()},
+		{"timestamp max year", common.TimestampOID, "9999-12-31 23:59:59.999999", timestampBytes(last),
+			"9999-12-31T23:59:59.999999Z", last.UnixMilli(), last.UnixMicro()},
+		{"timestamp BC", common.TimestampOID, "0044-03-15 12:00:00 BC", timestampBytes(ides),
+			"-0043-03-15T12:00:00Z", ides.UnixMilli(), ides.UnixMicro()},
+		{"timestamp infinity", common.TimestampOID, "infinity", infinity, "infinity", "infinity", "infinity"},
+		{"timestamp -infinity", common.TimestampOID, "-infinity", minusInfinity, "-infinity", "-infinity", "-infinity"},
+		{"timestamptz offset", common.TimestamptzOID, "2024-01-02 03:04:05+05:30", timestampBytes(offset),
+			"2024-01-01T21:34:05Z", offset.UnixMilli(), offset.UnixMicro()},
+		// a session in another TimeZone writes the same value as binary
+		{"timestamptz session zone", common.TimestamptzOID, "2024-01-02 10:04:05.5+07", timestampBytes(session),
+			"2024-01-02T03:04:05.5Z", session.UnixMilli(), session.UnixMicro()},
+		{"timestamptz offset seconds", common.TimestamptzOID, "1850-01-01 00:00:00+00:53:28", timestampBytes(lmt),
+			"1849-12-31T23:06:32Z", lmt.UnixMilli(), lmt.UnixMicro()},
+		{"timestamptz after 2262", common.TimestamptzOID, "2500-01-01 05:30:00+05:30", timestampBytes(far),
+			"2500-01-01T00:00:00Z", far.UnixMilli(), far.UnixMicro()},
+		{"timestamptz infinity", common.TimestamptzOID, "infinity", infinity, "infinity", "infinity", "infinity"},
+		{"date", common.DateOID, "2500-01-01", dateBytes(far), "2500-01-01", far.UnixMilli(), far.UnixMicro()},
+		{"date BC", common.DateOID, "0001-01-01 BC", dateBytes(firstBC), "0000-01-01", firstBC.UnixMilli(), firstBC.UnixMicro()},
+		{"date infinity", common.DateOID, "infinity", binary.BigEndian.AppendUint32(nil, math.MaxInt32), "infinity", "infinity", "infinity"},
+		{"date -infinity", common.DateOID, "-infinity", binary.BigEndian.AppendUint32(nil, 1<<31), "-infinity", "-infinity", "-infinity"},
+		{"time", common.TimeOID, "03:04:05.5", binary.BigEndian.AppendUint64(nil, uint64(timeOfDay)),
+			"03:04:05.5", timeOfDay / 1000, timeOfDay},
+		{"time end of day", common.TimeOID, "24:00:00", binary.BigEndian.AppendUint64(nil, uint64(microsPerDay)),
+			"24:00:00", microsPerDay / 1000, microsPerDay},
+		{"timetz offset", common.TimetzOID, "03:04:05.5+05:30", timetzBytes(timeOfDay, 19800),
+			"03:04:05.5+05:30", (timeOfDay - 19800_000000 + microsPerDay) / 1000, timeOfDay - 19800_000000 + microsPerDay},
+		{"timetz west", common.TimetzOID, "03:04:05.5-03", timetzBytes(timeOfDay, -3*3600),
+			"03:04:05.5-03:00", (timeOfDay + 3*3600_000000) / 1000, timeOfDay + 3*3600_000000},
+	}
+
+	formats := []struct {
+		format TimeFormat
+		want   func(i int) any
+	}{
+		{TimeFormatRFC3339Nano, func(i int) any { return tests[i].want }},
+		{TimeFormatEpochMillis, func(i int) any { return tests[i].millis }},
+		{TimeFormatEpochMicros, func(i int) any { return tests[i].micros }},
+	}
+
+	for _, f := range formats {
+		d := &decoder{codecs: NewCodecRegistry(), options: DecodeOptions{TimeFormat: f.format}}
+
+		for i, tt := range tests {
+			want := f.want(i)
+			t.Run(string(f.format)+"/"+tt.name, func(t *testing.T) {
+				if tt.text != "" {
+					got, err := d.decodeText(tt.oid, []byte(tt.text))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got != want {
+						t.Errorf("text: got %#v, want %#v", got, want)
+					}
+				}
+
+				if tt.binary != nil {
+					got, err := d.decodeBinary(tt.oid, tt.binary)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got != want {
+						t.Errorf("binary: got %#v, want %#v", got, want)
+					}
+				}
+			})
+		}
+	}
+}
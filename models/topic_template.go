@@ -0,0 +1,226 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"gopkg.in/yaml.v3"
+)
+
+// maxTopicValueLength longest column value which is put into a topic.
+const maxTopicValueLength = 64
+
+// topicRowFields row fields of the topic templates, e.g. {data.tenant_id}.
+var topicRowFields = []string{"data", "dataOld", "key"}
+
+// TopicTemplate topic name with the event fields in braces, e.g.
+// {schema}.{table}.{action} or tenants.{data.tenant_id}.orders. It is parsed
+// when the config is loaded.
+type TopicTemplate struct {
+	src   string
+	parts []topicPart
+	// dotted allows column values of several segments separated by dots,
+	// e.g. the aggregate type com.acme.Order of the outbox rows.
+	dotted bool
+}
+
+// topicPart literal text of the template or a reference to an event field.
+type topicPart struct {
+	text  string
+	field string // schema, table, action, data, dataOld or key
+	name  string // column of the row fields
+}
+
+// NewTopicTemplate parses the template.
+func NewTopicTemplate(src string) (TopicTemplate, error) {
+	t := TopicTemplate{src: src}
+
+	rest := src
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			t.parts = append(t.parts, topicPart{text: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return TopicTemplate{}, fmt.Errorf("topic %q: unexpected }", src)
+		}
+		if open > 0 {
+			t.parts = append(t.parts, topicPart{text: rest[:open]})
+		}
+
+		end := strings.IndexAny(rest[open+1:], "{}")
+		if end < 0 || rest[open+1+end] != '}' {
+			return TopicTemplate{}, fmt.Errorf("topic %q: unclosed {", src)
+		}
+
+		part, err := parseTopicField(rest[open+1 : open+1+end])
+		if err != nil {
+			return TopicTemplate{}, fmt.Errorf("topic %q: %w", src, err)
+		}
+		t.parts = append(t.parts, part)
+		rest = rest[open+end+2:]
+	}
+
+	return t, nil
+}
+
+// parseTopicField parses the field reference between the braces.
+func parseTopicField(ref string) (topicPart, error) {
+	field, name, isColumn := strings.Cut(strings.TrimSpace(ref), ".")
+
+	switch field {
+	case "schema", "table", "action":
+		if isColumn {
+			return topicPart{}, fmt.Errorf("field {%s} has no columns", field)
+		}
+		return topicPart{field: field}, nil
+	case "data", "dataOld", "key":
+		if !isColumn || name == "" {
+			return topicPart{}, fmt.Errorf("field {%s} needs a column, e.g. {%s.id}", field, field)
+		}
+		return topicPart{field: field, name: name}, nil
+	case "":
+		return topicPart{}, errors.New("empty field {}")
+	}
+
+	return topicPart{}, fmt.Errorf("unknown field {%s}, expected schema, table, action or a column of %s",
+		ref, strings.Join(topicRowFields, ", "))
+}
+
+// UnmarshalYAML parses the template of the config.
+func (t *TopicTemplate) UnmarshalYAML(value *yaml.Node) error {
+	var src string
+	if err := value.Decode(&src); err != nil {
+		return err
+	}
+
+	parsed, err := NewTopicTemplate(src)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+
+	return nil
+}
+
+// String returns the source of the template.
+func (t TopicTemplate) String() string {
+	return t.src
+}
+
+// Columns returns the columns referenced by the template, in order.
+func (t TopicTemplate) Columns() []string {
+	var columns []string
+	for _, part := range t.parts {
+		if part.name != "" {
+			columns = append(columns, part.name)
+		}
+	}
+
+	return columns
+}
+
+// IsZero reports whether the template is empty.
+func (t TopicTemplate) IsZero() bool {
+	return t.src == ""
+}
+
+// Render returns the topic of the event. It reports false when a referenced
+// field is missing, null, empty or not a scalar value, and when a column
+// value is not a safe topic segment, see isTopicSegment, or segments
+// separated by dots in a dotted template.
+func (t TopicTemplate) Render(e *Event) (string, bool) {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.field == "" {
+			b.WriteString(part.text)
+			continue
+		}
+
+		value, ok := topicFieldValue(e, part)
+		if !ok || value == "" {
+			return "", false
+		}
+		if part.name != "" && !t.isTopicValue(value) {
+			return "", false
+		}
+		b.WriteString(value)
+	}
+
+	return b.String(), true
+}
+
+// topicFieldValue returns the text of the event field.
+func topicFieldValue(e *Event, part topicPart) (string, bool) {
+	var row map[string]any
+	switch part.field {
+	case "schema":
+		return e.Schema, true
+	case "table":
+		return e.Table, true
+	case "action":
+		return e.Action, true
+	case "data":
+		row = e.Data
+	case "dataOld":
+		row = e.DataOld
+	case "key":
+		row = e.Key
+	}
+
+	switch v := row[part.name].(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+
+	return "", false
+}
+
+// isTopicValue reports whether the column value can be a part of the topic.
+func (t TopicTemplate) isTopicValue(s string) bool {
+	if !t.dotted {
+		return isTopicSegment(s)
+	}
+
+	for segment := range strings.SplitSeq(s, ".") {
+		if segment == "" || !isTopicSegment(segment) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isTopicSegment reports whether the column value can be a part of the topic:
+// up to maxTopicValueLength letters, digits, _ and -. Dots, wildcards and
+// the other characters could route the event into the topic of another row,
+// e.g. a tenant_id of "b.orders".
+func isTopicSegment(s string) bool {
+	if len(s) > maxTopicValueLength {
+		return false
+	}
+
+	for _, c := range []byte(s) {
+		if !(c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
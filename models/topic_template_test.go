@@ -0,0 +1,134 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTopicTemplateRender(t *testing.T) {
+	tmpl, err := NewTopicTemplate("tenants.{data.tenant_id}.{table}.{action}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tenant any
+		want   string
+	}{
+		{name: "string", tenant: "acme-1_b", want: "tenants.acme-1_b.orders.INSERT"},
+		{name: "int", tenant: int32(-42), want: "tenants.-42.orders.INSERT"},
+		{name: "number", tenant: json.Number("9007199254740993"), want: "tenants.9007199254740993.orders.INSERT"},
+		{name: "bool", tenant: true, want: "tenants.true.orders.INSERT"},
+		{name: "longest", tenant: strings.Repeat("a", maxTopicValueLength), want: "tenants." + strings.Repeat("a", maxTopicValueLength) + ".orders.INSERT"},
+		{name: "null", tenant: nil},
+		{name: "empty", tenant: ""},
+		{name: "dot", tenant: "b.orders"},
+		{name: "wildcard", tenant: "*"},
+		{name: "tail wildcard", tenant: ">"},
+		{name: "space", tenant: "a b"},
+		{name: "slash", tenant: "a/b"},
+		{name: "unicode", tenant: "ü"},
+		{name: "double", tenant: 1.5},
+		{name: "too long", tenant: strings.Repeat("a", maxTopicValueLength+1)},
+		{name: "list", tenant: []any{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{Table: "orders", Action: "INSERT", Data: map[string]any{"tenant_id": tt.tenant}}
+			got, ok := tmpl.Render(e)
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("got %q, %t, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicTemplateErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"a.{data}":     "needs a column",
+		"a.{schema.x}": "has no columns",
+		"a.{}":         "empty field",
+		"a.{row.id}":   "unknown field",
+		"a.{table":     "unclosed {",
+		"a.}":          "unexpected }",
+	} {
+		if _, err := NewTopicTemplate(src); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestOutboxTopicRender(t *testing.T) {
+	var c OutboxConfig
+	if err := yaml.Unmarshal([]byte(`{aggregate_type_column: type}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		typ  any
+		want string
+	}{
+		{name: "plain", typ: "Order", want: "Order"},
+		{name: "dotted", typ: "com.acme.Order", want: "com.acme.Order"},
+		{name: "long dotted", typ: strings.Repeat("a", maxTopicValueLength) + "." + strings.Repeat("b", maxTopicValueLength),
+			want: strings.Repeat("a", maxTopicValueLength) + "." + strings.Repeat("b", maxTopicValueLength)},
+		{name: "empty segment", typ: "com..Order"},
+		{name: "leading dot", typ: ".Order"},
+		{name: "trailing dot", typ: "Order."},
+		{name: "wildcard", typ: "com.*"},
+		{name: "tail wildcard", typ: "com.>"},
+		{name: "long segment", typ: "com." + strings.Repeat("a", maxTopicValueLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{Table: "outbox", Action: "INSERT", Data: map[string]any{"type": tt.typ}}
+			got, ok := c.Topic().Render(e)
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("got %q, %t, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicTemplateColumns(t *testing.T) {
+	tmpl, err := NewTopicTemplate("{schema}.{data.tenant_id}.{key.id}.{dataOld.region}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tmpl.Columns(); !slices.Equal(got, []string{"tenant_id", "id", "region"}) {
+		t.Errorf("got %v", got)
+	}
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{`{mapping: "t.{data.tenant_id}", exclude_columns: [tenant_id]}`, "mapping column tenant_id is not published"},
+		{`{mapping: "t.{key.id}", columns: [name]}`, "mapping column id is not published"},
+		{`{mapping: "t.{data.tenat_id}"}`, "mapping column tenat_id does not exist"},
+		{`{outbox: {aggregate_id_column: aggregate}}`, "outbox column aggregate does not exist"},
+	}
+
+	for _, tt := range tests {
+		var cfg WatchConfig
+		if err := yaml.Unmarshal([]byte(tt.config), &cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		err := cfg.Validate()
+		if err == nil {
+			err = cfg.ValidateColumns([]string{"id", "tenant_id", "name", "aggregate_type", "aggregate_id", "payload"})
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.config, err, tt.want)
+		}
+	}
+}
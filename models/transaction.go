@@ -0,0 +1,75 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// kind of transaction marker.
+const (
+	ActionKindBegin  ActionKind = "BEGIN"
+	ActionKindCommit ActionKind = "COMMIT"
+)
+
+// TransactionSummary events of the transaction, it is sent in the COMMIT marker.
+type TransactionSummary struct {
+	EventCount int               `json:"eventCount"`
+	Tables     []TableEventCount `json:"tables"`
+}
+
+// TableEventCount number of events of the table in the transaction.
+type TableEventCount struct {
+	Table      string `json:"table"` // schema qualified name
+	EventCount int    `json:"eventCount"`
+}
+
+// NumberEvents sets position and count of the published events of the transaction.
+func NumberEvents(events []Event) {
+	for i := range events {
+		events[i].TxIndex = i
+		events[i].TxTotal = len(events)
+	}
+}
+
+// CreateTransactionEvents creates BEGIN and COMMIT markers for the published events of the transaction.
+func (w *WalTransaction) CreateTransactionEvents(events []Event) (begin, commit Event) {
+	summary := &TransactionSummary{EventCount: len(events)}
+
+	index := make(map[string]int)
+	for _, e := range events {
+		table := e.Schema + "." + e.Table
+		i, ok := index[table]
+		if !ok {
+			i = len(summary.Tables)
+			index[table] = i
+			summary.Tables = append(summary.Tables, TableEventCount{Table: table})
+		}
+		summary.Tables[i].EventCount++
+	}
+
+	begin = w.markerEvent(ActionKindBegin, len(events))
+	commit = w.markerEvent(ActionKindCommit, len(events))
+	commit.Transaction = summary
+
+	return begin, commit
+}
+
+func (w *WalTransaction) markerEvent(kind ActionKind, total int) Event {
+	e := Event{
+		ID:      uuid.NewSHA1(eventIDNamespace, fmt.Appendf(nil, "%d/%s", w.LSN, kind)),
+		LSN:     w.LSN,
+		XID:     w.XID,
+		Action:  kind.string(),
+		TxTotal: total,
+	}
+
+	if w.BeginTime != nil {
+		e.BeginTime = *w.BeginTime
+	}
+	if w.CommitTime != nil {
+		e.EventTime = *w.CommitTime
+	}
+
+	return e
+}
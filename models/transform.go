@@ -0,0 +1,201 @@
+package models
+
+import (
+	"crypto/sha256"
+	"ditto/common"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-json"
+)
+
+// TransformKind kind of column value transform.
+type TransformKind string
+
+// kind of column value transform.
+const (
+	// TransformMask replaces the characters with '*', except the last Keep ones.
+	TransformMask TransformKind = "mask"
+	// TransformHash replaces the value with hex SHA-256 of the salt and the value.
+	TransformHash TransformKind = "hash"
+	// TransformTruncate keeps the first Length characters.
+	TransformTruncate TransformKind = "truncate"
+	// TransformNull replaces the value with null.
+	TransformNull TransformKind = "null"
+	// TransformRedactRegex replaces the matches of Pattern with Replacement.
+	TransformRedactRegex TransformKind = "redact-regex"
+)
+
+const defaultRedactReplacement = "[REDACTED]"
+
+// ColumnTransform transform of the column values, it is applied before the
+// values leave the service. Transformed values are strings, except null.
+type ColumnTransform struct {
+	Type TransformKind `yaml:"type"`
+	// Keep number of the last characters left by mask.
+	Keep int `yaml:"keep"`
+	// Salt of hash, SaltEnv names the environment variable with the salt instead.
+	Salt    string `yaml:"salt"`
+	SaltEnv string `yaml:"salt_env"`
+	// Length number of the characters left by truncate.
+	Length int `yaml:"length"`
+	// Pattern and Replacement of redact-regex, "[REDACTED]" by default.
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+
+	salt  string
+	regex *regexp.Regexp
+}
+
+// Validate checks the transform and prepares its salt and pattern.
+func (t *ColumnTransform) Validate() error {
+	switch t.Type {
+	case TransformMask:
+		if t.Keep < 0 {
+			return errors.New("mask keep must not be negative")
+		}
+	case TransformHash:
+		t.salt = t.Salt
+		if t.SaltEnv != "" {
+			salt, ok := os.LookupEnv(t.SaltEnv)
+			if !ok {
+				return fmt.Errorf("hash salt variable %s is not set", t.SaltEnv)
+			}
+			t.salt = salt
+		}
+	case TransformTruncate:
+		if t.Length < 0 {
+			return errors.New("truncate length must not be negative")
+		}
+	case TransformNull:
+	case TransformRedactRegex:
+		if t.Pattern == "" {
+			return errors.New("redact-regex pattern is empty")
+		}
+		regex, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return fmt.Errorf("redact-regex pattern: %w", err)
+		}
+		t.regex = regex
+	default:
+		return fmt.Errorf("unsupported transform: %q", t.Type)
+	}
+
+	return nil
+}
+
+// String describes the transform for the audit log, without the salt.
+func (t *ColumnTransform) String() string {
+	switch t.Type {
+	case TransformMask:
+		return fmt.Sprintf("mask (keep %d)", t.Keep)
+	case TransformHash:
+		if t.SaltEnv != "" {
+			return "hash (sha256, salt from " + t.SaltEnv + ")"
+		}
+		if t.Salt != "" {
+			return "hash (sha256, salted)"
+		}
+		return "hash (sha256, unsalted)"
+	case TransformTruncate:
+		return fmt.Sprintf("truncate (length %d)", t.Length)
+	case TransformRedactRegex:
+		return fmt.Sprintf("redact-regex (%s)", t.Pattern)
+	default:
+		return string(t.Type)
+	}
+}
+
+// Apply returns the transformed value, null stays null.
+func (t *ColumnTransform) Apply(value any) (any, error) {
+	if value == nil || t.Type == TransformNull {
+		return nil, nil
+	}
+
+	s, err := transformInput(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Type {
+	case TransformMask:
+		runes := []rune(s)
+		masked := max(len(runes)-t.Keep, 0)
+		return strings.Repeat("*", masked) + string(runes[masked:]), nil
+	case TransformHash:
+		sum := sha256.Sum256([]byte(t.salt + s))
+		return hex.EncodeToString(sum[:]), nil
+	case TransformTruncate:
+		runes := []rune(s)
+		return string(runes[:min(len(runes), t.Length)]), nil
+	case TransformRedactRegex:
+		replacement := t.Replacement
+		if replacement == "" {
+			replacement = defaultRedactReplacement
+		}
+		return t.regex.ReplaceAllLiteralString(s, replacement), nil
+	}
+
+	return nil, fmt.Errorf("unsupported transform: %q", t.Type)
+}
+
+// transformInput returns the text of the value, objects and arrays are JSON.
+func transformInput(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// applyTransforms transforms the values of the event columns, the columns
+// with string values become text columns for the schema-based formats.
+func (e *Event) applyTransforms(transforms map[string]*ColumnTransform) error {
+	if len(transforms) == 0 {
+		return nil
+	}
+	e.Columns = slices.Clone(e.Columns)
+
+	for name, t := range transforms {
+		for _, row := range []map[string]any{e.Data, e.DataOld, e.Key} {
+			value, ok := row[name]
+			if !ok {
+				continue
+			}
+
+			transformed, err := t.Apply(value)
+			if err != nil {
+				return fmt.Errorf("%s transform of column %s: %w", t.Type, name, err)
+			}
+			row[name] = transformed
+		}
+
+		if t.Type == TransformNull {
+			continue
+		}
+
+		for i, c := range e.Columns {
+			if c.Name == name {
+				e.Columns[i].TypeOID = common.TextOID
+				e.Columns[i].TypeModifier = -1
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"crypto/sha256"
+	"ditto/common"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sha256Hex returns the hex SHA-256 of s.
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestColumnTransformApply(t *testing.T) {
+	t.Setenv("DITTO_TEST_SALT", "pepper")
+
+	tests := []struct {
+		name      string
+		transform string
+		value     any
+		want      any
+	}{
+		{name: "mask", transform: `{type: mask, keep: 4}`, value: "4111111111111111", want: "************1111"},
+		{name: "mask runes", transform: `{type: mask, keep: 2}`, value: "Jürgen", want: "****en"},
+		{name: "mask keep all", transform: `{type: mask, keep: 10}`, value: "Jürgen", want: "Jürgen"},
+		{name: "mask keep none", transform: `{type: mask}`, value: "ü€", want: "**"},
+		{name: "mask number", transform: `{type: mask, keep: 1}`, value: int64(1234), want: "***4"},
+		{name: "hash", transform: `{type: hash}`, value: "a@b.c", want: sha256Hex("a@b.c")},
+		{name: "hash salt", transform: `{type: hash, salt: s1}`, value: "a@b.c", want: sha256Hex("s1a@b.c")},
+		{name: "hash salt_env", transform: `{type: hash, salt_env: DITTO_TEST_SALT}`, value: "a@b.c", want: sha256Hex("peppera@b.c")},
+		{name: "truncate", transform: `{type: truncate, length: 3}`, value: "Grüße", want: "Grü"},
+		{name: "truncate short", transform: `{type: truncate, length: 10}`, value: "Grüße", want: "Grüße"},
+		{name: "null", transform: `{type: "null"}`, value: "secret", want: nil},
+		{name: "redact-regex", transform: `{type: redact-regex, pattern: '\d{4}'}`, value: "card 1234 5678", want: "card [REDACTED] [REDACTED]"},
+		{name: "redact-regex replacement", transform: `{type: redact-regex, pattern: '@.*', replacement: '@***'}`, value: "a@b.c", want: "a@***"},
+		{name: "json", transform: `{type: truncate, length: 5}`, value: map[string]any{"a": 1}, want: `{"a":`},
+		{name: "null value", transform: `{type: mask}`, value: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transform ColumnTransform
+			if err := yaml.Unmarshal([]byte(tt.transform), &transform); err != nil {
+				t.Fatal(err)
+			}
+			if err := transform.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := transform.Apply(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnTransformValidate(t *testing.T) {
+	tests := []struct {
+		transform string
+		want      string
+	}{
+		{`{type: mask, keep: -1}`, "mask keep must not be negative"},
+		{`{type: hash, salt_env: DITTO_TEST_UNSET_SALT}`, "hash salt variable DITTO_TEST_UNSET_SALT is not set"},
+		{`{type: truncate, length: -1}`, "truncate length must not be negative"},
+		{`{type: redact-regex}`, "redact-regex pattern is empty"},
+		{`{type: redact-regex, pattern: '('}`, "redact-regex pattern"},
+		{`{type: encrypt}`, `unsupported transform: "encrypt"`},
+	}
+
+	for _, tt := range tests {
+		var transform ColumnTransform
+		if err := yaml.Unmarshal([]byte(tt.transform), &transform); err != nil {
+			t.Fatal(err)
+		}
+		if err := transform.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.transform, err, tt.want)
+		}
+	}
+}
+
+func TestApplyTransforms(t *testing.T) {
+	var cfg WatchConfig
+	if err := yaml.Unmarshal([]byte(`{transforms: {email: {type: hash}, phone: {type: "null"}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	columns := []ColumnType{
+		{Name: "email", TypeOID: common.VarcharOID, TypeModifier: 259, IsKey: true},
+		{Name: "phone", TypeOID: common.VarcharOID, TypeModifier: 36},
+	}
+	event := Event{
+		Action:  string(ActionKindUpdate),
+		Data:    map[string]any{"email": "new@b.c", "phone": "+1"},
+		DataOld: map[string]any{"email": "old@b.c", "phone": "+2"},
+		Key:     map[string]any{"email": "old@b.c"},
+		Columns: columns,
+	}
+
+	if err := event.applyTransforms(cfg.Transforms); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Data["email"] != sha256Hex("new@b.c") || event.DataOld["email"] != sha256Hex("old@b.c") || event.Key["email"] != sha256Hex("old@b.c") {
+		t.Errorf("got email %v, old %v, key %v", event.Data["email"], event.DataOld["email"], event.Key["email"])
+	}
+	if event.Data["phone"] != nil || event.DataOld["phone"] != nil {
+		t.Errorf("got phone %v, old %v", event.Data["phone"], event.DataOld["phone"])
+	}
+
+	// the hashed column is text in the schemas, the nulled one keeps its type
+	if c := event.Columns[0]; c.TypeOID != common.TextOID || c.TypeModifier != -1 {
+		t.Errorf("got email column %+v", c)
+	}
+	if c := event.Columns[1]; c.TypeOID != common.VarcharOID || c.TypeModifier != 36 {
+		t.Errorf("got phone column %+v", c)
+	}
+	// the columns of the relation are not changed
+	if columns[0].TypeOID != common.VarcharOID {
+		t.Error("transform changed the shared columns")
+	}
+}
+
+func TestWatchConfigTransformColumns(t *testing.T) {
+	var cfg WatchConfig
+	if err := yaml.Unmarshal([]byte(`{transforms: {emial: {type: hash}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := cfg.ValidateColumns([]string{"id", "email"})
+	if err == nil || !strings.Contains(err.Error(), "transform column emial does not exist") {
+		t.Fatalf("got error %v", err)
+	}
+}
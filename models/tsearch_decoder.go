@@ -0,0 +1,232 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// operators of the tsquery items, as in tsquery.h.
+const (
+	tsqueryValue = 1
+	tsqueryOper  = 2
+
+	tsqueryNot    = 1
+	tsqueryAnd    = 2
+	tsqueryOr     = 3
+	tsqueryPhrase = 4
+)
+
+// tsqueryPriority binding strength of the tsquery operators by operator.
+var tsqueryPriority = [...]int{tsqueryNot: 4, tsqueryAnd: 2, tsqueryOr: 1, tsqueryPhrase: 3}
+
+var errShortTSearch = errors.New("short value")
+
+// tsvectorBinaryToText renders the binary tsvector (the format of tsvectorsend)
+// as tsvectorout does: 'lexeme':1A,2 separated by spaces.
+func tsvectorBinaryToText(src []byte) ([]byte, error) {
+	if len(src) < 4 {
+		return nil, fmt.Errorf("tsvector: %w", errShortTSearch)
+	}
+	count := int(int32(binary.BigEndian.Uint32(src)))
+	src = src[4:]
+
+	var text []byte
+	for i := 0; i < count; i++ {
+		end := bytes.IndexByte(src, 0)
+		if end < 0 || len(src) < end+3 {
+			return nil, fmt.Errorf("tsvector lexeme %d: %w", i, errShortTSearch)
+		}
+		if i > 0 {
+			text = append(text, ' ')
+		}
+		text = appendTSearchOperand(text, src[:end])
+
+		positions := int(binary.BigEndian.Uint16(src[end+1:]))
+		src = src[end+3:]
+		if len(src) < 2*positions {
+			return nil, fmt.Errorf("tsvector lexeme %d: %w", i, errShortTSearch)
+		}
+		for j := 0; j < positions; j++ {
+			if j == 0 {
+				text = append(text, ':')
+			} else {
+				text = append(text, ',')
+			}
+			pos := binary.BigEndian.Uint16(src[2*j:])
+			text = strconv.AppendUint(text, uint64(pos&0x3fff), 10)
+			// weight D is the default and is not written
+			if weight := pos >> 14; weight > 0 {
+				text = append(text, "DCBA"[weight])
+			}
+		}
+		src = src[2*positions:]
+	}
+
+	return text, nil
+}
+
+// appendTSearchOperand appends the quoted lexeme, quotes and backslashes doubled.
+func appendTSearchOperand(text, lexeme []byte) []byte {
+	text = append(text, '\'')
+	for _, c := range lexeme {
+		if c == '\'' || c == '\\' {
+			text = append(text, c)
+		}
+		text = append(text, c)
+	}
+
+	return append(text, '\'')
+}
+
+// tsqueryItem operand or operator of a tsquery.
+type tsqueryItem struct {
+	kind     byte
+	oper     byte
+	distance int16
+	weight   byte
+	prefix   bool
+	operand  []byte
+}
+
+// tsqueryBinaryToText renders the binary tsquery (the format of tsquerysend)
+// as tsqueryout does. The items are in prefix order, each operator is followed
+// by its right operand and then its left one.
+func tsqueryBinaryToText(src []byte) ([]byte, error) {
+	if len(src) < 4 {
+		return nil, fmt.Errorf("tsquery: %w", errShortTSearch)
+	}
+	count := int(int32(binary.BigEndian.Uint32(src)))
+	src = src[4:]
+
+	items := make([]tsqueryItem, 0, max(count, 0))
+	for i := 0; i < count; i++ {
+		if len(src) < 2 {
+			return nil, fmt.Errorf("tsquery item %d: %w", i, errShortTSearch)
+		}
+		item := tsqueryItem{kind: src[0]}
+		switch item.kind {
+		case tsqueryValue:
+			end := -1
+			if len(src) > 3 {
+				end = bytes.IndexByte(src[3:], 0)
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("tsquery item %d: %w", i, errShortTSearch)
+			}
+			item.weight, item.prefix, item.operand = src[1], src[2] != 0, src[3:3+end]
+			src = src[4+end:]
+		case tsqueryOper:
+			item.oper = src[1]
+			if item.oper < tsqueryNot || item.oper > tsqueryPhrase {
+				return nil, fmt.Errorf("tsquery item %d: unknown operator %d", i, item.oper)
+			}
+			src = src[2:]
+			if item.oper == tsqueryPhrase {
+				if len(src) < 2 {
+					return nil, fmt.Errorf("tsquery item %d: %w", i, errShortTSearch)
+				}
+				item.distance = int16(binary.BigEndian.Uint16(src))
+				src = src[2:]
+			}
+		default:
+			return nil, fmt.Errorf("tsquery item %d: unknown type %d", i, item.kind)
+		}
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return []byte{}, nil
+	}
+
+	text, rest, err := appendTSQuery(nil, items, -1, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("tsquery: %d items after the query", len(rest))
+	}
+
+	return text, nil
+}
+
+// appendTSQuery appends the first expression of the items in infix notation
+// and returns the items after it, parentheses are added like infix() of
+// tsquery.c does.
+func appendTSQuery(text []byte, items []tsqueryItem, parentPriority int, rightPhrase bool) ([]byte, []tsqueryItem, error) {
+	if len(items) == 0 {
+		return nil, nil, fmt.Errorf("tsquery: %w", errShortTSearch)
+	}
+	item := items[0]
+	items = items[1:]
+
+	if item.kind == tsqueryValue {
+		text = appendTSearchOperand(text, item.operand)
+		if item.prefix || item.weight != 0 {
+			text = append(text, ':')
+			if item.prefix {
+				text = append(text, '*')
+			}
+			for i, weight := range "ABCD" {
+				if item.weight&(8>>i) != 0 {
+					text = append(text, byte(weight))
+				}
+			}
+		}
+		return text, items, nil
+	}
+
+	priority := tsqueryPriority[item.oper]
+
+	if item.oper == tsqueryNot {
+		parenthesis := priority < parentPriority
+		if parenthesis {
+			text = append(text, "( "...)
+		}
+		text = append(text, '!')
+		var err error
+		if text, items, err = appendTSQuery(text, items, priority, false); err != nil {
+			return nil, nil, err
+		}
+		if parenthesis {
+			text = append(text, " )"...)
+		}
+		return text, items, nil
+	}
+
+	parenthesis := priority < parentPriority || (item.oper == tsqueryPhrase && rightPhrase)
+	if parenthesis {
+		text = append(text, "( "...)
+	}
+
+	right, items, err := appendTSQuery(nil, items, priority, item.oper == tsqueryPhrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	text, items, err = appendTSQuery(text, items, priority, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch item.oper {
+	case tsqueryOr:
+		text = append(text, " | "...)
+	case tsqueryAnd:
+		text = append(text, " & "...)
+	default:
+		if item.distance == 1 {
+			text = append(text, " <-> "...)
+		} else {
+			text = fmt.Appendf(text, " <%d> ", item.distance)
+		}
+	}
+	text = append(text, right...)
+
+	if parenthesis {
+		text = append(text, " )"...)
+	}
+
+	return text, items, nil
+}
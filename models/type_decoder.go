@@ -0,0 +1,112 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errUnknownOIDType = errors.New("unknown oid type")
+
+// decodeCustomText converts the value of an enum, domain or composite type
+// using the type information from the type store.
+func (d *decoder) decodeCustomText(oid uint32, src []byte) (any, error) {
+	if d == nil || d.types == nil {
+		return d.unknownValue(src), errUnknownOIDType
+	}
+
+	info, err := d.types.Lookup(oid)
+	if err != nil {
+		// the unknown type policy applies, skip must leave the column out
+		return d.unknownValue(src), fmt.Errorf("%w: %w", errUnknownOIDType, err)
+	}
+
+	switch info.Kind {
+	case TypeKindEnum:
+		return string(src), nil
+	case TypeKindDomain:
+		return d.decodeText(info.BaseOID, src)
+	case TypeKindComposite:
+		return d.decodeComposite(info, src)
+	default:
+		return d.unknownValue(src), errUnknownOIDType
+	}
+}
+
+// decodeComposite converts a composite value to a map of its attributes.
+func (d *decoder) decodeComposite(info *TypeInfo, src []byte) (any, error) {
+	fields, err := parseRecord(src)
+	if err != nil {
+		return string(src), fmt.Errorf("composite %s: %w", info.Name, err)
+	}
+
+	if len(fields) != len(info.Fields) {
+		return string(src), fmt.Errorf("composite %s: got %d fields, type has %d", info.Name, len(fields), len(info.Fields))
+	}
+
+	m := make(map[string]any, len(fields))
+	for i, f := range info.Fields {
+		if fields[i] == nil {
+			m[f.Name] = nil
+			continue
+		}
+
+		val, err := d.decodeText(f.TypeOID, fields[i])
+		if err != nil && !errors.Is(err, errUnknownOIDType) {
+			return string(src), fmt.Errorf("composite %s field %s: %w", info.Name, f.Name, err)
+		}
+		m[f.Name] = val
+	}
+
+	return m, nil
+}
+
+// parseRecord splits the text representation of a row value, e.g. (1,"a b",),
+// into its fields. NULL fields are returned as nil.
+func parseRecord(src []byte) ([][]byte, error) {
+	if len(src) < 2 || src[0] != '(' || src[len(src)-1] != ')' {
+		return nil, errors.New("malformed record literal")
+	}
+
+	body := src[1 : len(src)-1]
+	fields := make([][]byte, 0)
+
+	for i := 0; ; {
+		var (
+			field  []byte
+			quoted bool
+		)
+
+		for i < len(body) && (quoted || body[i] != ',') {
+			switch c := body[i]; {
+			case c == '"' && quoted && i+1 < len(body) && body[i+1] == '"':
+				field = append(field, '"')
+				i += 2
+			case c == '"':
+				quoted = !quoted
+				if field == nil {
+					field = []byte{}
+				}
+				i++
+			case c == '\\' && i+1 < len(body):
+				field = append(field, body[i+1])
+				i += 2
+			default:
+				field = append(field, c)
+				i++
+			}
+		}
+
+		if quoted {
+			return nil, errors.New("unterminated quoted field")
+		}
+
+		fields = append(fields, field)
+
+		if i >= len(body) {
+			break
+		}
+		i++ // skip comma
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"ditto/common"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// failedLookupTTL how long a failed type lookup is cached, so an unknown oid
+// doesn't query pg_type for every value.
+const failedLookupTTL = time.Minute
+
+// maxFormattedValues number of the values rendered by the server which are cached.
+const maxFormattedValues = 4096
+
+// TypeKind kind of the data type (same as typtype in pg_type).
+type TypeKind byte
+
+// kind of data type.
+const (
+	TypeKindBase       TypeKind = 'b'
+	TypeKindComposite  TypeKind = 'c'
+	TypeKindDomain     TypeKind = 'd'
+	TypeKindEnum       TypeKind = 'e'
+	TypeKindPseudo     TypeKind = 'p'
+	TypeKindRange      TypeKind = 'r'
+	TypeKindMultirange TypeKind = 'm'
+	// TypeKindArray base type of the array category (typcategory A).
+	TypeKindArray TypeKind = 'A'
+)
+
+// TypeField attribute of a composite type.
+type TypeField struct {
+	Name    string
+	TypeOID uint32
+}
+
+// TypeInfo describes a data type which is not covered by the built-in decoders.
+type TypeInfo struct {
+	OID       uint32
+	Namespace string
+	Name      string
+	Kind      TypeKind
+	// BaseOID underlying type of a domain.
+	BaseOID uint32
+	// ElemOID element type of an array, subtype of a range or range type of a multirange.
+	ElemOID uint32
+	// Fields attributes of a composite type in attnum order.
+	Fields []TypeField
+	// Labels values of an enum type in sort order.
+	Labels []string
+}
+
+// TypeLoader loads type information which was not seen on the replication stream.
+type TypeLoader interface {
+	LoadType(oid uint32) (*TypeInfo, error)
+}
+
+// TextFormatter renders a binary value as text with the output function of
+// its type on the server, for the types whose text depends on the catalog
+// or the locale of the session.
+type TextFormatter interface {
+	FormatText(oid uint32, src []byte) ([]byte, error)
+}
+
+// TypeStore per-connection cache of data types, filled from Type messages
+// and from the TypeLoader for the rest.
+type TypeStore struct {
+	mu     sync.RWMutex
+	types  map[uint32]*TypeInfo
+	stale  map[uint32]bool
+	failed map[uint32]failedLookup
+	texts  map[formattedValue][]byte
+	loader TypeLoader
+}
+
+// formattedValue binary value of a type rendered by the server.
+type formattedValue struct {
+	oid uint32
+	src string
+}
+
+// failedLookup error of the type loader, it is returned until it expires.
+type failedLookup struct {
+	err     error
+	expires time.Time
+}
+
+// NewTypeStore create and initialize new type store.
+func NewTypeStore(loader TypeLoader) *TypeStore {
+	return &TypeStore{
+		types:  make(map[uint32]*TypeInfo),
+		stale:  make(map[uint32]bool),
+		failed: make(map[uint32]failedLookup),
+		texts:  make(map[formattedValue][]byte),
+		loader: loader,
+	}
+}
+
+// SetLoader sets the loader used for types missing in the cache.
+func (s *TypeStore) SetLoader(loader TypeLoader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loader = loader
+}
+
+// Announce stores the type from a Type message. The message carries only the
+// name of the type, so the details are reloaded on the next lookup.
+func (s *TypeStore) Announce(dt common.DataType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oid := uint32(dt.ID)
+	info, ok := s.types[oid]
+	if !ok {
+		info = &TypeInfo{OID: oid}
+		s.types[oid] = info
+	}
+
+	info.Namespace = dt.Namespace
+	info.Name = dt.Name
+	s.stale[oid] = true
+	delete(s.failed, oid)
+}
+
+// ForgetFailures drops the cached failed lookups and the texts rendered by
+// the server, e.g. when a Relation message shows that the tables changed.
+func (s *TypeStore) ForgetFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.failed)
+	clear(s.texts)
+}
+
+// FormatText renders the binary value as text on the server when the loader
+// is a TextFormatter, it reports false without one. The texts are cached by
+// the type and the value, so a repeated value costs no round trip.
+func (s *TypeStore) FormatText(oid uint32, src []byte) ([]byte, bool, error) {
+	s.mu.RLock()
+	formatter, ok := s.loader.(TextFormatter)
+	key := formattedValue{oid: oid, src: string(src)}
+	text, cached := s.texts[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, false, nil
+	}
+	if cached {
+		return text, true, nil
+	}
+
+	text, err := formatter.FormatText(oid, src)
+	if err != nil {
+		return nil, true, fmt.Errorf("format value of type %d: %w", oid, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.texts) >= maxFormattedValues {
+		clear(s.texts)
+	}
+	s.texts[key] = text
+
+	return text, true, nil
+}
+
+// Lookup returns the type by oid, loading it when it is unknown or stale.
+// A failed load is cached for failedLookupTTL.
+func (s *TypeStore) Lookup(oid uint32) (*TypeInfo, error) {
+	s.mu.RLock()
+	info, ok := s.types[oid]
+	stale := s.stale[oid]
+	failed, hasFailed := s.failed[oid]
+	loader := s.loader
+	s.mu.RUnlock()
+
+	if ok && !stale {
+		return info, nil
+	}
+
+	if hasFailed && time.Now().Before(failed.expires) {
+		return nil, failed.err
+	}
+
+	if loader == nil {
+		if ok {
+			return info, nil
+		}
+		return nil, fmt.Errorf("type %d: no type loader", oid)
+	}
+
+	loaded, err := loader.LoadType(oid)
+	if err != nil {
+		err = fmt.Errorf("load type %d: %w", oid, err)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.failed[oid] = failedLookup{err: err, expires: time.Now().Add(failedLookupTTL)}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.types[oid] = loaded
+	delete(s.stale, oid)
+	delete(s.failed, oid)
+
+	return loaded, nil
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"ditto/common"
+	"errors"
+	"testing"
+)
+
+type countingLoader struct {
+	calls int
+	err   error
+}
+
+func (l *countingLoader) LoadType(oid uint32) (*TypeInfo, error) {
+	l.calls++
+	if l.err != nil {
+		return nil, l.err
+	}
+	return &TypeInfo{OID: oid, Kind: TypeKindEnum}, nil
+}
+
+func TestTypeStoreCachesFailedLookups(t *testing.T) {
+	loader := &countingLoader{err: errors.New("type does not exist")}
+	store := NewTypeStore(loader)
+
+	for range 3 {
+		if _, err := store.Lookup(90000); err == nil {
+			t.Fatal("expected the lookup to fail")
+		}
+	}
+	if loader.calls != 1 {
+		t.Fatalf("loader was called %d times, want 1", loader.calls)
+	}
+
+	// a Relation message may bring the type
+	loader.err = nil
+	store.ForgetFailures()
+	if _, err := store.Lookup(90000); err != nil {
+		t.Fatal(err)
+	}
+	if loader.calls != 2 {
+		t.Fatalf("loader was called %d times, want 2", loader.calls)
+	}
+}
+
+func TestTypeStoreAnnounceForgetsFailure(t *testing.T) {
+	loader := &countingLoader{err: errors.New("connection refused")}
+	store := NewTypeStore(loader)
+
+	if _, err := store.Lookup(90001); err == nil {
+		t.Fatal("expected the lookup to fail")
+	}
+
+	loader.err = nil
+	store.Announce(common.DataType{ID: 90001, Namespace: "public", Name: "mood"})
+	info, err := store.Lookup(90001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Kind != TypeKindEnum || loader.calls != 2 {
+		t.Fatalf("got %+v after %d calls", info, loader.calls)
+	}
+}
@@ -3,12 +3,14 @@ package models
 import (
 	"ditto/common"
 	"ditto/errorx"
-	"strconv"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/goccy/go-json"
-	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
@@ -20,21 +22,36 @@ const (
 	ActionKindInsert ActionKind = "INSERT"
 	ActionKindUpdate ActionKind = "UPDATE"
 	ActionKindDelete ActionKind = "DELETE"
+	// ActionKindTruncate is created for each truncated relation, it has no columns.
+	ActionKindTruncate ActionKind = "TRUNCATE"
+
+	ActionKindSchemaChange ActionKind = "SCHEMA_CHANGE"
+	ActionKindDDL          ActionKind = "DDL"
 )
 
 // WalTransaction transaction specified WAL message.
 type WalTransaction struct {
 	LSN           int64
+	XID           uint32
 	BeginTime     *time.Time
 	CommitTime    *time.Time
 	RelationStore map[int32]RelationData
-	Actions       []ActionData
+	TypeStore     *TypeStore
+	Codecs        *CodecRegistry
+	DecodeOptions DecodeOptions
+	// OutboxPayloads payload columns of the outbox tables by table.
+	OutboxPayloads map[string]string
+	// DeletedOutboxRows rows deleted by the outbox cleaner.
+	DeletedOutboxRows *OutboxRows
+	Actions           []ActionData
 }
 
 // NewWalTransaction create and initialize new WAL transaction.
 func NewWalTransaction() *WalTransaction {
 	return &WalTransaction{
 		RelationStore: make(map[int32]RelationData),
+		TypeStore:     NewTypeStore(nil),
+		Codecs:        DefaultCodecs,
 	}
 }
 
@@ -46,6 +63,7 @@ func (k ActionKind) string() string {
 type RelationData struct {
 	Schema  string
 	Table   string
+	Replica int8
 	Columns []Column
 }
 
@@ -56,68 +74,47 @@ type ActionData struct {
 	Kind       ActionKind
 	OldColumns []Column
 	NewColumns []Column
+	// OldRowFull reports whether OldColumns hold the whole old row (REPLICA
+	// IDENTITY FULL) and not only the key.
+	OldRowFull bool
+	// Columns of the relation, also for actions without tuples.
+	Columns      []ColumnType
+	SchemaChange *SchemaChange
+	DDL          *DDLCommand
 }
 
 // Column of the table with which changes occur.
 type Column struct {
-	Name      string
-	value     any
-	ValueType int
-	IsKey     bool
+	Name          string
+	value         any
+	ValueType     int
+	ValueModifier int
+	IsKey         bool
+	decoder       *decoder
+	// unchangedToast marks TOAST value which was not changed and not sent.
+	unchangedToast bool
+	// skipped marks value of an unknown type omitted by the unknown type policy.
+	skipped bool
 }
 
 // AssertValue converts bytes to a specific type depending
 // on the type of this data in the database table.
 func (c *Column) AssertValue(src []byte) {
-	var (
-		val any
-		err error
-	)
-
 	if src == nil {
 		c.value = nil
 		return
 	}
 
-	strSrc := string(src)
-
-	const (
-		timestampLayout       = "2006-01-02 15:04:05"
-		timestampWithTZLayout = "2006-01-02 15:04:05.999999999-07"
-	)
-
-	switch c.ValueType {
-	case common.BoolOID:
-		val, err = strconv.ParseBool(strSrc)
-	case common.Int2OID, common.Int4OID:
-		val, err = strconv.Atoi(strSrc)
-	case common.Int8OID, common.Numeric:
-		val, err = strconv.ParseInt(strSrc, 10, 64)
-	case common.TextOID, common.VarcharOID:
-		val = strSrc
-	case common.TimestampOID:
-		val, err = time.Parse(timestampLayout, strSrc)
-	case common.TimestamptzOID:
-		val, err = time.ParseInLocation(timestampWithTZLayout, strSrc, time.UTC)
-	case common.DateOID, common.TimeOID:
-		val = strSrc
-	case common.UUIDOID:
-		val, err = uuid.Parse(strSrc)
-	case common.JSONBOID:
-		var m any
-		if src[0] == '[' {
-			m = make([]any, 0)
-		} else {
-			m = make(map[string]any)
-		}
-		err = json.Unmarshal(src, &m)
-		val = m
-	default:
-		logrus.WithFields(logrus.Fields{"pgtype": c.ValueType, "column_name": c.Name}).Warnln("unknown oid type")
-		val = strSrc
-	}
+	val, err := c.decoder.decodeText(uint32(c.ValueType), src)
+	c.setValue(val, err)
+}
 
-	if err != nil {
+// setValue stores the decoded value, reporting the decode error.
+func (c *Column) setValue(val any, err error) {
+	if errors.Is(err, errUnknownOIDType) {
+		logrus.WithError(err).WithFields(logrus.Fields{"pgtype": c.ValueType, "column_name": c.Name}).Warnln("unknown oid type")
+		c.skipped = c.decoder.Options().UnknownTypePolicy == UnknownTypeSkip
+	} else if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{"pgtype": c.ValueType, "column_name": c.Name}).
 			Errorln("column data parse error")
 	}
@@ -125,6 +122,21 @@ func (c *Column) AssertValue(src []byte) {
 	c.value = val
 }
 
+// decodeText converts text representation of the value with the codec
+// registered for the data type, containers and user-defined types are
+// converted by their element and base types.
+func (d *decoder) decodeText(oid uint32, src []byte) (any, error) {
+	if codec := d.codec(oid); codec != nil {
+		return codec.DecodeText(d, src)
+	}
+
+	if kind, elem, ok := d.elementType(oid); ok {
+		return d.decodeContainerText(kind, elem, src)
+	}
+
+	return d.decodeCustomText(oid, src)
+}
+
 // Clear transaction data.
 func (w *WalTransaction) Clear() {
 	w.CommitTime = nil
@@ -139,34 +151,51 @@ func (w *WalTransaction) CreateActionData(relationID int32, oldRows []common.Tup
 		return a, errorx.ErrRelationNotFound
 	}
 
+	if len(oldRows) > len(rel.Columns) || len(newRows) > len(rel.Columns) {
+		return a, fmt.Errorf("%w: relation %s.%s has %d columns, tuple has %d",
+			errorx.ErrMalformedMessage, rel.Schema, rel.Table, len(rel.Columns), max(len(oldRows), len(newRows)))
+	}
+
 	a = ActionData{
-		Schema: rel.Schema,
-		Table:  rel.Table,
-		Kind:   kind,
+		Schema:  rel.Schema,
+		Table:   rel.Table,
+		Kind:    kind,
+		Columns: rel.columnTypes(),
 	}
 
-	var oldColumns []Column
+	d := &decoder{codecs: w.Codecs, types: w.TypeStore, options: w.DecodeOptions}
+	columnDecoder := func(int) *decoder { return d }
+	if payload, ok := w.OutboxPayloads[rel.Table]; ok {
+		// the numbers of the outbox payload keep their digits
+		options := w.DecodeOptions
+		options.JSONNumbers = true
+		payloadDecoder := &decoder{codecs: w.Codecs, types: w.TypeStore, options: options}
+		columnDecoder = func(num int) *decoder {
+			if rel.Columns[num].Name == payload {
+				return payloadDecoder
+			}
+			return d
+		}
+	}
 
+	var oldColumns []Column
 	for num, row := range oldRows {
-		column := Column{
-			Name:      rel.Columns[num].Name,
-			ValueType: rel.Columns[num].ValueType,
-			IsKey:     rel.Columns[num].IsKey,
-		}
-		column.AssertValue(row.Value)
-		oldColumns = append(oldColumns, column)
+		oldColumns = append(oldColumns, newColumn(columnDecoder(num), rel, num, row))
 	}
 
 	a.OldColumns = oldColumns
 
 	var newColumns []Column
 	for num, row := range newRows {
-		column := Column{
-			Name:      rel.Columns[num].Name,
-			ValueType: rel.Columns[num].ValueType,
-			IsKey:     rel.Columns[num].IsKey,
+		column := newColumn(columnDecoder(num), rel, num, row)
+
+		// unchanged TOAST value is not sent in the new tuple,
+		// but it is present in the old one under REPLICA IDENTITY FULL.
+		if column.unchangedToast && num < len(oldRows) && oldRows[num].Value != nil {
+			column.value = oldColumns[num].value
+			column.unchangedToast = false
 		}
-		column.AssertValue(row.Value)
+
 		newColumns = append(newColumns, column)
 	}
 	a.NewColumns = newColumns
@@ -174,35 +203,171 @@ func (w *WalTransaction) CreateActionData(relationID int32, oldRows []common.Tup
 	return a, nil
 }
 
-// CreateEventsWithFilter filter WAL message by table,
-// action and create events for each value.
-func (w *WalTransaction) CreateEventsWithFilter(tableMap map[string][]string) []Event {
-	var events []Event
+// CreateTruncateAction create action for the truncated relation.
+func (w *WalTransaction) CreateTruncateAction(relationID int32) (a ActionData, err error) {
+	rel, ok := w.RelationStore[relationID]
+	if !ok {
+		return a, errorx.ErrRelationNotFound
+	}
+
+	return ActionData{
+		Schema:  rel.Schema,
+		Table:   rel.Table,
+		Kind:    ActionKindTruncate,
+		Columns: rel.columnTypes(),
+	}, nil
+}
+
+// columnTypes returns types of the relation columns.
+func (r RelationData) columnTypes() []ColumnType {
+	types := make([]ColumnType, 0, len(r.Columns))
+	for _, c := range r.Columns {
+		types = append(types, ColumnType{
+			Name:         c.Name,
+			TypeOID:      uint32(c.ValueType),
+			TypeModifier: c.ValueModifier,
+			IsKey:        c.IsKey,
+		})
+	}
+
+	return types
+}
+
+func newColumn(d *decoder, rel RelationData, num int, row common.TupleData) Column {
+	column := Column{
+		Name:      rel.Columns[num].Name,
+		ValueType: rel.Columns[num].ValueType,
+		IsKey:     rel.Columns[num].IsKey,
+		decoder:   d,
+	}
 
+	switch row.Kind {
+	case common.ToastDataType:
+		column.unchangedToast = true
+	case common.BinaryDataType:
+		column.AssertBinaryValue(row.Value)
+	default:
+		column.AssertValue(row.Value)
+	}
+
+	return column
+}
+
+// columnsData collects values of the columns, unchanged TOAST columns
+// are returned separately because their values are unknown.
+func columnsData(columns []Column) (data map[string]any, unchangedToast []string) {
+	data = make(map[string]any)
+	for _, val := range columns {
+		if val.unchangedToast {
+			unchangedToast = append(unchangedToast, val.Name)
+			continue
+		}
+		if val.skipped {
+			continue
+		}
+		data[val.Name] = val.value
+	}
+
+	return data, unchangedToast
+}
+
+// newEvents creates the events of the actions. The changes of the rows are
+// numbered in WAL order. SCHEMA_CHANGE and DDL events are derived from the
+// Relation and logical messages, they get the Seq of the next change and IDs
+// of their own, so they don't shift the IDs of the changes.
+func (w *WalTransaction) newEvents() []Event {
+	events := make([]Event, 0, len(w.Actions))
+	derived := make(map[ActionKind]int)
+
+	seq := 0
 	for _, item := range w.Actions {
-		dataOld := make(map[string]any)
-		for _, val := range item.OldColumns {
-			dataOld[val.Name] = val.value
+		event := w.newEvent(seq, item)
+		if isDerivedAction(item.Kind) {
+			event.ID = DerivedEventID(w.LSN, item.Kind, derived[item.Kind])
+			derived[item.Kind]++
+		} else {
+			seq++
 		}
+		events = append(events, event)
+	}
+
+	return events
+}
+
+// isDerivedAction reports whether the event is not a change of the rows.
+func isDerivedAction(kind ActionKind) bool {
+	return kind == ActionKindSchemaChange || kind == ActionKindDDL
+}
+
+// newEvent creates event from the action data.
+func (w *WalTransaction) newEvent(seq int, item ActionData) Event {
+	dataOld, _ := columnsData(item.OldColumns)
+	data, unchangedToast := columnsData(item.NewColumns)
+
+	e := Event{
+		ID:             EventID(w.LSN, seq),
+		LSN:            w.LSN,
+		XID:            w.XID,
+		Seq:            seq,
+		Schema:         item.Schema,
+		Table:          item.Table,
+		Action:         item.Kind.string(),
+		DataOld:        dataOld,
+		Data:           data,
+		UnchangedToast: unchangedToast,
+		SchemaChange:   item.SchemaChange,
+		DDL:            item.DDL,
+		EventTime:      *w.CommitTime,
+		Columns:        item.Columns,
+	}
 
-		data := make(map[string]any)
-		for _, val := range item.NewColumns {
-			data[val.Name] = val.value
+	if w.BeginTime != nil {
+		e.BeginTime = *w.BeginTime
+	}
+
+	for _, c := range item.Columns {
+		if c.IsKey {
+			e.KeyColumns = append(e.KeyColumns, c.Name)
 		}
+	}
+	e.Key = e.keyValues()
+
+	if item.Kind == ActionKindUpdate && item.OldRowFull {
+		e.Changed = changedColumns(item.NewColumns, dataOld, data)
+	}
 
-		event := Event{
-			ID:        uuid.New(),
-			Schema:    item.Schema,
-			Table:     item.Table,
-			Action:    item.Kind.string(),
-			DataOld:   dataOld,
-			Data:      data,
-			EventTime: *w.CommitTime,
+	return e
+}
+
+// changedColumns returns names of the columns whose values differ between
+// the old and the new row, in the order of the table columns.
+func changedColumns(columns []Column, dataOld, data map[string]any) []string {
+	changed := make([]string, 0)
+	for _, c := range columns {
+		newValue, ok := data[c.Name]
+		if !ok {
+			// unchanged TOAST and skipped values
+			continue
+		}
+		if oldValue, ok := dataOld[c.Name]; !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changed = append(changed, c.Name)
 		}
+	}
+
+	return changed
+}
+
+// CreateEventsWithFilter filter WAL message by table,
+// action and create events for each value.
+func (w *WalTransaction) CreateEventsWithFilter(tableMap map[string][]string) []Event {
+	var events []Event
+
+	for i, event := range w.newEvents() {
+		item := w.Actions[i]
 
 		actions, validTable := tableMap[item.Table]
 
-		validAction := inArray(actions, item.Kind.string())
+		validAction := item.Kind == ActionKindSchemaChange || inArray(actions, item.Kind.string())
 		if validTable && validAction {
 			events = append(events, event)
 			continue
@@ -221,76 +386,254 @@ func (w *WalTransaction) CreateEventsWithFilter(tableMap map[string][]string) []
 }
 
 func (w *WalTransaction) CreateEvents() []Event {
-	var events []Event
+	return w.newEvents()
+}
 
-	for _, item := range w.Actions {
-		dataOld := make(map[string]any)
-		for _, val := range item.OldColumns {
-			dataOld[val.Name] = val.value
+// inArray checks whether the value is in an array.
+func inArray(arr []string, value string) bool {
+	for _, v := range arr {
+		if strings.EqualFold(v, value) {
+			return true
 		}
+	}
+
+	return false
+}
 
-		data := make(map[string]any)
-		for _, val := range item.NewColumns {
-			data[val.Name] = val.value
+// WatchConfig for table watch list
+type WatchConfig struct {
+	Action string `yaml:"action"`
+	// Mapping topic of the table, a template with the event fields such as
+	// {schema}.{table}.{action} or tenants.{data.tenant_id}.orders.
+	Mapping TopicTemplate `yaml:"mapping"`
+	// FallbackTopic topic of the events with a missing field of the mapping, the table name by default.
+	FallbackTopic string `yaml:"fallback_topic"`
+	// Encoding output format of the table, the output format by default.
+	Encoding string `yaml:"encoding"`
+	// SkipNoopUpdates drops UPDATE events which change none of CompareColumns,
+	// all columns by default. It needs REPLICA IDENTITY FULL.
+	SkipNoopUpdates bool     `yaml:"skip_noop_updates"`
+	CompareColumns  []string `yaml:"compare_columns"`
+	// Columns published columns of the table, all columns by default.
+	Columns []string `yaml:"columns"`
+	// ExcludeColumns columns which are never published.
+	ExcludeColumns []string `yaml:"exclude_columns"`
+	// Transforms of the column values by column name, e.g. to mask or hash personal data.
+	Transforms map[string]*ColumnTransform `yaml:"transforms"`
+	// Filter expression of the INSERT, UPDATE and DELETE events, e.g. data.status == "PAID".
+	Filter *RowFilter `yaml:"filter"`
+	// FilterPushdown puts the filter into the publication row filter on PostgreSQL 15+.
+	FilterPushdown bool `yaml:"filter_pushdown"`
+	// Script path of the Lua script which rewrites, splits or drops the events of the table.
+	Script string `yaml:"script"`
+	// Outbox publishes the inserted rows of an outbox table as the messages of their aggregates.
+	Outbox *OutboxConfig `yaml:"outbox"`
+}
+
+// isRowAction reports whether the action changes a row.
+func isRowAction(kind ActionKind) bool {
+	return kind == ActionKindInsert || kind == ActionKindUpdate || kind == ActionKindDelete
+}
+
+// Validate checks the watch config.
+func (c WatchConfig) Validate() error {
+	if len(c.Columns) > 0 && len(c.ExcludeColumns) > 0 {
+		return errors.New("columns and exclude_columns can't be used together")
+	}
+
+	for _, name := range slices.Concat(c.Columns, c.ExcludeColumns) {
+		if name == "" {
+			return errors.New("empty column name")
+		}
+	}
+
+	if strings.ContainsAny(c.FallbackTopic, "{}") {
+		return errors.New("fallback_topic can't be a template")
+	}
+
+	if c.Outbox != nil {
+		if c.Encoding != "" {
+			return errors.New("outbox and encoding can't be used together")
+		}
+		if err := c.Outbox.Validate(); err != nil {
+			return err
+		}
+		for _, name := range []string{c.Outbox.AggregateTypeColumn, c.Outbox.AggregateIDColumn, c.Outbox.PayloadColumn} {
+			if !c.PublishesColumn(name) {
+				return fmt.Errorf("outbox column %s is not published", name)
+			}
 		}
+	}
 
-		event := Event{
-			ID:        uuid.New(),
-			Schema:    item.Schema,
-			Table:     item.Table,
-			Action:    item.Kind.string(),
-			DataOld:   dataOld,
-			Data:      data,
-			EventTime: *w.CommitTime,
+	for _, name := range c.CompareColumns {
+		if !c.PublishesColumn(name) {
+			return fmt.Errorf("compare column %s is not published", name)
 		}
+	}
 
-		events = append(events, event)
+	// the events would all go to the fallback topic
+	for _, name := range c.Mapping.Columns() {
+		if !c.PublishesColumn(name) {
+			return fmt.Errorf("mapping column %s is not published", name)
+		}
 	}
 
-	return events
+	if c.FilterPushdown && c.Filter == nil {
+		return errors.New("filter_pushdown requires a filter")
+	}
+
+	for name, t := range c.Transforms {
+		if t == nil {
+			return fmt.Errorf("transform of column %s has no type", name)
+		}
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("transform of column %s: %w", name, err)
+		}
+	}
+
+	return nil
 }
 
-// inArray checks whether the value is in an array.
-func inArray(arr []string, value string) bool {
-	for _, v := range arr {
-		if strings.EqualFold(v, value) {
-			return true
+// ValidateColumns checks the columns named by the config against the
+// replicated columns of the table, a misspelled column would otherwise
+// silently change which events are published.
+func (c WatchConfig) ValidateColumns(columns []string) error {
+	for _, name := range c.CompareColumns {
+		if !slices.Contains(columns, name) {
+			return fmt.Errorf("compare column %s does not exist", name)
 		}
 	}
 
-	return false
+	for _, name := range c.Mapping.Columns() {
+		if !slices.Contains(columns, name) {
+			return fmt.Errorf("mapping column %s does not exist", name)
+		}
+	}
+
+	if c.Outbox != nil {
+		for _, name := range []string{c.Outbox.AggregateTypeColumn, c.Outbox.AggregateIDColumn, c.Outbox.PayloadColumn} {
+			if !slices.Contains(columns, name) {
+				return fmt.Errorf("outbox column %s does not exist", name)
+			}
+		}
+	}
+
+	// a misspelled transform would publish the column in clear text
+	for _, name := range slices.Sorted(maps.Keys(c.Transforms)) {
+		if !slices.Contains(columns, name) {
+			return fmt.Errorf("transform column %s does not exist", name)
+		}
+	}
+
+	return nil
 }
 
-// WatchConfig for table watch list
-type WatchConfig struct {
-	Action  string `yaml:"action"`
-	Mapping string `yaml:"mapping"`
+// HasColumnList reports whether only a part of the columns is published.
+func (c WatchConfig) HasColumnList() bool {
+	return len(c.Columns) > 0 || len(c.ExcludeColumns) > 0
+}
+
+// PublishesColumn reports whether the column is published.
+func (c WatchConfig) PublishesColumn(name string) bool {
+	if len(c.Columns) > 0 {
+		return slices.Contains(c.Columns, name)
+	}
+
+	return !slices.Contains(c.ExcludeColumns, name)
 }
 
 func (w *WalTransaction) CreateEventsWithWatchList(watchList map[string]WatchConfig) []Event {
 	var events []Event
-	for _, item := range w.Actions {
-		dataOld := make(map[string]any)
-		for _, val := range item.OldColumns {
-			dataOld[val.Name] = val.value
-		}
-		data := make(map[string]any)
-		for _, val := range item.NewColumns {
-			data[val.Name] = val.value
-		}
-		event := Event{
-			ID:        uuid.New(),
-			Schema:    item.Schema,
-			Table:     item.Table,
-			Action:    item.Kind.string(),
-			DataOld:   dataOld,
-			Data:      data,
-			EventTime: *w.CommitTime,
+	for i, event := range w.newEvents() {
+		item := w.Actions[i]
+		// DDL is captured only when it is enabled and is not bound to the watch list.
+		if item.Kind == ActionKindDDL {
+			events = append(events, event)
+			continue
 		}
 		cfg, ok := watchList[item.Table]
 		if !ok {
 			continue
 		}
+		// outbox rows are published once, when they are inserted
+		if cfg.Outbox != nil && item.Kind != ActionKindInsert {
+			entry := logrus.WithFields(
+				logrus.Fields{
+					"schema": item.Schema,
+					"table":  item.Table,
+					"action": item.Kind,
+					"lsn":    w.LSN,
+					"seq":    event.Seq,
+				})
+			switch {
+			case item.Kind == ActionKindUpdate:
+				entry.Warnln("update of outbox row was skipped")
+			case item.Kind == ActionKindDelete && cfg.Outbox.DeletesProcessed() && !w.DeletedOutboxRows.Forget(event):
+				// the row may have been deleted before it was published
+				entry.WithField("key", event.Key).Warnln("delete of outbox row by another client was skipped")
+			default:
+				entry.Debugln("wal-message of outbox table was skipped")
+			}
+			continue
+		}
+		if cfg.Outbox != nil {
+			// the processed row is deleted by its key in the table
+			event.rowKey = newRowKey(event)
+		}
+		if cfg.HasColumnList() {
+			event.filterColumns(cfg.PublishesColumn)
+			if item.Kind == ActionKindSchemaChange && event.SchemaChange == nil {
+				logrus.WithFields(
+					logrus.Fields{
+						"schema": item.Schema,
+						"table":  item.Table,
+						"lsn":    w.LSN,
+					}).Debugln("schema change of columns which are not published was skipped")
+				continue
+			}
+		}
+		if cfg.Filter != nil && isRowAction(item.Kind) {
+			ok, err := cfg.Filter.match(&event)
+			if err != nil || !ok {
+				entry := logrus.WithFields(
+					logrus.Fields{
+						"schema": item.Schema,
+						"table":  item.Table,
+						"action": item.Kind,
+						"lsn":    w.LSN,
+						"seq":    event.Seq,
+					})
+				if err != nil {
+					entry = entry.WithError(err)
+				}
+				entry.Debugln("wal-message was skipped by row filter")
+				continue
+			}
+		}
+		if err := event.applyTransforms(cfg.Transforms); err != nil {
+			// the event is not published rather than leaking the value
+			logrus.WithFields(
+				logrus.Fields{
+					"schema": item.Schema,
+					"table":  item.Table,
+					"lsn":    w.LSN,
+					"seq":    event.Seq,
+				}).
+				WithError(err).
+				Errorln("wal-message was skipped, transform failed")
+			continue
+		}
+		if cfg.SkipNoopUpdates && event.isNoopUpdate(cfg.CompareColumns) {
+			logrus.WithFields(
+				logrus.Fields{
+					"schema": item.Schema,
+					"table":  item.Table,
+					"lsn":    w.LSN,
+					"seq":    event.Seq,
+				}).
+				Debugln("no-op update was skipped")
+			continue
+		}
 		actions := []string{}
 		if cfg.Action != "" {
 			for _, a := range strings.Split(cfg.Action, ",") {
@@ -300,7 +643,7 @@ func (w *WalTransaction) CreateEventsWithWatchList(watchList map[string]WatchCon
 				}
 			}
 		}
-		if len(actions) == 0 || inArray(actions, item.Kind.string()) {
+		if len(actions) == 0 || item.Kind == ActionKindSchemaChange || inArray(actions, item.Kind.string()) {
 			events = append(events, event)
 			continue
 		}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"ditto/common"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fullIdentityTransaction returns a transaction of a REPLICA IDENTITY FULL
+// table with the id, v and doc columns.
+func fullIdentityTransaction() *WalTransaction {
+	commit := time.Now()
+	w := NewWalTransaction()
+	w.LSN = 100
+	w.CommitTime = &commit
+	w.RelationStore[1] = RelationData{Schema: "public", Table: "docs", Replica: 'f', Columns: []Column{
+		{Name: "id", ValueType: common.Int4OID, ValueModifier: -1, IsKey: true},
+		{Name: "v", ValueType: common.TextOID, ValueModifier: -1},
+		{Name: "doc", ValueType: common.TextOID, ValueModifier: -1},
+	}}
+
+	return w
+}
+
+// tuple returns the tuple of the values, nil is NULL and "\x00" an unchanged TOAST value.
+func tuple(values ...*string) []common.TupleData {
+	row := make([]common.TupleData, len(values))
+	for i, v := range values {
+		switch {
+		case v == nil:
+			row[i] = common.TupleData{Kind: common.NullDataType}
+		case *v == "\x00":
+			row[i] = common.TupleData{Kind: common.ToastDataType}
+		default:
+			row[i] = common.TupleData{Kind: common.TextDataType, Value: []byte(*v)}
+		}
+	}
+
+	return row
+}
+
+func TestChangedColumns(t *testing.T) {
+	str := func(s string) *string { return &s }
+	toast := str("\x00")
+
+	tests := []struct {
+		name     string
+		old, new []common.TupleData
+		want     []string
+	}{
+		{name: "nothing", old: tuple(str("1"), str("a"), str("x")), new: tuple(str("1"), str("a"), str("x")), want: []string{}},
+		{name: "value", old: tuple(str("1"), str("a"), str("x")), new: tuple(str("1"), str("b"), str("x")), want: []string{"v"}},
+		{name: "null to value", old: tuple(str("1"), nil, str("x")), new: tuple(str("1"), str("a"), str("x")), want: []string{"v"}},
+		{name: "value to null", old: tuple(str("1"), str("a"), str("x")), new: tuple(str("1"), nil, str("x")), want: []string{"v"}},
+		{name: "null to null", old: tuple(str("1"), nil, str("x")), new: tuple(str("1"), nil, str("x")), want: []string{}},
+		{name: "unchanged toast", old: tuple(str("1"), str("a"), str("x")), new: tuple(str("1"), str("a"), toast), want: []string{}},
+		{name: "toast with other change", old: tuple(str("1"), str("a"), str("x")), new: tuple(str("1"), str("b"), toast), want: []string{"v"}},
+		{name: "key", old: tuple(str("1"), str("a"), str("x")), new: tuple(str("2"), str("a"), str("x")), want: []string{"id"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := fullIdentityTransaction()
+			a, err := w.CreateActionData(1, tt.old, tt.new, ActionKindUpdate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.OldRowFull = true
+			w.Actions = append(w.Actions, a)
+
+			got := w.CreateEvents()[0].Changed
+			if got == nil || !slices.Equal(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipNoopUpdates(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		config string
+		new    []common.TupleData
+		want   int
+	}{
+		{config: `{skip_noop_updates: true}`, new: tuple(str("1"), str("a"), str("x")), want: 0},
+		{config: `{skip_noop_updates: true}`, new: tuple(str("1"), str("b"), str("x")), want: 1},
+		{config: `{skip_noop_updates: true, compare_columns: [doc]}`, new: tuple(str("1"), str("b"), str("x")), want: 0},
+		{config: `{skip_noop_updates: true, compare_columns: [doc]}`, new: tuple(str("1"), str("a"), str("y")), want: 1},
+		{config: `{}`, new: tuple(str("1"), str("a"), str("x")), want: 1},
+	}
+
+	for _, tt := range tests {
+		var cfg WatchConfig
+		if err := yaml.Unmarshal([]byte(tt.config), &cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		w := fullIdentityTransaction()
+		a, err := w.CreateActionData(1, tuple(str("1"), str("a"), str("x")), tt.new, ActionKindUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.OldRowFull = true
+		w.Actions = append(w.Actions, a)
+
+		if got := len(w.CreateEventsWithWatchList(map[string]WatchConfig{"docs": cfg})); got != tt.want {
+			t.Errorf("%s: got %d events, want %d", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestWatchConfigCompareColumns(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{`{compare_columns: [doc], exclude_columns: [doc]}`, "compare column doc is not published"},
+		{`{compare_columns: [doc], columns: [id, v]}`, "compare column doc is not published"},
+		{`{compare_columns: [dco]}`, "compare column dco does not exist"},
+	}
+
+	for _, tt := range tests {
+		var cfg WatchConfig
+		if err := yaml.Unmarshal([]byte(tt.config), &cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		err := cfg.Validate()
+		if err == nil {
+			err = cfg.ValidateColumns([]string{"id", "v", "doc"})
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.config, err, tt.want)
+		}
+	}
+
+	var cfg WatchConfig
+	if err := yaml.Unmarshal([]byte(`{skip_noop_updates: true, compare_columns: [v]}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ValidateColumns([]string{"id", "v", "doc"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,399 @@
+package script
+
+import (
+	"ditto/common"
+	"ditto/models"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// maxSafeInteger largest integer which Lua numbers hold exactly, larger ones are passed as strings.
+const maxSafeInteger = 1<<53 - 1
+
+// null value of the NULL columns, tables can't hold nil.
+var null = &lua.LUserData{Metatable: lua.LNil}
+
+// maxDepth nesting of the tables returned by the scripts, it stops reference cycles.
+const maxDepth = 64
+
+// eventToLua returns the Lua table of the event, the fields are named as in
+// the JSON events with the topic added.
+func eventToLua(L *lua.LState, e models.Event, topic string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("id", lua.LString(e.ID.String()))
+	t.RawSetString("lsn", lua.LNumber(e.LSN))
+	t.RawSetString("xid", lua.LNumber(e.XID))
+	t.RawSetString("seq", lua.LNumber(e.Seq))
+	t.RawSetString("schema", lua.LString(e.Schema))
+	t.RawSetString("table", lua.LString(e.Table))
+	t.RawSetString("action", lua.LString(e.Action))
+	t.RawSetString("data", rowToLua(L, e.Data))
+	t.RawSetString("dataOld", rowToLua(L, e.DataOld))
+	t.RawSetString("key", rowToLua(L, e.Key))
+	t.RawSetString("changed", stringsToLua(L, e.Changed))
+	t.RawSetString("unchangedToast", stringsToLua(L, e.UnchangedToast))
+	t.RawSetString("beginTime", lua.LString(e.BeginTime.Format(time.RFC3339Nano)))
+	t.RawSetString("commitTime", lua.LString(e.EventTime.Format(time.RFC3339Nano)))
+	t.RawSetString("topic", lua.LString(topic))
+
+	return t
+}
+
+func rowToLua(L *lua.LState, row map[string]any) lua.LValue {
+	if row == nil {
+		return lua.LNil
+	}
+
+	t := L.CreateTable(0, len(row))
+	for name, v := range row {
+		t.RawSetString(name, valueToLua(L, v))
+	}
+
+	return t
+}
+
+func stringsToLua(L *lua.LState, values []string) lua.LValue {
+	if values == nil {
+		return lua.LNil
+	}
+
+	t := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		t.Append(lua.LString(v))
+	}
+
+	return t
+}
+
+// valueToLua converts the column value. Integers beyond 2^53, UUIDs and
+// times are strings, NUMERIC numbers are Lua numbers.
+func valueToLua(L *lua.LState, v any) lua.LValue {
+	if scalar, ok := scalarToLua(v); ok {
+		return scalar
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		return rowToLua(L, v)
+	case []any:
+		t := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(valueToLua(L, item))
+		}
+		return t
+	}
+
+	// other types as their JSON values
+	b, err := json.Marshal(v)
+	if err != nil {
+		return lua.LString(fmt.Sprint(v))
+	}
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return lua.LString(b)
+	}
+
+	return valueToLua(L, decoded)
+}
+
+// scalarToLua converts the values which are not tables.
+func scalarToLua(v any) (lua.LValue, bool) {
+	switch v := v.(type) {
+	case nil:
+		return null, true
+	case bool:
+		return lua.LBool(v), true
+	case string:
+		return lua.LString(v), true
+	case []byte:
+		return lua.LString(v), true
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return lua.LNumber(f), true
+		}
+		return lua.LString(v), true
+	case int:
+		return integerToLua(int64(v)), true
+	case int16:
+		return lua.LNumber(v), true
+	case int32:
+		return lua.LNumber(v), true
+	case int64:
+		return integerToLua(v), true
+	case uint32:
+		return lua.LNumber(v), true
+	case uint64:
+		if v > maxSafeInteger {
+			return lua.LString(strconv.FormatUint(v, 10)), true
+		}
+		return lua.LNumber(v), true
+	case float32:
+		return lua.LNumber(v), true
+	case float64:
+		return lua.LNumber(v), true
+	case time.Time:
+		return lua.LString(v.Format(time.RFC3339Nano)), true
+	case fmt.Stringer:
+		return lua.LString(v.String()), true
+	}
+
+	return nil, false
+}
+
+// integerToLua converts the integer, it is a string beyond 2^53.
+func integerToLua(v int64) lua.LValue {
+	if v > maxSafeInteger || v < -maxSafeInteger {
+		return lua.LString(strconv.FormatInt(v, 10))
+	}
+
+	return lua.LNumber(v)
+}
+
+// eventsFromLua converts the result of the script: nil drops the event, a
+// table with fields is one event and a list is several events.
+func eventsFromLua(ret lua.LValue, orig models.Event, topic string, maxEvents int) ([]Output, error) {
+	if ret == lua.LNil || ret == lua.LFalse {
+		return nil, nil
+	}
+
+	t, ok := ret.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("%s returned %s, expected nil, an event or a list of events", FunctionName, ret.Type())
+	}
+
+	items := []lua.LValue{t}
+	if t.MaxN() > 0 || t.Len() == 0 && isEmpty(t) {
+		items = items[:0]
+		for i := 1; i <= t.MaxN(); i++ {
+			items = append(items, t.RawGetInt(i))
+		}
+	}
+
+	if len(items) > maxEvents {
+		return nil, fmt.Errorf("%s returned %d events, the limit is %d", FunctionName, len(items), maxEvents)
+	}
+
+	outputs := make([]Output, 0, len(items))
+	for i, item := range items {
+		t, ok := item.(*lua.LTable)
+		if !ok {
+			return nil, fmt.Errorf("event %d is %s, expected a table", i+1, item.Type())
+		}
+
+		output, err := eventFromLua(t, orig, topic, i)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i+1, err)
+		}
+		outputs = append(outputs, output)
+	}
+
+	return outputs, nil
+}
+
+func isEmpty(t *lua.LTable) bool {
+	key, _ := t.Next(lua.LNil)
+	return key == lua.LNil
+}
+
+// eventFromLua returns the event of the table. The fields which are not set
+// keep the values of the original event, the positions in the WAL and the
+// times can't be changed. Events after the first get their own IDs.
+func eventFromLua(t *lua.LTable, orig models.Event, topic string, index int) (Output, error) {
+	e := orig
+	if index > 0 {
+		e.ID = uuid.NewSHA1(orig.ID, strconv.AppendInt(nil, int64(index), 10))
+	}
+
+	for name, field := range map[string]*string{"schema": &e.Schema, "table": &e.Table, "action": &e.Action, "topic": &topic} {
+		switch v := t.RawGetString(name).(type) {
+		case *lua.LNilType:
+		case lua.LString:
+			*field = string(v)
+		default:
+			return Output{}, fmt.Errorf("%s is %s, expected a string", name, v.Type())
+		}
+	}
+
+	if topic == "" {
+		return Output{}, errors.New("topic is empty")
+	}
+
+	var err error
+	if e.Data, err = rowFromLua(t.RawGetString("data"), orig.Data); err != nil {
+		return Output{}, fmt.Errorf("data: %w", err)
+	}
+	if e.DataOld, err = rowFromLua(t.RawGetString("dataOld"), orig.DataOld); err != nil {
+		return Output{}, fmt.Errorf("dataOld: %w", err)
+	}
+	if e.Key, err = rowFromLua(t.RawGetString("key"), orig.Key); err != nil {
+		return Output{}, fmt.Errorf("key: %w", err)
+	}
+	if len(e.Key) == 0 {
+		e.Key = nil
+	}
+	if e.Changed, err = stringsFromLua(t.RawGetString("changed")); err != nil {
+		return Output{}, fmt.Errorf("changed: %w", err)
+	}
+	if e.UnchangedToast, err = stringsFromLua(t.RawGetString("unchangedToast")); err != nil {
+		return Output{}, fmt.Errorf("unchangedToast: %w", err)
+	}
+
+	e.KeyColumns, e.Columns = retypeColumns(&e, orig.KeyColumns, orig.Columns)
+
+	return Output{Topic: topic, Event: e}, nil
+}
+
+// rowFromLua converts the row, the values which the script didn't change
+// keep their Go types.
+func rowFromLua(v lua.LValue, orig map[string]any) (map[string]any, error) {
+	if v == lua.LNil {
+		return nil, nil
+	}
+
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("%s, expected a table", v.Type())
+	}
+
+	row := make(map[string]any)
+	var err error
+	t.ForEach(func(k, v lua.LValue) {
+		if err != nil {
+			return
+		}
+		name, ok := k.(lua.LString)
+		if !ok {
+			err = fmt.Errorf("column name %s is not a string", k.Type())
+			return
+		}
+
+		if value, ok := orig[string(name)]; ok {
+			if scalar, ok := scalarToLua(value); ok && scalar == v {
+				row[string(name)] = value
+				return
+			}
+		}
+
+		row[string(name)], err = valueFromLua(v, 0)
+		if err != nil {
+			err = fmt.Errorf("column %s: %w", name, err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return row, nil
+}
+
+func stringsFromLua(v lua.LValue) ([]string, error) {
+	if v == lua.LNil {
+		return nil, nil
+	}
+
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("%s, expected a list", v.Type())
+	}
+
+	values := make([]string, 0, t.Len())
+	for i := 1; i <= t.Len(); i++ {
+		s, ok := t.RawGetInt(i).(lua.LString)
+		if !ok {
+			return nil, fmt.Errorf("item %d is not a string", i)
+		}
+		values = append(values, string(s))
+	}
+
+	return values, nil
+}
+
+// valueFromLua converts the value set by the script, integral numbers are int64.
+func valueFromLua(v lua.LValue, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("tables nested deeper than %d", maxDepth)
+	}
+
+	switch v := v.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case *lua.LUserData:
+		if v == null {
+			return nil, nil
+		}
+	case lua.LBool:
+		return bool(v), nil
+	case lua.LString:
+		return string(v), nil
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return int64(f), nil
+		}
+		return f, nil
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 {
+			items := make([]any, n)
+			for i := range items {
+				item, err := valueFromLua(v.RawGetInt(i+1), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = item
+			}
+			return items, nil
+		}
+
+		object := make(map[string]any)
+		var err error
+		v.ForEach(func(k, item lua.LValue) {
+			if err == nil {
+				object[k.String()], err = valueFromLua(item, depth+1)
+			}
+		})
+		return object, err
+	}
+
+	return nil, fmt.Errorf("%s can't be published", v.Type())
+}
+
+// retypeColumns returns the key columns and the columns of the rewritten
+// event: dropped columns are removed and added columns are typed as jsonb.
+func retypeColumns(e *models.Event, keyColumns []string, columns []models.ColumnType) ([]string, []models.ColumnType) {
+	names := make(map[string]bool)
+	for _, row := range []map[string]any{e.Data, e.DataOld, e.Key} {
+		for name := range row {
+			names[name] = true
+		}
+	}
+
+	keyColumns = slices.DeleteFunc(slices.Clone(keyColumns), func(name string) bool { _, ok := e.Key[name]; return !ok })
+	for _, name := range slices.Sorted(maps.Keys(e.Key)) {
+		if !slices.Contains(keyColumns, name) {
+			keyColumns = append(keyColumns, name)
+		}
+	}
+
+	columns = slices.DeleteFunc(slices.Clone(columns), func(c models.ColumnType) bool { return !names[c.Name] })
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		if !slices.ContainsFunc(columns, func(c models.ColumnType) bool { return c.Name == name }) {
+			columns = append(columns, models.ColumnType{
+				Name:         name,
+				TypeOID:      common.JSONBOID,
+				TypeModifier: -1,
+				IsKey:        slices.Contains(keyColumns, name),
+			})
+		}
+	}
+
+	return keyColumns, columns
+}
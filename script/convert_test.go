@@ -0,0 +1,236 @@
+package script
+
+import (
+	"ditto/common"
+	"ditto/models"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/google/uuid"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// convertEvent UPDATE with values of the Go types of the decoded rows.
+func convertEvent() models.Event {
+	return models.Event{
+		ID:        models.EventID(0x16B374D848, 0),
+		LSN:       0x16B374D848,
+		XID:       1042,
+		Schema:    "public",
+		Table:     "orders",
+		Action:    string(models.ActionKindUpdate),
+		EventTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Data: map[string]any{
+			"id":      int64(1 << 60),
+			"status":  "PAID",
+			"total":   json.Number("12.50"),
+			"note":    nil,
+			"payload": []byte("hi"),
+			"created": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			"meta":    map[string]any{"tags": []any{"a", "b"}},
+		},
+		DataOld:    map[string]any{"id": int64(1 << 60), "status": "NEW"},
+		Key:        map[string]any{"id": int64(1 << 60)},
+		Changed:    []string{"status"},
+		KeyColumns: []string{"id"},
+		Columns: []models.ColumnType{
+			{Name: "id", TypeOID: common.Int8OID, TypeModifier: -1, IsKey: true},
+			{Name: "status", TypeOID: common.TextOID, TypeModifier: -1},
+			{Name: "total", TypeOID: common.Numeric, TypeModifier: -1},
+			{Name: "note", TypeOID: common.TextOID, TypeModifier: -1},
+			{Name: "payload", TypeOID: common.ByteaOID, TypeModifier: -1},
+			{Name: "created", TypeOID: common.TimestamptzOID, TypeModifier: -1},
+			{Name: "meta", TypeOID: common.JSONBOID, TypeModifier: -1},
+		},
+	}
+}
+
+// convert calls the Lua code with the global event and converts its result.
+func convert(t *testing.T, src string, event models.Event) ([]Output, error) {
+	t.Helper()
+
+	L := lua.NewState()
+	defer L.Close()
+	L.SetGlobal("null", null)
+	L.SetGlobal("event", eventToLua(L, event, "orders"))
+
+	if err := L.DoString(src); err != nil {
+		t.Fatal(err)
+	}
+
+	return eventsFromLua(L.Get(-1), event, "orders", 10)
+}
+
+func TestEventToLua(t *testing.T) {
+	outputs, err := convert(t, `
+local d = event.data
+return {data = {
+  id = type(d.id) .. ":" .. d.id,
+  total = type(d.total) .. ":" .. d.total,
+  note = d.note == null,
+  payload_text = d.payload,
+  created_text = d.created,
+  tag = d.meta.tags[2],
+  lsn = event.lsn,
+  topic = event.topic,
+  changed = event.changed[1],
+  old = event.dataOld.status,
+}}
+`, convertEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"id":           "string:1152921504606846976",
+		"total":        "number:12.5",
+		"note":         true,
+		"payload_text": "hi",
+		"created_text": "2024-01-02T00:00:00Z",
+		"tag":          "b",
+		"lsn":          int64(0x16B374D848),
+		"topic":        "orders",
+		"changed":      "status",
+		"old":          "NEW",
+	}
+	if got := outputs[0].Event.Data; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestEventsFromLua(t *testing.T) {
+	t.Run("unchanged", func(t *testing.T) {
+		orig := convertEvent()
+		outputs, err := convert(t, `return event`, orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outputs) != 1 || outputs[0].Topic != "orders" {
+			t.Fatalf("got %v", outputs)
+		}
+
+		got := outputs[0].Event
+		for name, want := range orig.Data {
+			// tables are converted back, the other values keep their types
+			if name != "meta" && !reflect.DeepEqual(got.Data[name], want) {
+				t.Errorf("got %s %#v, want %#v", name, got.Data[name], want)
+			}
+		}
+		if !reflect.DeepEqual(got.Data["meta"], map[string]any{"tags": []any{"a", "b"}}) {
+			t.Errorf("got meta %#v", got.Data["meta"])
+		}
+		if got.ID != orig.ID || got.LSN != orig.LSN || !reflect.DeepEqual(got.Columns, orig.Columns) {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		outputs, err := convert(t, `
+event.data.status = "SHIPPED"
+event.data.note = nil
+event.data.payload = null
+event.data.count = 3
+event.data.ratio = 0.5
+event.data.items = {{sku = "a"}}
+event.key = {}
+event.action = "ORDER_SHIPPED"
+event.topic = "shipments"
+return event
+`, convertEvent())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := outputs[0]
+		if got.Topic != "shipments" || got.Event.Action != "ORDER_SHIPPED" || got.Event.Key != nil {
+			t.Errorf("got %+v", got)
+		}
+		data := got.Event.Data
+		if _, ok := data["note"]; ok {
+			t.Error("nil doesn't remove the column")
+		}
+		for name, want := range map[string]any{"status": "SHIPPED", "payload": nil, "count": int64(3), "ratio": 0.5, "items": []any{map[string]any{"sku": "a"}}} {
+			if !reflect.DeepEqual(data[name], want) {
+				t.Errorf("got %s %#v, want %#v", name, data[name], want)
+			}
+		}
+
+		var names []string
+		for _, c := range got.Event.Columns {
+			names = append(names, c.Name)
+			if c.Name == "count" && c.TypeOID != common.JSONBOID {
+				t.Errorf("added column is typed %d", c.TypeOID)
+			}
+		}
+		if strings.Join(names, ",") != "id,status,total,payload,created,meta,count,items,ratio" {
+			t.Errorf("got columns %v", names)
+		}
+		if len(got.Event.KeyColumns) != 0 {
+			t.Errorf("got key columns %v", got.Event.KeyColumns)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		orig := convertEvent()
+		outputs, err := convert(t, `return {event, {action = "EXTRA", topic = "extra"}, event}`, orig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outputs) != 3 {
+			t.Fatalf("got %d events", len(outputs))
+		}
+		for i, output := range outputs {
+			want := orig.ID
+			if i > 0 {
+				want = uuid.NewSHA1(orig.ID, []byte(strconv.Itoa(i)))
+			}
+			if output.Event.ID != want {
+				t.Errorf("event %d has ID %s, want %s", i, output.Event.ID, want)
+			}
+		}
+		// the rows are taken as returned
+		if extra := outputs[1]; extra.Topic != "extra" || extra.Event.Table != "orders" || extra.Event.Data != nil {
+			t.Errorf("got %+v", extra)
+		}
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		for _, src := range []string{`return nil`, `return false`, `return {}`} {
+			outputs, err := convert(t, src, convertEvent())
+			if err != nil || len(outputs) != 0 {
+				t.Errorf("%s: got %v, %v", src, outputs, err)
+			}
+		}
+	})
+}
+
+func TestEventsFromLuaErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`return 1`, "returned number, expected nil, an event or a list of events"},
+		{`return {1}`, "event 1 is number, expected a table"},
+		{`event.topic = "" return event`, "topic is empty"},
+		{`event.action = 1 return event`, "action is number, expected a string"},
+		{`event.data = 1 return event`, "data: number, expected a table"},
+		{`event.data[1] = 1 return event`, "column name number is not a string"},
+		{`event.data.f = print return event`, "column f: function can't be published"},
+		{`event.changed = {1} return event`, "changed: item 1 is not a string"},
+		{`local t = {} t.t = t event.data.t = t return event`, "tables nested deeper than 64"},
+		{`local events = {} for i = 1, 11 do events[i] = event end return events`, "returned 11 events, the limit is 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := convert(t, tt.src, convertEvent())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
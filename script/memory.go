@@ -0,0 +1,114 @@
+package script
+
+import (
+	"errors"
+	"runtime/metrics"
+	"time"
+	"unsafe"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// errMemoryLimit cause of the calls canceled by the memory limit.
+var errMemoryLimit = errors.New("memory limit exceeded")
+
+// memoryPollInterval how often the allocations of a running call are checked.
+const memoryPollInterval = time.Millisecond
+
+// approximate bytes of the Lua values counted by stateSize.
+const (
+	valueSize    = 16
+	tableSize    = 128
+	functionSize = 128
+)
+
+// heapAllocs returns the bytes allocated on the heap by the process so far.
+func heapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+
+	return sample[0].Value.Uint64()
+}
+
+// watchMemory calls exceeded when the process allocated more than limit bytes
+// since start, until stop is called. The allocations of the other goroutines
+// are counted as well, so the limit is approximate and errs on the low side.
+func watchMemory(start, limit uint64, exceeded func()) (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(memoryPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if heapAllocs()-start > limit {
+					exceeded()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// stateSize returns the approximate bytes of the values reachable from the
+// globals and the registry of the state, it stops counting past limit. The
+// values which outlive a call are kept there or in the upvalues of the
+// functions.
+func stateSize(state *lua.LState, limit uint64) uint64 {
+	seen := make(map[any]bool)
+	stack := []lua.LValue{state.G.Global, state.G.Registry}
+
+	var size uint64
+	for len(stack) > 0 && size <= limit {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		size += valueSize
+
+		switch v := v.(type) {
+		case lua.LString:
+			// the copies of a string share its bytes
+			if len(v) == 0 || seen[unsafe.StringData(string(v))] {
+				continue
+			}
+			seen[unsafe.StringData(string(v))] = true
+			size += uint64(len(v))
+		case *lua.LTable:
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			size += tableSize
+			stack = append(stack, v.Metatable)
+			for key, item := v.Next(lua.LNil); key != lua.LNil && size <= limit; key, item = v.Next(key) {
+				size += 2 * valueSize
+				stack = append(stack, key, item)
+			}
+		case *lua.LFunction:
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			size += functionSize
+			if v.Env != nil {
+				stack = append(stack, v.Env)
+			}
+			for _, upvalue := range v.Upvalues {
+				stack = append(stack, upvalue.Value())
+			}
+		case *lua.LUserData:
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			stack = append(stack, v.Metatable)
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,251 @@
+package script
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/pm"
+)
+
+// sandboxLibs libraries of the scripts, io, os, package, debug, channel and
+// coroutine are not available.
+var sandboxLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// unsafeGlobals base functions which load code or reach outside the sandbox.
+var unsafeGlobals = []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "_printregs"}
+
+// openSandbox opens the libraries of the scripts, print writes to the log
+// and the results of string.rep, string.format, string.gsub and
+// table.concat are limited to maxStringSize bytes. The global null is the
+// value of the NULL columns.
+func openSandbox(state *lua.LState, maxStringSize int) {
+	for _, lib := range sandboxLibs {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+
+	for _, name := range unsafeGlobals {
+		state.SetGlobal(name, lua.LNil)
+	}
+
+	state.SetGlobal("null", null)
+
+	state.SetGlobal("print", state.NewFunction(func(L *lua.LState) int {
+		args := make([]string, L.GetTop())
+		for i := range args {
+			args[i] = L.ToStringMeta(L.Get(i + 1)).String()
+		}
+		logrus.WithField("script", L.Where(1)).Info(strings.Join(args, "\t"))
+		return 0
+	}))
+
+	strs := state.GetGlobal(lua.StringLibName).(*lua.LTable)
+	strs.RawSetString("rep", state.NewFunction(func(L *lua.LState) int {
+		s := L.CheckString(1)
+		n := L.CheckInt(2)
+		if n <= 0 {
+			L.Push(lua.LString(""))
+			return 1
+		}
+		if len(s) > 0 && n > maxStringSize/len(s) {
+			L.RaiseError("string.rep result exceeds %d bytes", maxStringSize)
+		}
+		L.Push(lua.LString(strings.Repeat(s, n)))
+		return 1
+	}))
+	strs.RawSetString("format", state.NewFunction(format(maxStringSize, strs.RawGetString("format").(*lua.LFunction).GFunction)))
+	strs.RawSetString("gsub", state.NewFunction(gsub(maxStringSize)))
+
+	tabs := state.GetGlobal(lua.TabLibName).(*lua.LTable)
+	tabs.RawSetString("concat", state.NewFunction(concat(maxStringSize, tabs.RawGetString("concat").(*lua.LFunction).GFunction)))
+}
+
+// limitedBuilder builds the result of a string function, it raises an error
+// past max bytes.
+type limitedBuilder struct {
+	strings.Builder
+	L    *lua.LState
+	name string
+	max  int
+}
+
+func (b *limitedBuilder) write(s string) {
+	if b.Len()+len(s) > b.max {
+		b.L.RaiseError("%s result exceeds %d bytes", b.name, b.max)
+	}
+	b.WriteString(s)
+}
+
+// format is string.format with widths and precisions of at most two digits
+// as in Lua 5.1, it fails when the result may exceed maxStringSize bytes.
+func format(maxStringSize int, orig lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		f := L.CheckString(1)
+		size, arg := len(f), 2
+		for i := 0; i < len(f); i++ {
+			if f[i] != '%' {
+				continue
+			}
+			if i++; i < len(f) && f[i] == '%' {
+				continue
+			}
+			for i < len(f) && strings.IndexByte("-+ #0", f[i]) >= 0 {
+				i++
+			}
+			width, precision := digits(f, &i), 0
+			if i < len(f) && f[i] == '.' {
+				i++
+				precision = digits(f, &i)
+			}
+			if width > 2 || precision > 2 {
+				L.RaiseError("invalid format (width or precision too long)")
+			}
+
+			// numbers are at most a few hundred digits
+			size += 99 + 512
+			if s, ok := L.Get(arg).(lua.LString); ok {
+				size += len(s)
+			}
+			arg++
+		}
+		if size > maxStringSize {
+			L.RaiseError("string.format result exceeds %d bytes", maxStringSize)
+		}
+
+		return orig(L)
+	}
+}
+
+// digits skips the decimal digits of s at *i and returns their number.
+func digits(s string, i *int) int {
+	start := *i
+	for *i < len(s) && s[*i] >= '0' && s[*i] <= '9' {
+		*i++
+	}
+
+	return *i - start
+}
+
+// gsub is string.gsub which fails when its result exceeds maxStringSize
+// bytes. It writes the result once, the library version copies the whole
+// string for every match.
+func gsub(maxStringSize int) lua.LGFunction {
+	return func(L *lua.LState) int {
+		str := L.CheckString(1)
+		pattern := L.CheckString(2)
+		L.CheckTypes(3, lua.LTString, lua.LTTable, lua.LTFunction)
+		repl := L.Get(3)
+		limit := L.OptInt(4, -1)
+
+		matches, err := pm.Find(pattern, []byte(str), 0, limit)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+
+		b := &limitedBuilder{L: L, name: "string.gsub", max: maxStringSize}
+		last := 0
+		for _, m := range matches {
+			start, end := m.Capture(0), m.Capture(1)
+			b.write(str[last:start])
+			last = end
+
+			var value lua.LValue
+			switch repl := repl.(type) {
+			case lua.LString:
+				expand(b, string(repl), str, m)
+				continue
+			case *lua.LTable:
+				value = L.GetTable(repl, capture(str, m, 1))
+			case *lua.LFunction:
+				L.Push(repl)
+				n := max(m.CaptureLength()/2-1, 1)
+				for i := 1; i <= n; i++ {
+					L.Push(capture(str, m, i))
+				}
+				L.Call(n, 1)
+				value = L.Get(-1)
+				L.Pop(1)
+			}
+
+			switch {
+			case lua.LVIsFalse(value):
+				// keeps the match
+				b.write(str[start:end])
+			case lua.LVCanConvToString(value):
+				b.write(lua.LVAsString(value))
+			default:
+				L.RaiseError("invalid replacement value (a %s)", value.Type())
+			}
+		}
+		b.write(str[last:])
+
+		L.Push(lua.LString(b.String()))
+		L.Push(lua.LNumber(len(matches)))
+		return 2
+	}
+}
+
+// expand writes the replacement string of the match: %0 is the match, %1 to
+// %9 are its captures and %% is a percent sign.
+func expand(b *limitedBuilder, repl, str string, m *pm.MatchData) {
+	for i := 0; i < len(repl); i++ {
+		if repl[i] != '%' || i == len(repl)-1 {
+			b.write(repl[i : i+1])
+			continue
+		}
+
+		i++
+		switch c := repl[i]; {
+		case c == '%':
+			b.write("%")
+		case c >= '0' && c <= '9':
+			n := int(c - '0')
+			if n > 1 && 2*n >= m.CaptureLength() {
+				b.L.RaiseError("invalid capture index")
+			}
+			b.write(lua.LVAsString(capture(str, m, n)))
+		default:
+			b.write(repl[i-1 : i+1])
+		}
+	}
+}
+
+// capture returns the capture n of the match, the whole match for 0 and
+// for 1 when the pattern has no captures. Position captures are numbers.
+func capture(str string, m *pm.MatchData, n int) lua.LValue {
+	idx := 2 * n
+	if idx >= m.CaptureLength() {
+		idx = 0
+	}
+	if m.IsPosCapture(idx) {
+		return lua.LNumber(m.Capture(idx))
+	}
+
+	return lua.LString(str[m.Capture(idx):m.Capture(idx+1)])
+}
+
+// concat is table.concat which fails when its result exceeds maxStringSize bytes.
+func concat(maxStringSize int, orig lua.LGFunction) lua.LGFunction {
+	return func(L *lua.LState) int {
+		t := L.CheckTable(1)
+		sep := L.OptString(2, "")
+		size := -len(sep)
+		for i := max(L.OptInt(3, 1), 1); i <= min(L.OptInt(4, t.Len()), t.Len()); i++ {
+			if size += len(sep) + len(lua.LVAsString(t.RawGetInt(i))); size > maxStringSize {
+				L.RaiseError("table.concat result exceeds %d bytes", maxStringSize)
+			}
+		}
+
+		return orig(L)
+	}
+}
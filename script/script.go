@@ -0,0 +1,315 @@
+// Package script runs the Lua scripts which rewrite the change events.
+//
+// A script defines the global function transform, it receives the event with
+// its topic and returns the events to publish:
+//
+//	function transform(event)
+//	  if event.data.status == "DRAFT" then
+//	    return nil -- drop the event
+//	  end
+//	  event.topic = "orders." .. string.lower(event.data.region)
+//	  return event
+//	end
+//
+// It returns nil, an event or a list of events. The scripts run in a sandbox
+// without the io, os, package and debug libraries, every call is limited in
+// time, memory and in the depth of its call and value stacks.
+package script
+
+import (
+	"context"
+	"ditto/models"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// FunctionName name of the global function of the scripts.
+const FunctionName = "transform"
+
+// Limits of the script calls.
+type Limits struct {
+	// Timeout of the call for one event, 100ms by default.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxCallDepth depth of the nested function calls, 200 by default.
+	MaxCallDepth int `yaml:"max_call_depth"`
+	// MaxStackSize slots of the value stack, 65536 by default.
+	MaxStackSize int `yaml:"max_stack_size"`
+	// MaxStringSize bytes of the strings built by string.rep, string.format,
+	// string.gsub and table.concat, 1 MiB by default.
+	MaxStringSize int `yaml:"max_string_size"`
+	// MaxMemory bytes allocated by a call and held by the globals of the
+	// script, 64 MiB by default.
+	MaxMemory int `yaml:"max_memory"`
+	// MaxEvents events returned for one event, 100 by default.
+	MaxEvents int `yaml:"max_events"`
+	// ReloadInterval how often the script file is checked for changes,
+	// 5s by default, a negative interval disables the reload.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// withDefaults returns the limits with the defaults of the unset limits.
+func (l Limits) withDefaults() Limits {
+	if l.Timeout <= 0 {
+		l.Timeout = 100 * time.Millisecond
+	}
+	if l.MaxCallDepth <= 0 {
+		l.MaxCallDepth = 200
+	}
+	if l.MaxStackSize <= 0 {
+		l.MaxStackSize = 65536
+	}
+	if l.MaxStringSize <= 0 {
+		l.MaxStringSize = 1 << 20
+	}
+	if l.MaxMemory <= 0 {
+		l.MaxMemory = 64 << 20
+	}
+	if l.MaxEvents <= 0 {
+		l.MaxEvents = 100
+	}
+	if l.ReloadInterval == 0 {
+		l.ReloadInterval = 5 * time.Second
+	}
+
+	return l
+}
+
+// Output event returned by the script with its topic.
+type Output struct {
+	Topic string
+	Event models.Event
+}
+
+// Script Lua script loaded from a file, it is safe for concurrent use.
+type Script struct {
+	path   string
+	limits Limits
+
+	mu      sync.Mutex
+	state   *lua.LState
+	proto   *lua.FunctionProto
+	modTime time.Time
+	size    int64
+	checked time.Time
+	// retained bytes held by the state when it was measured, allocated
+	// bytes allocated by the calls since then.
+	retained  uint64
+	allocated uint64
+}
+
+// Load compiles the script file and runs its top level code.
+func Load(path string, limits Limits) (*Script, error) {
+	s := &Script{path: path, limits: limits.withDefaults()}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Path returns the path of the script file.
+func (s *Script) Path() string {
+	return s.path
+}
+
+// load compiles the file into a new state, the current state stays when it fails.
+func (s *Script) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	chunk, err := parse.Parse(src, s.path)
+	if err != nil {
+		return fmt.Errorf("script %s: %w", s.path, err)
+	}
+	proto, err := lua.Compile(chunk, s.path)
+	if err != nil {
+		return fmt.Errorf("script %s: %w", s.path, err)
+	}
+
+	state, retained, err := s.newState(proto)
+	if err != nil {
+		return err
+	}
+
+	s.setState(state, retained)
+	s.proto = proto
+	s.modTime, s.size = info.ModTime(), info.Size()
+	s.checked = time.Now()
+
+	return nil
+}
+
+// newState creates the sandbox and runs the top level code of the script,
+// it returns the state with the bytes it holds.
+func (s *Script) newState(proto *lua.FunctionProto) (*lua.LState, uint64, error) {
+	state := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   s.limits.MaxCallDepth,
+		RegistrySize:    min(s.limits.MaxStackSize, lua.RegistrySize),
+		RegistryMaxSize: s.limits.MaxStackSize,
+	})
+	openSandbox(state, s.limits.MaxStringSize)
+
+	if _, err := s.call(state, state.NewFunctionFromProto(proto), 0); err != nil {
+		state.Close()
+		return nil, 0, fmt.Errorf("script %s: %w", s.path, err)
+	}
+
+	if _, ok := state.GetGlobal(FunctionName).(*lua.LFunction); !ok {
+		state.Close()
+		return nil, 0, fmt.Errorf("script %s: function %s is not defined", s.path, FunctionName)
+	}
+
+	limit := uint64(s.limits.MaxMemory)
+	retained := stateSize(state, limit)
+	if retained > limit {
+		state.Close()
+		return nil, 0, fmt.Errorf("script %s: globals hold more than the memory limit of %d bytes", s.path, limit)
+	}
+
+	return state, retained, nil
+}
+
+// ReloadIfChanged reloads the script when its file changed, at most once per
+// reload interval. It reports whether the script was reloaded, the previous
+// version stays in use when the new one fails to load.
+func (s *Script) ReloadIfChanged() (bool, error) {
+	if s.limits.ReloadInterval < 0 {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checked) < s.limits.ReloadInterval {
+		return false, nil
+	}
+	s.checked = time.Now()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return false, nil
+	}
+
+	if err := s.load(); err != nil {
+		// don't retry the broken version until the file changes again
+		s.modTime, s.size = info.ModTime(), info.Size()
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Run calls the script with the event published on the topic and returns
+// the events to publish. The state of a failed call is discarded, and so is
+// the state which holds more than the memory limit after the call.
+func (s *Script) Run(event models.Event, topic string) ([]Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	allocated, err := s.call(s.state, s.state.GetGlobal(FunctionName), 1, eventToLua(s.state, event, topic))
+	if err != nil {
+		s.reset()
+		return nil, fmt.Errorf("script %s: %w", s.path, err)
+	}
+
+	ret := s.state.Get(-1)
+	s.state.Pop(1)
+
+	// the state is measured again only when it may have grown past the limit
+	limit := uint64(s.limits.MaxMemory)
+	if s.allocated += allocated; s.retained+s.allocated > limit {
+		s.retained, s.allocated = stateSize(s.state, limit), 0
+		if s.retained > limit {
+			s.reset()
+			return nil, fmt.Errorf("script %s: globals hold more than the memory limit of %d bytes", s.path, limit)
+		}
+	}
+
+	outputs, err := eventsFromLua(ret, event, topic, s.limits.MaxEvents)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", s.path, err)
+	}
+
+	return outputs, nil
+}
+
+// call calls the function with the arguments in the state within the time
+// and memory limits, the results stay on the stack. It returns the bytes
+// allocated during the call.
+func (s *Script) call(state *lua.LState, fn lua.LValue, nret int, args ...lua.LValue) (uint64, error) {
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), s.limits.Timeout)
+	defer cancelTimeout()
+	ctx, cancel := context.WithCancelCause(timeout)
+	defer cancel(nil)
+
+	start := heapAllocs()
+	stop := watchMemory(start, uint64(s.limits.MaxMemory), func() { cancel(errMemoryLimit) })
+	state.SetContext(ctx)
+	err := state.CallByParam(lua.P{Fn: fn, NRet: nret, Protect: true}, args...)
+	state.RemoveContext()
+	stop()
+	allocated := heapAllocs() - start
+
+	if err != nil {
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) {
+			// without the stack trace
+			err = errors.New(apiErr.Object.String())
+		}
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, errMemoryLimit):
+			err = fmt.Errorf("memory limit of %d bytes exceeded: %w", s.limits.MaxMemory, err)
+		case errors.Is(cause, context.DeadlineExceeded):
+			err = fmt.Errorf("timeout %s exceeded: %w", s.limits.Timeout, err)
+		}
+	}
+
+	return allocated, err
+}
+
+// reset replaces the state of the failed call, its globals may be half updated.
+func (s *Script) reset() {
+	state, retained, err := s.newState(s.proto)
+	if err != nil {
+		// the top level code succeeded before, keep the state
+		return
+	}
+
+	s.setState(state, retained)
+}
+
+// setState replaces the state of the script with the new one holding
+// retained bytes.
+func (s *Script) setState(state *lua.LState, retained uint64) {
+	if s.state != nil {
+		s.state.Close()
+	}
+	s.state = state
+	s.retained, s.allocated = retained, 0
+}
+
+// Close releases the state of the script.
+func (s *Script) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Close()
+}
@@ -0,0 +1,278 @@
+package script
+
+import (
+	"ditto/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript writes the script into a temporary file and returns its path.
+func writeScript(t *testing.T, src string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "script.lua")
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// loadScript loads the script with the limits and closes it after the test.
+func loadScript(t *testing.T, src string, limits Limits) *Script {
+	t.Helper()
+
+	s, err := Load(writeScript(t, src), limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func testEvent() models.Event {
+	return models.Event{
+		ID:     models.EventID(0x16B374D848, 0),
+		LSN:    0x16B374D848,
+		Schema: "public",
+		Table:  "orders",
+		Action: string(models.ActionKindInsert),
+		Data:   map[string]any{"id": int32(7), "status": "PAID"},
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "io", src: `error(type(io))`, want: ":2: nil"},
+		{name: "os", src: `error(type(os))`, want: ":2: nil"},
+		{name: "require", src: `error(type(require))`, want: ":2: nil"},
+		{name: "load", src: `error(type(load))`, want: ":2: nil"},
+		{name: "loadstring", src: `error(type(loadstring))`, want: ":2: nil"},
+		{name: "dofile", src: `error(type(dofile))`, want: ":2: nil"},
+		{name: "loadfile", src: `error(type(loadfile))`, want: ":2: nil"},
+		{name: "debug", src: `error(type(debug))`, want: ":2: nil"},
+		{name: "package", src: `error(type(package))`, want: ":2: nil"},
+		{name: "coroutine", src: `error(type(coroutine))`, want: ":2: nil"},
+		{name: "module", src: `error(type(module))`, want: ":2: nil"},
+		{name: "string.rep", src: `string.rep("x", 1e9)`, want: "string.rep result exceeds 1048576 bytes"},
+		{name: "string.format width", src: `string.format("%999d", 1)`, want: "width or precision too long"},
+		{name: "string.format precision", src: `string.format("%.100f", 1)`, want: "width or precision too long"},
+		{name: "string.format result", src: `local s = string.rep("x", 600000) string.format("%s%s", s, s)`, want: "string.format result exceeds"},
+		{name: "string.gsub", src: `string.gsub(string.rep("x", 1000), "x", string.rep("y", 2000))`, want: "string.gsub result exceeds"},
+		{name: "string.gsub captures", src: `string.gsub(string.rep("x", 1000), "x+", string.rep("%0", 2000))`, want: "string.gsub result exceeds"},
+		{name: "table.concat", src: `local s = string.rep("x", 600000) table.concat({s, s})`, want: "table.concat result exceeds"},
+		{name: "concatenation", src: `local s = "x" while true do s = s .. s end`, want: "memory limit of 16777216 bytes exceeded"},
+		{name: "table growth", src: `local t = {} local i = 0 while true do i = i + 1 t[i] = {i} end`, want: "memory limit of 16777216 bytes exceeded"},
+		{name: "recursion", src: `local function f() return f() + 1 end f()`, want: "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := loadScript(t, "function transform(event)\n"+tt.src+"\nreturn event\nend\n", Limits{Timeout: 10 * time.Second, MaxMemory: 16 << 20})
+
+			_, err := s.Run(testEvent(), "orders")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringFunctions(t *testing.T) {
+	s := loadScript(t, `
+function transform(event)
+  local d = event.data
+  d.format = string.format("%5.2f|%-3s|%%|%d", 1.5, "a", 7)
+  d.gsub, d.count = string.gsub("hello world", "(o)", "[%1%%]")
+  d.gsub_whole = string.gsub("abc", "b", "<%0>")
+  d.gsub_table = string.gsub("$a $b $c", "%$(%w)", {a = "1", b = false})
+  d.gsub_func = string.gsub("a=1, b=2", "(%w)=(%w)", function(k, v) return v .. k end)
+  d.gsub_limit = string.gsub("aaa", "a", "b", 2)
+  d.concat = table.concat({1, "b", 3}, ",", 2)
+  return event
+end
+`, Limits{})
+
+	outputs, err := s.Run(testEvent(), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := outputs[0].Event.Data
+	want := map[string]any{
+		"format":     " 1.50|a  |%|7",
+		"gsub":       "hell[o%] w[o%]rld",
+		"count":      int64(2),
+		"gsub_whole": "a<b>c",
+		"gsub_table": "1 $b $c",
+		"gsub_func":  "1a, 2b",
+		"gsub_limit": "bba",
+		"concat":     "b,3",
+	}
+	for name, v := range want {
+		if data[name] != v {
+			t.Errorf("got %s %#v, want %#v", name, data[name], v)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		s := loadScript(t, "function transform(event) while true do end end", Limits{Timeout: 10 * time.Millisecond})
+		if _, err := s.Run(testEvent(), "orders"); err == nil || !strings.Contains(err.Error(), "timeout 10ms exceeded") {
+			t.Fatalf("got error %v", err)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		s := loadScript(t, "function transform(event) local events = {} for i = 1, 4 do events[i] = event end return events end", Limits{MaxEvents: 3})
+		if _, err := s.Run(testEvent(), "orders"); err == nil || !strings.Contains(err.Error(), "returned 4 events, the limit is 3") {
+			t.Fatalf("got error %v", err)
+		}
+	})
+
+	t.Run("top level", func(t *testing.T) {
+		_, err := Load(writeScript(t, `big = string.rep("x", 1000000) .. "y" function transform(event) return event end`), Limits{MaxMemory: 512 << 10})
+		if err == nil || !strings.Contains(err.Error(), "memory limit") {
+			t.Fatalf("got error %v", err)
+		}
+	})
+}
+
+func TestRetainedMemory(t *testing.T) {
+	s := loadScript(t, `
+cache = {}
+function transform(event)
+  cache[#cache + 1] = string.rep("x", 1000000) .. event.id
+  event.data.cached = #cache
+  return event
+end
+`, Limits{MaxMemory: 8 << 20})
+
+	failed := false
+	for i := 0; i < 20 && !failed; i++ {
+		_, err := s.Run(testEvent(), "orders")
+		if err != nil {
+			if !strings.Contains(err.Error(), "globals hold more than the memory limit of 8388608 bytes") {
+				t.Fatal(err)
+			}
+			failed = true
+		}
+	}
+	if !failed {
+		t.Fatal("the globals grew past the limit")
+	}
+
+	// the state is recreated
+	outputs, err := s.Run(testEvent(), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := outputs[0].Event.Data["cached"]; got != int64(1) {
+		t.Errorf("got %v cached values after the reset", got)
+	}
+}
+
+func TestResetAfterFailure(t *testing.T) {
+	s := loadScript(t, `
+n = 0
+function transform(event)
+  n = n + 1
+  if event.data.status == "FAIL" then
+    error("boom")
+  end
+  event.data.n = n
+  return event
+end
+`, Limits{})
+
+	run := func(status string) (any, error) {
+		event := testEvent()
+		event.Data["status"] = status
+		outputs, err := s.Run(event, "orders")
+		if err != nil {
+			return nil, err
+		}
+		return outputs[0].Event.Data["n"], nil
+	}
+
+	for _, want := range []int64{1, 2} {
+		if got, err := run("PAID"); err != nil || got != want {
+			t.Fatalf("got %v, %v, want %d", got, err, want)
+		}
+	}
+	if _, err := run("FAIL"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("got error %v", err)
+	}
+	if got, err := run("PAID"); err != nil || got != int64(1) {
+		t.Fatalf("got %v, %v after the failure, want 1", got, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "syntax", src: "function transform(", want: "script.lua"},
+		{name: "no function", src: "x = 1", want: "function transform is not defined"},
+		{name: "top level error", src: `error("boom")`, want: "boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeScript(t, tt.src), Limits{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeScript(t, `function transform(event) event.data.v = 1 return event end`)
+	s, err := Load(path, Limits{ReloadInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	version := func() any {
+		t.Helper()
+		outputs, err := s.Run(testEvent(), "orders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return outputs[0].Event.Data["v"]
+	}
+
+	if err := os.WriteFile(path, []byte(`function transform(event) event.data.v = 22 return event end`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := s.ReloadIfChanged(); !reloaded || err != nil {
+		t.Fatalf("got %v, %v", reloaded, err)
+	}
+	if got := version(); got != int64(22) {
+		t.Errorf("got version %v after the reload", got)
+	}
+
+	// a broken version keeps the previous one
+	if err := os.WriteFile(path, []byte(`function transform(`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := s.ReloadIfChanged(); reloaded || err == nil {
+		t.Fatalf("got %v, %v", reloaded, err)
+	}
+	if got := version(); got != int64(22) {
+		t.Errorf("got version %v after the failed reload", got)
+	}
+}
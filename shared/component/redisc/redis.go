@@ -4,9 +4,9 @@ import (
 	"context"
 	"ditto/models"
 	"ditto/shared/common"
-	"encoding/json"
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	sctx "github.com/phathdt/service-context"
@@ -14,12 +14,24 @@ import (
 )
 
 type RedisComp interface {
-	Publish(topic string, event models.Event) error
+	Publish(topic string, msg models.Message) error
+	// SupportsHeaders reports whether the message headers are sent.
+	SupportsHeaders() bool
 }
 
+// kind of redis mode.
+const (
+	// ModeList pushes the message value to a list, the key and headers are
+	// dropped. Values which are not JSON are prefixed with the content type, see listValue.
+	ModeList = "list"
+	// ModeStream adds the message to a stream, with its key, content type and headers as fields.
+	ModeStream = "stream"
+)
+
 type redisComp struct {
 	client *redis.Client
 	url    string
+	mode   string
 }
 
 func New(key string, dsn string) sctx.Component {
@@ -39,9 +51,14 @@ func (r *redisComp) InitFlags() {
 		"redis://localhost:6379",
 		"Redis URL (e.g. redis://redis-db:6379)",
 	)
+	flag.StringVar(&r.mode, "redis_mode", ModeList, "publish to a redis list or stream (list, stream)")
 }
 
 func (r *redisComp) Activate(sc sctx.ServiceContext) error {
+	if r.mode != ModeList && r.mode != ModeStream {
+		return fmt.Errorf("unsupported redis mode: %s", r.mode)
+	}
+
 	opts, err := redis.ParseURL(r.url)
 	if err != nil {
 		return fmt.Errorf("parse redis url failed: %w", err)
@@ -65,12 +82,53 @@ func (r *redisComp) Stop() error {
 	return r.client.Close()
 }
 
-func (r *redisComp) Publish(topic string, event models.Event) error {
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("marshal event failed: %w", err)
+func (r *redisComp) Publish(topic string, msg models.Message) error {
+	if r.mode == ModeList {
+		return r.client.LPush(context.Background(), topic, listValue(msg)).Err()
 	}
 
-	cmd := r.client.LPush(context.Background(), topic, eventJSON)
-	return cmd.Err()
+	values := []any{"value", msg.Value}
+	if msg.Key != nil {
+		values = append(values, "key", msg.Key)
+	}
+	if msg.ContentType != "" {
+		values = append(values, "content-type", msg.ContentType)
+	}
+	for name, val := range msg.Headers {
+		if name == "value" || name == "key" || name == "content-type" {
+			continue
+		}
+		values = append(values, name, val)
+	}
+
+	return r.client.XAdd(context.Background(), &redis.XAddArgs{Stream: topic, Values: values}).Err()
+}
+
+// listValue returns the value of the list entry. JSON values are pushed as
+// they are, the other encodings are prefixed with their content type and a
+// newline, e.g. "application/msgpack\n" followed by the message, so
+// consumers of a list with mixed encodings tell them apart.
+func listValue(msg models.Message) []byte {
+	if msg.ContentType == "" || isJSON(msg.ContentType) {
+		return msg.Value
+	}
+
+	value := make([]byte, 0, len(msg.ContentType)+1+len(msg.Value))
+	value = append(value, msg.ContentType...)
+	value = append(value, '\n')
+
+	return append(value, msg.Value...)
+}
+
+// isJSON reports whether the content type is application/json or a JSON
+// based type such as application/cloudevents+json.
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func (r *redisComp) SupportsHeaders() bool {
+	return r.mode == ModeStream
 }
@@ -0,0 +1,28 @@
+package redisc
+
+import (
+	"ditto/models"
+	"testing"
+)
+
+func TestListValue(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"", "payload"},
+		{"application/json", "payload"},
+		{"application/cloudevents+json; charset=utf-8", "payload"},
+		{"application/msgpack", "application/msgpack\npayload"},
+		{"application/x-protobuf; messageType=ditto.v1.Event", "application/x-protobuf; messageType=ditto.v1.Event\npayload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			got := listValue(models.Message{Value: []byte("payload"), ContentType: tt.contentType})
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}